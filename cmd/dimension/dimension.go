@@ -10,27 +10,20 @@ import (
 	msghandling "github.com/chengfeiZhou/Wormhole/internal/app/bridge/message_handling"
 	skiphandler "github.com/chengfeiZhou/Wormhole/internal/app/bridge/skip_handler"
 	"github.com/chengfeiZhou/Wormhole/internal/app/dimension"
+	grpcclient "github.com/chengfeiZhou/Wormhole/internal/app/dimension/grpc_client"
 	httpclient "github.com/chengfeiZhou/Wormhole/internal/app/dimension/http_client"
 	kafkaproducer "github.com/chengfeiZhou/Wormhole/internal/app/dimension/kafka_producer"
 	"github.com/chengfeiZhou/Wormhole/pkg/logger"
-	"github.com/gin-contrib/pprof"
-	"github.com/gin-gonic/gin"
 )
 
 func main() {
 	// 接收系统信号, 通过context关系退出服务
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
 	defer stop()
-	go func() {
-		app := gin.Default()
-		pprof.Register(app) // 性能
-		if err := app.Run(":3000"); err != nil {
-			panic(err)
-		}
-	}()
 	app := dimension.NewApp(filepath.Base(os.Args[0]))
 	// 注册 Module
 	app.AddModule(new(httpclient.Adapter))
+	app.AddModule(new(grpcclient.Adapter))
 	app.AddModule(new(kafkaproducer.Adapter))
 	// 注册Bridge
 	app.AddBridge(new(msghandling.Reader))
@@ -11,10 +11,11 @@ import (
 	msghandling "github.com/chengfeiZhou/Wormhole/internal/app/bridge/message_handling"
 	skiphandler "github.com/chengfeiZhou/Wormhole/internal/app/bridge/skip_handler"
 	"github.com/chengfeiZhou/Wormhole/internal/app/stargate"
+	grpcserver "github.com/chengfeiZhou/Wormhole/internal/app/stargate/grpc_server"
 	httpserver "github.com/chengfeiZhou/Wormhole/internal/app/stargate/http_server"
+	kafkaconsumer "github.com/chengfeiZhou/Wormhole/internal/app/stargate/kafka_consumer"
+	wsserver "github.com/chengfeiZhou/Wormhole/internal/app/stargate/ws_server"
 	"github.com/chengfeiZhou/Wormhole/pkg/logger"
-	"github.com/gin-contrib/pprof"
-	"github.com/gin-gonic/gin"
 )
 
 func main() {
@@ -26,18 +27,12 @@ func main() {
 		log.Panic("实例化日志实例错误")
 		return
 	}
-	// 匿名函数内部初始化了一个 Gin 服务器，并注册了 pprof 性能分析工具，最后让服务器在 :3000 端口上运行
-	go func() {
-		app := gin.Default()
-		pprof.Register(app) // 性能
-		if err = app.Run(":3000"); err != nil {
-			panic(err)
-		}
-	}()
 	app := stargate.NewApp(filepath.Base(os.Args[0]), stargate.WithLogger(logging))
 	// 注册 Module
 	app.AddModule(new(httpserver.Adapter))
-	// app.AddModule(new(kafkaconsumer.Adapter))
+	app.AddModule(new(grpcserver.Adapter))
+	app.AddModule(new(wsserver.Adapter))
+	app.AddModule(new(kafkaconsumer.Adapter))
 
 	// 注册Bridge
 	app.AddBridge(new(msghandling.Writer))
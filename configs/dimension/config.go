@@ -12,17 +12,56 @@ import (
 type Config struct {
 	IsDebug     bool `json:"isDebug"`
 	ChannelSize int  `json:"channelSize"`
+	// admin
+	AdminListen string `json:"adminListen"`
+	AdminSocket string `json:"adminSocket"` // unix socket路径, 非空时不再监听AdminListen
+	AdminToken  string `json:"adminToken"`
+	// trace
+	TraceExporter string `json:"traceExporter"` // none, file, otlp
+	TraceTarget   string `json:"traceTarget"`   // file: 文件路径; otlp: 接收地址
 	// http
-	Bind        string `json:"bind"`
-	HttpTimeout int    `json:"httpTimeout"`
+	Bind                 string `json:"bind"`
+	Routes               string `json:"routes"`  // 路由 => 转发目标的配置文件
+	Policy               string `json:"policy"`  // 请求策略文件, 转发前再次检查
+	Rewrite              string `json:"rewrite"` // 转发请求的重写规则文件
+	HttpTimeout          int    `json:"httpTimeout"`
+	BindScheme           string `json:"bindScheme"`           // 转发到bind使用的协议: http, https
+	Credentials          string `json:"credentials"`          // 转发目标的凭证文件, 设置后删除入站凭证并注入目标凭证
+	BlobWait             int    `json:"blobWait"`             // 等待落盘请求体分块的时间(s)
+	HTTPWorkers          int    `json:"httpWorkers"`          // 同时执行的请求数上限
+	HTTPWorkersPerTarget int    `json:"httpWorkersPerTarget"` // 每个转发目标同时执行的请求数上限, 0与httpWorkers相同
+	HTTPQueueSize        int    `json:"httpQueueSize"`        // 每个转发目标排队的请求数上限
+	HTTPQueueFull        string `json:"httpQueueFull"`        // 目标队列满时: block(暂停读取搬运通道), reject(丢弃该报文并记录)
+	HTTPCA               string `json:"httpCA"`               // 校验https目标证书的CA文件, 为空时使用系统CA
+	HTTPCert             string `json:"httpCert"`             // 客户端证书(mTLS)
+	HTTPKey              string `json:"httpKey"`              // 客户端私钥
+	HTTPServerName       string `json:"httpServerName"`       // SNI以及校验目标证书使用的名称, 为空时使用目标主机名
+	HTTPMinTLS           string `json:"httpMinTLS"`           // 最低TLS版本: 1.2, 1.3
+	// delivery
+	Schedule  string `json:"schedule"`  // 路由的投递计划文件, 为空时只按报文的投递时间延迟
+	DelayPath string `json:"delayPath"` // 延迟队列目录
+	// journal
+	ResponseJournal     int    `json:"responseJournal"`     // 内存中保留的目标响应记录数, 0不记录
+	ResponseBodyLimit   int64  `json:"responseBodyLimit"`   // 每条记录保留的响应体大小上限(byte)
+	ResponseJournalFile string `json:"responseJournalFile"` // 响应记录追加写入的文件(JSON lines), 为空不写入
+	// grpc
+	GRPCTarget  string `json:"grpcTarget"`  // gRPC转发目标(host:port)
+	GRPCCA      string `json:"grpcCA"`      // 校验gRPC目标证书的CA文件, 设置后使用TLS
+	GRPCTimeout int    `json:"grpcTimeout"` // 调用超时(s)
 	// fs
 	HandlingPath string `json:"handlingPath"`
 	ScanInterval int    `json:"scanInterval"`
+	MinFreeSpace int64  `json:"minFreeSpace"` // 搬运目录最小剩余空间(byte), 低于该值时健康检查失败
+	// heartbeat
+	HeartbeatTimeout int `json:"heartbeatTimeout"` // 星门心跳超时(s)
 	// kafka
-	KafkaAddrs     []string `json:"kafkaAddrs"`
-	KafkaUser      string   `json:"kafkaUser"`      // 用户名
-	KafkaPasswd    string   `json:"kafkaPasswd"`    // 密码
-	KafkaMechanism string   `json:"kafkaMechanism"` // 加密算法
+	KafkaAddrs       []string `json:"kafkaAddrs"`
+	KafkaUser        string   `json:"kafkaUser"`        // 用户名
+	KafkaPasswd      string   `json:"kafkaPasswd"`      // 密码
+	KafkaMechanism   string   `json:"kafkaMechanism"`   // 加密算法
+	KafkaProvenance  bool     `json:"kafkaProvenance"`  // 写入来源消息头(集群, topic, 分区, offset)
+	KafkaTopicMap    string   `json:"kafkaTopicMap"`    // topic映射文件
+	KafkaPartitioner string   `json:"kafkaPartitioner"` // 默认分区策略: hash, source, roundrobin, random
 }
 
 /*
@@ -54,18 +93,60 @@ func InitConfig(args []string) (*Config, error) {
 	fg.String(flag.DefaultConfigFlagname, "", "配置文件路径(abs)") // 有文件解析文件
 	fg.BoolVar(&conf.IsDebug, "isDebug", false, "isDebug")
 	fg.IntVar(&conf.ChannelSize, "channelSize", 100, "搬运缓存队列长度")
+	// admin
+	fg.StringVar(&conf.AdminListen, "adminListen", "127.0.0.1:3000", "管理接口监听地址(为空则不启动, 非本机地址需要设置adminToken)")
+	fg.StringVar(&conf.AdminSocket, "adminSocket", "", "管理接口unix socket路径(设置后不监听adminListen)")
+	fg.StringVar(&conf.AdminToken, "adminToken", "", "管理接口鉴权token(Authorization: Bearer <token>)")
+	// trace
+	fg.StringVar(&conf.TraceExporter, "traceExporter", "none", "链路数据导出方式(none, file, otlp)")
+	fg.StringVar(&conf.TraceTarget, "traceTarget", "", "链路数据导出目标(file: 文件路径; otlp: 如http://127.0.0.1:4318/v1/traces)")
 	// http
 	fg.StringVar(&conf.Bind, "bind", "127.0.0.1:8081", "转发目标(ip:port)")
+	fg.StringVar(&conf.BindScheme, "bindScheme", "http", "转发到bind使用的协议(http, https)")
+	fg.StringVar(&conf.Routes, "routes", "", "路由对应的转发目标文件(JSON), 没有路由的请求转发到bind")
+	fg.StringVar(&conf.Policy, "policy", "", "请求策略文件(JSON), 转发前再次检查, 为空不检查")
+	fg.StringVar(&conf.Rewrite, "rewrite", "", "转发请求的重写规则文件(JSON), 为空时只删除逐跳请求头")
+	fg.StringVar(&conf.Credentials, "credentials", "", "转发目标的凭证文件(JSON), 设置后删除请求中的入站凭证并按路由注入目标凭证")
+	fg.IntVar(&conf.BlobWait, "blobWait", 60, "等待落盘请求体分块搬运完成的时间(s)")
 	fg.IntVar(&conf.HttpTimeout, "httpTimeout", 10, "请求超时时间(s)")
+	fg.IntVar(&conf.HTTPWorkers, "httpWorkers", 64, "同时执行的请求数上限")
+	fg.IntVar(&conf.HTTPWorkersPerTarget, "httpWorkersPerTarget", 0, "每个转发目标(host:port)同时执行的请求数上限, 0与httpWorkers相同")
+	fg.IntVar(&conf.HTTPQueueSize, "httpQueueSize", 1000, "每个转发目标排队的请求数上限")
+	fg.StringVar(&conf.HTTPQueueFull, "httpQueueFull", "block",
+		"转发目标的队列满时: block(暂停读取搬运通道, 所有目标都暂停), reject(丢弃该报文并写入日志和响应记录)")
+	fg.StringVar(&conf.HTTPCA, "httpCA", "", "校验https目标证书的CA文件(PEM), 为空时使用系统CA")
+	fg.StringVar(&conf.HTTPCert, "httpCert", "", "https客户端证书(PEM, mTLS), 与httpKey同时设置")
+	fg.StringVar(&conf.HTTPKey, "httpKey", "", "https客户端私钥(PEM)")
+	fg.StringVar(&conf.HTTPServerName, "httpServerName", "", "SNI以及校验目标证书使用的名称, 为空时使用目标主机名")
+	fg.StringVar(&conf.HTTPMinTLS, "httpMinTLS", "1.2", "https最低TLS版本(1.2, 1.3)")
+	// delivery
+	fg.StringVar(&conf.Schedule, "schedule", "", "路由的投递计划文件(JSON), 为空时只按报文的投递时间延迟")
+	fg.StringVar(&conf.DelayPath, "delayPath", files.JoinPath(files.RootAbPathByCaller(), "delay"),
+		"延迟队列目录, 未到投递时间的报文保存在该目录中")
+	// journal
+	fg.IntVar(&conf.ResponseJournal, "responseJournal", 0, "内存中保留的目标响应记录数, 0不记录")
+	fg.Int64Var(&conf.ResponseBodyLimit, "responseBodyLimit", 4<<10, "每条响应记录保留的响应体大小上限(byte)")
+	fg.StringVar(&conf.ResponseJournalFile, "responseJournalFile", "", "响应记录追加写入的文件(JSON lines), 为空不写入")
+	// grpc
+	fg.StringVar(&conf.GRPCTarget, "grpcTarget", "127.0.0.1:9091", "gRPC转发目标(host:port)")
+	fg.StringVar(&conf.GRPCCA, "grpcCA", "", "校验gRPC目标证书的CA文件(PEM), 设置后使用TLS")
+	fg.IntVar(&conf.GRPCTimeout, "grpcTimeout", 10, "gRPC调用超时时间(s)")
 	// kafka
 	kafkaAddrs := fg.String("kafkaAddrs", "127.0.0.1:9200", "kafka地址(单机:127.0.0.1:9092; 集群:'192.168.100.100:9092,192.168.100.101:9092')")
 	fg.StringVar(&conf.KafkaUser, "kafkaUser", "", "kafka鉴权用户名")
 	fg.StringVar(&conf.KafkaPasswd, "kafkaPasswd", "", "kafka鉴权密码")
 	fg.StringVar(&conf.KafkaMechanism, "kafkaMechanism", "PLAIN", "kafka鉴权的加密算法")
+	fg.BoolVar(&conf.KafkaProvenance, "kafkaProvenance", false, "写入来源消息头(X-Wormhole-Source-Cluster/Topic/Partition/Offset)")
+	fg.StringVar(&conf.KafkaTopicMap, "kafkaTopicMap", "", "topic映射文件(JSON), 为空时生产到源topic")
+	fg.StringVar(&conf.KafkaPartitioner, "kafkaPartitioner", "hash",
+		"默认分区策略(hash: 按key哈希, 与Java客户端一致; source: 与源消息相同的分区; roundrobin: 轮询; random: 随机)")
 	// FS
 	fg.StringVar(&conf.HandlingPath, "handlingPath", files.JoinPath(files.RootAbPathByCaller(), "tmp"),
 		"搬运数据中间目录路径")
 	fg.IntVar(&conf.ScanInterval, "scanInterval", 5, "搬运目录扫描时间间隔(s)")
+	fg.Int64Var(&conf.MinFreeSpace, "minFreeSpace", 100<<20, "搬运目录最小剩余空间(byte)")
+	// heartbeat
+	fg.IntVar(&conf.HeartbeatTimeout, "heartbeatTimeout", 120, "星门心跳超时时间(s), 超时后就绪检查失败; 0表示不检查")
 
 	// 执行参数解析
 	if err := fg.Parse(args); err != nil {
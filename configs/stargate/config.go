@@ -12,19 +12,68 @@ import (
 type Config struct {
 	IsDebug     bool `json:"isDebug"`
 	ChannelSize int  `json:"channelSize"`
+	// admin
+	AdminListen string `json:"adminListen"`
+	AdminSocket string `json:"adminSocket"` // unix socket路径, 非空时不再监听AdminListen
+	AdminToken  string `json:"adminToken"`
+	// trace
+	TraceExporter string `json:"traceExporter"` // none, file, otlp
+	TraceTarget   string `json:"traceTarget"`   // file: 文件路径; otlp: 接收地址
+	// tracking
+	TrackingSize int    `json:"trackingSize"` // 记录搬运状态的报文数, 0不记录
+	StatusPath   string `json:"statusPath"`   // http接收模块上查询报文状态的路径前缀, 为空不提供
 	// http
-	Listen string `json:"bind"`
+	Listen        string `json:"bind"`
+	Routes        string `json:"routes"`        // 路由表文件
+	MaxBodySize   int64  `json:"maxBodySize"`   // 随搬运记录一起写入的请求体上限(byte)
+	LargeBody     string `json:"largeBody"`     // 超出MaxBodySize的请求: reject, spool
+	MaxSpoolSize  int64  `json:"maxSpoolSize"`  // 落盘的请求体上限(byte), 0不限制
+	SpoolTimeout  int    `json:"spoolTimeout"`  // 落盘请求的读写超时(s)
+	TLSCert       string `json:"tlsCert"`       // 证书文件, 设置后启用https
+	TLSKey        string `json:"tlsKey"`        // 私钥文件
+	TLSClientCA   string `json:"tlsClientCA"`   // 校验客户端证书的CA文件, 设置后启用mTLS
+	TLSClientAuth string `json:"tlsClientAuth"` // 客户端证书校验方式: optional, require
+	// grpc
+	GRPCListen   string   `json:"grpcListen"`
+	GRPCServices []string `json:"grpcServices"` // 捕获一元调用的服务(package.Service), *表示所有服务
+	// websocket
+	WSListen       string `json:"wsListen"`
+	WSMaxConns     int    `json:"wsMaxConns"`     // 同时保持的连接数上限, 0不限制
+	WSMaxFrameSize int64  `json:"wsMaxFrameSize"` // 单帧(消息)上限(byte)
+	WSStallTimeout int    `json:"wsStallTimeout"` // 帧无法写入搬运通道的最长等待(s), 超时后关闭连接; 0一直等待
+	WSPingInterval int    `json:"wsPingInterval"` // 心跳(ping)间隔(s), 两个间隔内没有收到任何数据时关闭连接; 0不发送
+	WSAck          bool   `json:"wsAck"`          // 每帧写入搬运通道后回复报文ID
+	// auth
+	AuthAPIKeys     string   `json:"authAPIKeys"`    // API key文件
+	AuthHMACKeys    string   `json:"authHMACKeys"`   // HMAC签名密钥文件
+	AuthHMACWindow  int      `json:"authHMACWindow"` // HMAC时间戳允许的偏差(s)
+	AuthJWKS        []string `json:"authJWKS"`       // JWKS文件
+	AuthJWTIssuer   string   `json:"authJWTIssuer"`
+	AuthJWTAudience string   `json:"authJWTAudience"`
+	// ratelimit
+	RateLimits string `json:"rateLimits"` // 限流配置文件
+	// policy
+	Policy string `json:"policy"` // 请求策略文件
 	// kafka
 	KafkaAddrs     []string `json:"kafkaAddrs"`
 	KafkaTopics    []string `json:"kafkaTopics"`
 	KafkaUser      string   `json:"kafkaUser"`      // 用户名
 	KafkaPasswd    string   `json:"kafkaPasswd"`    // 密码
 	KafkaMechanism string   `json:"kafkaMechanism"` // 加密算法
+	KafkaGroupID   string   `json:"kafkaGroupID"`   // 消费者组
+	KafkaOffset    string   `json:"kafkaOffset"`    // 没有提交offset时的起始位置: oldest, newest, 时间(RFC3339或unix秒)
+	KafkaRegex     string   `json:"kafkaRegex"`     // 按正则订阅topic
+	KafkaRefresh   int      `json:"kafkaRefresh"`   // 正则订阅刷新topic列表的间隔(s)
+	KafkaBackend   string   `json:"kafkaBackend"`   // 客户端: sarama, confluent
+	KafkaCluster   string   `json:"kafkaCluster"`   // 源集群名称, 随消息搬运
 
 	// file
 	HandlingPath string `json:"handlingPath"`
 	WriterTicker int    `json:"writerTicker"` // 文件写入间隔
 	FileMaxSize  int64  `json:"fileMaxSize"`  // 单文件最大(byte)
+	MinFreeSpace int64  `json:"minFreeSpace"` // 搬运目录最小剩余空间(byte), 低于该值时健康检查失败
+	// heartbeat
+	HeartbeatInterval int `json:"heartbeatInterval"` // 心跳写入间隔(s)
 }
 
 /*
@@ -56,19 +105,68 @@ func InitConfig(args []string) (*Config, error) {
 	fg.String(flag.DefaultConfigFlagname, "", "配置文件路径(abs)") // 有文件解析文件
 	fg.BoolVar(&conf.IsDebug, "isDebug", false, "isDebug")
 	fg.IntVar(&conf.ChannelSize, "channelSize", 100, "搬运缓存队列长度")
+	// admin
+	fg.StringVar(&conf.AdminListen, "adminListen", "127.0.0.1:3000", "管理接口监听地址(为空则不启动, 非本机地址需要设置adminToken)")
+	fg.StringVar(&conf.AdminSocket, "adminSocket", "", "管理接口unix socket路径(设置后不监听adminListen)")
+	fg.StringVar(&conf.AdminToken, "adminToken", "", "管理接口鉴权token(Authorization: Bearer <token>)")
+	// trace
+	fg.StringVar(&conf.TraceExporter, "traceExporter", "none", "链路数据导出方式(none, file, otlp)")
+	fg.StringVar(&conf.TraceTarget, "traceTarget", "", "链路数据导出目标(file: 文件路径; otlp: 如http://127.0.0.1:4318/v1/traces)")
+	// tracking
+	fg.IntVar(&conf.TrackingSize, "trackingSize", 100000, "在内存中记录搬运状态的报文数, 0不记录")
+	fg.StringVar(&conf.StatusPath, "statusPath", "", "http接收模块上查询报文状态的路径前缀(如/_wormhole/messages/), 为空不提供")
 	// http
 	fg.StringVar(&conf.Listen, "listen", "0.0.0.0:8080", "对外提供服务")
+	fg.StringVar(&conf.Routes, "routes", "", "路由表文件(JSON), 为空时不区分路由")
+	fg.Int64Var(&conf.MaxBodySize, "maxBodySize", 10<<20, "随搬运记录一起写入的请求体上限(byte)")
+	fg.StringVar(&conf.LargeBody, "largeBody", "reject", "超出maxBodySize的请求(reject: 返回413; spool: 请求体分块落盘后搬运)")
+	fg.Int64Var(&conf.MaxSpoolSize, "maxSpoolSize", 1<<30, "落盘的请求体上限(byte), 超出返回413; 0表示不限制")
+	fg.IntVar(&conf.SpoolTimeout, "spoolTimeout", 600, "落盘请求的读写超时(s)")
+	fg.StringVar(&conf.TLSCert, "tlsCert", "", "https证书文件(PEM), 文件更新后自动重新加载")
+	fg.StringVar(&conf.TLSKey, "tlsKey", "", "https私钥文件(PEM)")
+	fg.StringVar(&conf.TLSClientCA, "tlsClientCA", "", "校验客户端证书的CA文件(PEM), 设置后启用mTLS")
+	fg.StringVar(&conf.TLSClientAuth, "tlsClientAuth", "require", "客户端证书校验方式(optional: 提供时校验; require: 必须提供)")
+	// grpc
+	fg.StringVar(&conf.GRPCListen, "grpcListen", "0.0.0.0:9090", "gRPC接收模块监听地址")
+	grpcServices := fg.String("grpcServices", "", "gRPC接收模块捕获一元调用的服务('billing.v1.Orders,report.v1.Daily'), *表示所有服务")
+	// websocket
+	fg.StringVar(&conf.WSListen, "wsListen", "0.0.0.0:8090", "websocket接收模块监听地址")
+	fg.IntVar(&conf.WSMaxConns, "wsMaxConns", 1024, "websocket同时保持的连接数上限, 0不限制")
+	fg.Int64Var(&conf.WSMaxFrameSize, "wsMaxFrameSize", 1<<20, "websocket单帧(消息)上限(byte), 超出时关闭连接")
+	fg.IntVar(&conf.WSStallTimeout, "wsStallTimeout", 30, "websocket帧无法写入搬运通道的最长等待(s), 超时后关闭连接; 0一直等待")
+	fg.IntVar(&conf.WSPingInterval, "wsPingInterval", 30, "websocket心跳间隔(s), 两个间隔内没有收到数据时关闭连接; 0不发送")
+	fg.BoolVar(&conf.WSAck, "wsAck", false, "websocket每帧写入搬运通道后回复报文ID({\"seq\":1,\"id\":\"...\"})")
+	// auth
+	fg.StringVar(&conf.AuthAPIKeys, "authAPIKeys", "", "API key文件(JSON: {\"名称\": \"key\"}), 设置后启用API key认证")
+	fg.StringVar(&conf.AuthHMACKeys, "authHMACKeys", "", "HMAC签名密钥文件(JSON: {\"key id\": \"secret\"}), 设置后启用签名认证")
+	fg.IntVar(&conf.AuthHMACWindow, "authHMACWindow", 300, "HMAC签名时间戳允许的偏差(s)")
+	authJWKS := fg.String("authJWKS", "", "JWKS文件('a.json,b.json'), 设置后启用JWT认证")
+	fg.StringVar(&conf.AuthJWTIssuer, "authJWTIssuer", "", "JWT签发者(iss), 为空不校验")
+	fg.StringVar(&conf.AuthJWTAudience, "authJWTAudience", "", "JWT受众(aud), 为空不校验")
+	// ratelimit
+	fg.StringVar(&conf.RateLimits, "rateLimits", "", "限流与每日配额配置文件(JSON), 为空不限流")
+	// policy
+	fg.StringVar(&conf.Policy, "policy", "", "请求策略文件(JSON), 为空不检查")
 	// kafka
 	kafkaAddrs := fg.String("kafkaAddrs", "127.0.0.1:9092", "kafka地址(单机:127.0.0.1:9092; 集群:'192.168.100.100:9092,192.168.100.101:9092')")
 	kafkaTopics := fg.String("kafkaTopics", "", "订阅topic('topic1,topic2')")
 	fg.StringVar(&conf.KafkaUser, "kafkaUser", "", "kafka鉴权用户名")
 	fg.StringVar(&conf.KafkaPasswd, "kafkaPasswd", "", "kafka鉴权密码")
 	fg.StringVar(&conf.KafkaMechanism, "kafkaMechanism", "PLAIN", "kafka鉴权的加密算法")
+	fg.StringVar(&conf.KafkaGroupID, "kafkaGroupID", "wormhole_stargate", "kafka消费者组")
+	fg.StringVar(&conf.KafkaOffset, "kafkaOffset", "oldest", "消费者组没有提交offset时的起始位置(oldest, newest, 时间: RFC3339或unix秒)")
+	fg.StringVar(&conf.KafkaRegex, "kafkaRegex", "", "按正则订阅topic(如'^orders\\.'), 与kafkaTopics合并")
+	fg.IntVar(&conf.KafkaRefresh, "kafkaRefresh", 60, "正则订阅刷新topic列表的间隔(s)")
+	fg.StringVar(&conf.KafkaBackend, "kafkaBackend", "sarama", "kafka客户端(sarama: 纯Go; confluent: librdkafka)")
+	fg.StringVar(&conf.KafkaCluster, "kafkaCluster", "", "源kafka集群名称, 随消息搬运(次元kafkaProvenance写入消息头); 为空时使用kafkaAddrs")
 
 	// file
 	fg.StringVar(&conf.HandlingPath, "handlingPath", files.JoinPath(files.RootAbPathByCaller(), "tmp"), "搬运数据中间目录路径")
 	fg.IntVar(&conf.WriterTicker, "writerTick", 1, "写文件间隔(s)")
 	fg.Int64Var(&conf.FileMaxSize, "fileMaxSize", 10<<20, "单文件最大(byte)")
+	fg.Int64Var(&conf.MinFreeSpace, "minFreeSpace", 100<<20, "搬运目录最小剩余空间(byte)")
+	// heartbeat
+	fg.IntVar(&conf.HeartbeatInterval, "heartbeatInterval", 30, "心跳写入搬运文件的间隔(s), 0表示不发送心跳")
 
 	// 执行参数解析
 	if err := fg.Parse(args); err != nil {
@@ -77,7 +175,15 @@ func InitConfig(args []string) (*Config, error) {
 	Print(fg)
 	// 解析切片值
 	conf.KafkaAddrs = strings.Split(*kafkaAddrs, ",")
-	conf.KafkaTopics = strings.Split(*kafkaTopics, ",")
+	if *kafkaTopics != "" {
+		conf.KafkaTopics = strings.Split(*kafkaTopics, ",")
+	}
+	if *grpcServices != "" {
+		conf.GRPCServices = strings.Split(*grpcServices, ",")
+	}
+	if *authJWKS != "" {
+		conf.AuthJWKS = strings.Split(*authJWKS, ",")
+	}
 	return conf, nil
 }
 
@@ -8,9 +8,14 @@ import (
 	"io"
 	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/chengfeiZhou/Wormhole/internal/app/dimension"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/control"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/health"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/metrics"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/structs"
 	"github.com/chengfeiZhou/Wormhole/pkg/logger"
 	"github.com/chengfeiZhou/Wormhole/pkg/storage/files"
 )
@@ -20,10 +25,16 @@ import (
 // 2. 每次读多个文件
 // nolint
 type Reader struct {
-	log          logger.Logger
-	path         string        // 缓存目录
-	scanInterval time.Duration // 目录扫描定时
-	msgChan      chan<- []byte // 报文转移通道
+	control.Switch // ingress暂停开关
+	log            logger.Logger
+	path           string        // 缓存目录
+	scanInterval   time.Duration // 目录扫描定时
+	msgChan        chan<- []byte // 报文转移通道
+	rescan         chan struct{} // 立即扫描的信号
+	reading        atomic.Int64  // 正在读取的文件数
+	files          atomic.Uint64 // 已读取完成的文件数
+	heartbeat      atomic.Int64  // 最后一次读到星门心跳的时间(unix nano)
+	seq            control.Sequence
 }
 
 type OptionFuncToRead func(*Reader)
@@ -75,6 +86,7 @@ func NewReader(msgChan chan<- []byte, ops ...OptionFuncToRead) *Reader {
 		msgChan:      msgChan,
 		scanInterval: 5 * time.Second,
 		path:         files.JoinPath(files.RootAbPathByCaller(), "tmp"),
+		rescan:       make(chan struct{}, 1),
 	}
 	for _, op := range ops {
 		op(ad)
@@ -113,6 +125,14 @@ func (r *Reader) Setup(app *dimension.App, msgChan chan<- []byte) error {
 	r.msgChan = msgChan
 	r.path = app.Config.HandlingPath
 	r.scanInterval = time.Duration(app.Config.ScanInterval) * time.Second
+	r.rescan = make(chan struct{}, 1)
+	// 磁盘满时重启不能释放空间, 只影响就绪
+	app.Health().Liveness(r.GetName(), "handlingPath", health.DirExists(r.path))
+	app.Health().Readiness(r.GetName(), "handlingPathSpace", health.WritableDir(r.path, app.Config.MinFreeSpace))
+	if app.Config.HeartbeatTimeout > 0 {
+		app.Health().Readiness(r.GetName(), "heartbeat",
+			health.Fresh("星门心跳", r.LastHeartbeat, time.Duration(app.Config.HeartbeatTimeout)*time.Second))
+	}
 	return nil
 }
 
@@ -140,9 +160,17 @@ func (r *Reader) Run(ctx context.Context) error {
 	for {
 		select {
 		case <-tick.C:
+			if r.Paused() {
+				continue
+			}
+			if err := r.handling(); err != nil {
+				r.log.Error(logger.ErrorMethod, "文件搬运操作", logger.ErrorField(err))
+			}
+		case <-r.rescan:
 			if err := r.handling(); err != nil {
 				r.log.Error(logger.ErrorMethod, "文件搬运操作", logger.ErrorField(err))
 			}
+			tick.Reset(r.scanInterval)
 		case <-ctx.Done():
 			r.log.Info("文件搬运读取模块退出")
 			return nil
@@ -150,6 +178,35 @@ func (r *Reader) Run(ctx context.Context) error {
 	}
 }
 
+// Rescan 立即扫描一次搬运目录(暂停状态下同样生效)
+func (r *Reader) Rescan() error {
+	select {
+	case r.rescan <- struct{}{}:
+	default: // 已有待处理的扫描请求
+	}
+	return nil
+}
+
+// LastHeartbeat 返回最后一次读到星门心跳的时间, 没有读到过时返回零值
+func (r *Reader) LastHeartbeat() time.Time {
+	n := r.heartbeat.Load()
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+// Status 上报文件搬运读取的运行状态
+func (r *Reader) Status() map[string]any {
+	return map[string]any{
+		"handlingPath":  r.path,
+		"lastHeartbeat": r.LastHeartbeat(),
+		"readingFiles":  r.reading.Load(),
+		"filesRead":     r.files.Load(),
+		"lastSeq":       r.seq.Last(),
+	}
+}
+
 // handling 是Reader类型的方法，用于处理目录中的文件
 // 如果目录不存在或处理文件时发生错误，则返回非零错误码
 func (r *Reader) handling() error {
@@ -164,7 +221,9 @@ func (r *Reader) handling() error {
 			continue
 		}
 		if strings.HasSuffix(fi.Name(), targetExt) {
+			r.reading.Add(1)
 			go func(filename string) {
+				defer r.reading.Add(-1)
 				r.log.Info("处理搬运文件", logger.MakeField("filename", filename))
 				// 文件是ready的文件
 				newName, err := renameReadyFile(files.JoinPath(r.path, filename))
@@ -177,9 +236,11 @@ func (r *Reader) handling() error {
 					if _, errF := restoreFileToReady(newName); errF != nil {
 						r.log.Error(logger.ErrorWriteFile, "错误文件命名恢复", logger.ErrorField(err), logger.MakeField("restore file", newName))
 					}
+					return
 				}
 				// 删除文件
 				_ = os.RemoveAll(newName)
+				r.files.Add(1)
 			}(fi.Name())
 		}
 	}
@@ -208,6 +269,7 @@ func (r *Reader) readFileAndSend(filename string) error {
 		r.log.Error(logger.ErrorWriteFile, "文件信息获取错误", logger.ErrorField(err), logger.MakeField("filename", filename))
 		return err
 	}
+	metrics.TransferFile(metrics.FileRead, fs.Size())
 	br := bufio.NewReaderSize(f, int(fs.Size()))
 	for {
 		// TODO: @zcf 如何优雅的读取大文件?
@@ -219,11 +281,29 @@ func (r *Reader) readFileAndSend(filename string) error {
 			r.log.Error(logger.ErrorReadFile, "read file error", logger.ErrorField(err), logger.MakeField("filename", filename))
 			break
 		}
+		if structs.IsHeartbeat(line) {
+			r.handleHeartbeat(line)
+			continue
+		}
+		metrics.MessageIn(r.GetName(), control.LaneIngress, len(line))
 		r.msgChan <- line
+		r.seq.Next()
+		metrics.MessageOut(r.GetName(), control.LaneIngress, len(line))
 	}
 	return nil
 }
 
+// handleHeartbeat 记录星门心跳, 心跳不会被转发给发送模块
+func (r *Reader) handleHeartbeat(line []byte) {
+	hb, err := structs.ParseHeartbeat(line)
+	if err != nil {
+		r.log.Warn(logger.ErrorParam, "心跳解析", logger.ErrorField(err))
+		return
+	}
+	r.heartbeat.Store(time.Now().UnixNano())
+	r.log.Debugf("收到星门心跳: %s, 延迟: %s", hb.Name, time.Since(time.UnixMilli(hb.Time)))
+}
+
 // renameReadyFile 对允许搬运的文件重命名
 // .hsxa ==> .hsxa_bak
 func renameReadyFile(abFilePath string) (string, error) {
@@ -4,9 +4,15 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/chengfeiZhou/Wormhole/internal/app/stargate"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/control"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/health"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/metrics"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/structs"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/tracking"
 	"github.com/chengfeiZhou/Wormhole/pkg/logger"
 	"github.com/chengfeiZhou/Wormhole/pkg/storage/files"
 )
@@ -21,12 +27,20 @@ const (
 // 2. 多个message写入一个文件, 每1秒钟检查一次
 // nolint
 type Writer struct {
-	log         logger.Logger
-	writeTick   time.Duration
-	bufMaxSize  int
-	fileMaxSize int64
-	path        string
-	msgChan     <-chan []byte // 报文转移通道
+	control.Switch    // egress暂停开关
+	log               logger.Logger
+	writeTick         time.Duration
+	bufMaxSize        int
+	fileMaxSize       int64
+	path              string
+	msgChan           <-chan []byte // 报文转移通道
+	rotate            chan struct{} // 强制切换文件的信号
+	name              string        // 服务名称, 写入心跳
+	heartbeatInterval time.Duration // 心跳写入间隔, 0表示不发送心跳
+	current           atomic.Value  // 当前正在写入的文件名
+	files             atomic.Uint64 // 已写入的文件数
+	seq               control.Sequence
+	tracker           *tracking.Tracker // 报文搬运状态
 }
 
 type OptionFuncToWriter func(*Writer)
@@ -57,6 +71,20 @@ func WithWriterTicker(t time.Duration) OptionFuncToWriter {
 	}
 }
 
+// WithHeartbeatInterval 设置心跳写入间隔, 0表示不发送心跳
+func WithHeartbeatInterval(t time.Duration) OptionFuncToWriter {
+	return func(w *Writer) {
+		w.heartbeatInterval = t
+	}
+}
+
+// WithTracker 设置报文搬运状态记录
+func WithTracker(t *tracking.Tracker) OptionFuncToWriter {
+	return func(w *Writer) {
+		w.tracker = t
+	}
+}
+
 // WithFileSize 是一个返回 OptionFuncToWriter 类型函数的函数，用于设置 Writer 的文件最大大小。
 // 参数 s 是文件最大大小的 int64 类型的值。
 // 返回的 OptionFuncToWriter 类型的函数接受一个指向 Writer 类型的指针 w，
@@ -77,6 +105,7 @@ func NewWriter(msgChan <-chan []byte, ops ...OptionFuncToWriter) *Writer {
 		writeTick:   time.Second,
 		fileMaxSize: 10 << 20, // 10MB
 		path:        files.JoinPath(files.RootAbPathByCaller(), "tmp"),
+		rotate:      make(chan struct{}, 1),
 	}
 	for _, op := range ops {
 		op(ad)
@@ -108,6 +137,13 @@ func (w *Writer) Setup(app *stargate.App, msgChan <-chan []byte) error {
 	w.msgChan = msgChan
 	w.path = app.Config.HandlingPath
 	w.writeTick = time.Duration(app.Config.WriterTicker) * time.Second
+	w.rotate = make(chan struct{}, 1)
+	w.name = app.Name()
+	w.heartbeatInterval = time.Duration(app.Config.HeartbeatInterval) * time.Second
+	w.tracker = app.Tracker()
+	// 磁盘满时重启不能释放空间, 只影响就绪
+	app.Health().Liveness(w.GetName(), "handlingPath", health.DirExists(w.path))
+	app.Health().Readiness(w.GetName(), "handlingPathSpace", health.WritableDir(w.path, app.Config.MinFreeSpace))
 	return nil
 }
 
@@ -156,46 +192,69 @@ func (w *Writer) Run(ctx context.Context) error {
 	w.log.Info("执行文件搬运写入", logger.MakeField("handlingPath", w.path))
 	tick := time.NewTicker(w.writeTick)
 	var (
-		sf  *files.StreamFile
-		err error
+		sf        *files.StreamFile
+		err       error
+		heartbeat <-chan time.Time
 	)
+	if w.heartbeatInterval > 0 {
+		hbTick := time.NewTicker(w.heartbeatInterval)
+		defer hbTick.Stop()
+		heartbeat = hbTick.C
+	}
 	for {
+		// egress暂停时不再从通道中读取报文, 报文积压在通道中
+		in, resumed := w.msgChan, w.Resumed()
+		if resumed != nil {
+			in = nil
+		}
 		select {
-		case data, ok := <-w.msgChan:
+		case <-resumed:
+			continue
+		case data, ok := <-in:
 			if !ok {
 				continue
 			}
-			if sf == nil {
-				if sf, err = files.NewStreamFile(w.path, files.GetFileName("message", targetExt)); err != nil {
-					w.log.Error(logger.ErrorWriteFile, "创建搬运文件", logger.ErrorField(err))
-					continue
-				}
-			}
-			// nolint
-			if err := sf.Write(data); err != nil {
-				w.log.Error(logger.ErrorWriteFile, "写入搬运文件缓存", logger.ErrorField(err), logger.MakeField("filePath", sf.Name()))
+			metrics.MessageIn(w.GetName(), control.LaneEgress, len(data))
+			id := structs.PeekID(data)
+			if sf, err = w.writeLine(sf, data); err != nil {
+				w.tracker.Failed(id, err)
 				continue
 			}
-			w.log.Info("写入搬运文件缓存", logger.MakeField("filename", sf.Name()))
+			w.tracker.Written(id, sf.Name())
+			w.log.Info("写入搬运文件缓存", logger.MakeField("seq", w.seq.Next()), logger.MakeField("filename", sf.Name()))
+			metrics.MessageOut(w.GetName(), control.LaneEgress, len(data))
 			if sf.FileSize() >= w.fileMaxSize {
 				// 文件大于w.fileMaxSize, 写入文件并重置ticker
-				sf, err = sf.Close()
-				if err != nil {
-					w.log.Error(logger.ErrorWriteFile, "文件关闭", logger.ErrorField(err))
-				}
+				sf = w.closeFile(sf)
 				tick.Reset(w.writeTick)
 			}
+		case <-heartbeat:
+			if w.Paused() {
+				continue
+			}
+			hb, err := structs.NewHeartbeat(w.name).Marshal()
+			if err != nil {
+				w.log.Error(logger.ErrorParam, "心跳序列化", logger.ErrorField(err))
+				continue
+			}
+			if sf, err = w.writeLine(sf, hb); err != nil {
+				continue
+			}
+			w.log.Debugf("写入心跳: %s", sf.Name())
+		case <-w.rotate:
+			if sf == nil {
+				continue
+			}
+			w.log.Info("强制切换搬运文件", logger.MakeField("cachefile", sf.Name()))
+			sf = w.closeFile(sf)
+			tick.Reset(w.writeTick)
 		case <-tick.C:
 			// 判断file对象是否存在
 			if sf == nil {
 				continue
 			}
 			w.log.Info("搬运文件写入", logger.MakeField("cachefile", sf.Name()))
-			var err error
-			sf, err = sf.Close()
-			if err != nil {
-				w.log.Error(logger.ErrorWriteFile, "文件关闭", logger.ErrorField(err))
-			}
+			sf = w.closeFile(sf)
 		case <-ctx.Done():
 			w.log.Info("文件搬运写入模块退出")
 			return nil
@@ -203,6 +262,60 @@ func (w *Writer) Run(ctx context.Context) error {
 	}
 }
 
+// writeLine 向当前的搬运文件写入一行数据, 当前没有文件时创建新文件
+func (w *Writer) writeLine(sf *files.StreamFile, data []byte) (*files.StreamFile, error) {
+	var err error
+	if sf == nil {
+		if sf, err = files.NewStreamFile(w.path, files.GetFileName("message", targetExt)); err != nil {
+			w.log.Error(logger.ErrorWriteFile, "创建搬运文件", logger.ErrorField(err))
+			return nil, err
+		}
+		w.current.Store(sf.Name())
+	}
+	if err := sf.Write(data); err != nil {
+		w.log.Error(logger.ErrorWriteFile, "写入搬运文件缓存", logger.ErrorField(err), logger.MakeField("filePath", sf.Name()))
+		return sf, err
+	}
+	return sf, nil
+}
+
+// closeFile 关闭当前的搬运文件, 并记录状态
+func (w *Writer) closeFile(sf *files.StreamFile) *files.StreamFile {
+	sf.Flush()
+	size := sf.FileSize()
+	cache := sf.Name()
+	sf, err := sf.CloseNotify(func(target string, err error) {
+		w.tracker.Published(cache, target, err)
+	})
+	if err != nil {
+		w.log.Error(logger.ErrorWriteFile, "文件关闭", logger.ErrorField(err))
+	}
+	w.files.Add(1)
+	w.current.Store("")
+	metrics.TransferFile(metrics.FileWritten, size)
+	return sf
+}
+
+// Rotate 强制关闭当前的搬运文件, 后续报文写入新文件
+func (w *Writer) Rotate() error {
+	select {
+	case w.rotate <- struct{}{}:
+	default: // 已有待处理的切换请求
+	}
+	return nil
+}
+
+// Status 上报文件搬运写入的运行状态
+func (w *Writer) Status() map[string]any {
+	current, _ := w.current.Load().(string)
+	return map[string]any{
+		"handlingPath": w.path,
+		"currentFile":  current,
+		"filesWritten": w.files.Load(),
+		"lastSeq":      w.seq.Last(),
+	}
+}
+
 // writFileOnce 写入文件一次，并返回文件路径和可能发生的错误
 //
 // 参数：
@@ -3,10 +3,18 @@ package dimension
 import (
 	"context"
 	"fmt"
+	"net/http"
 
 	config "github.com/chengfeiZhou/Wormhole/configs/dimension"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/admin"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/control"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/health"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/journal"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/metrics"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/schedule"
 	"github.com/chengfeiZhou/Wormhole/internal/pkg/structs"
 	"github.com/chengfeiZhou/Wormhole/pkg/logger"
+	"github.com/chengfeiZhou/Wormhole/pkg/trace"
 )
 
 type Module interface {
@@ -26,12 +34,20 @@ type Bridge interface {
 
 // nolint
 type App struct {
-	name    string            // 服务名称
-	msg     chan []byte       // modules => bridge 传输数据的channel
-	modules map[string]Module // 注册的 Module
-	bridges map[string]Bridge // 注册的 Bridge
-	module  Module            // 被实例化的Module
-	bridge  Bridge            // 被实例化的Bridge
+	name    string             // 服务名称
+	msg     chan []byte        // bridge => 延迟投递 传输数据的channel
+	out     chan []byte        // 延迟投递 => module 传输数据的channel
+	modules map[string]Module  // 注册的 Module
+	bridges map[string]Bridge  // 注册的 Bridge
+	module  Module             // 被实例化的Module
+	bridge  Bridge             // 被实例化的Bridge
+	admin   *admin.Server      // 管理端服务
+	health  *health.Registry   // 健康检查
+	tracer  *trace.Tracer      // 链路追踪
+	journal *journal.Journal   // 目标响应记录
+	plan    *schedule.Schedule // 路由的投递计划
+	delay   *schedule.Queue    // 延迟队列
+	errs    control.ErrorCounter
 	Logger  logger.Logger
 	Config  *config.Config
 }
@@ -179,8 +195,45 @@ func (app *App) Setup(ctx context.Context, module, bridge string, args []string)
 			app.Logger = log
 		}
 	}
+	app.Logger = logger.WithHooks(app.Logger, app.errs.Hook, metrics.Hook)
+	app.admin = admin.NewServer(app,
+		admin.WithLogger(app.Logger),
+		admin.WithListen(app.Config.AdminListen),
+		admin.WithSocket(app.Config.AdminSocket),
+		admin.WithToken(app.Config.AdminToken),
+	)
+	if err := app.admin.Check(); err != nil {
+		return err
+	}
+	exporter, err := trace.NewExporter(app.Config.TraceExporter, app.Config.TraceTarget)
+	if err != nil {
+		return err
+	}
+	app.tracer = trace.NewTracer(app.name, trace.WithLogger(app.Logger), trace.WithExporter(exporter))
 	app.msg = make(chan []byte, app.Config.ChannelSize)
-	if err := app.module.Setup(app, app.msg); err != nil {
+	metrics.RegisterChannel(func() int { return len(app.msg) }, cap(app.msg))
+	app.admin.Handle(http.MethodGet, "/metrics", metrics.Handler())
+	app.health = health.NewRegistry()
+	app.journal, err = journal.New(app.Config.ResponseJournal, app.Config.ResponseBodyLimit, app.Config.ResponseJournalFile)
+	if err != nil {
+		return err
+	}
+	if app.journal != nil {
+		app.admin.Handle(http.MethodGet, "/responses", app.journal.ExportHandler())
+		app.admin.Handle(http.MethodGet, "/responses/:id", app.journal.Handler())
+	}
+	app.admin.HandlePublic(http.MethodGet, "/healthz", app.health.LivenessHandler())
+	app.admin.HandlePublic(http.MethodGet, "/readyz", app.health.ReadinessHandler())
+	app.out = make(chan []byte)
+	if app.Config.Schedule != "" {
+		if app.plan, err = schedule.Load(app.Config.Schedule); err != nil {
+			return err
+		}
+	}
+	if app.delay, err = schedule.OpenQueue(app.Config.DelayPath); err != nil {
+		return err
+	}
+	if err := app.module.Setup(app, app.out); err != nil {
 		return err
 	}
 	if err := app.bridge.Setup(app, app.msg); err != nil {
@@ -193,6 +246,13 @@ func (app *App) Setup(ctx context.Context, module, bridge string, args []string)
 // ctx 用于控制应用程序的生命周期，可用来在App运行期间传递信号或取消操作
 // 返回值error表示启动过程中是否出现错误
 func (app *App) Run(ctx context.Context) error {
+	go func() {
+		// 管理端服务异常不影响搬运主流程
+		_ = app.admin.Run(ctx)
+	}()
+	go app.tracer.Run(ctx)
+	go app.deliver(ctx)
+	defer app.journal.Close()
 	signal := make(chan error)
 	go func() {
 		signal <- app.module.Run(ctx)
@@ -202,3 +262,92 @@ func (app *App) Run(ctx context.Context) error {
 	}()
 	return <-signal
 }
+
+// Admin 返回管理端服务, 用于注册额外的管理接口
+func (app *App) Admin() *admin.Server {
+	return app.admin
+}
+
+// Health 返回健康检查注册表, 组件在Setup时注册各自的检查项
+func (app *App) Health() *health.Registry {
+	return app.health
+}
+
+// Tracer 返回链路追踪器
+func (app *App) Tracer() *trace.Tracer {
+	return app.tracer
+}
+
+// Journal 返回目标响应记录, 未开启时为nil
+func (app *App) Journal() *journal.Journal {
+	return app.journal
+}
+
+// Name 返回服务名称
+func (app *App) Name() string {
+	return app.name
+}
+
+// lane 根据名称返回对应的组件: ingress => bridge, egress => module
+func (app *App) lane(name string) (any, error) {
+	switch name {
+	case control.LaneIngress:
+		return app.bridge, nil
+	case control.LaneEgress:
+		return app.module, nil
+	default:
+		return nil, control.ErrUnknownLane
+	}
+}
+
+// Status 返回应用的运行状态: 组件状态, 搬运队列深度以及按错误码统计的错误数
+func (app *App) Status() map[string]any {
+	return map[string]any{
+		"name": app.name,
+		"queue": map[string]int{
+			"len": len(app.msg),
+			"cap": cap(app.msg),
+		},
+		"delayed":           app.delayStatus(),
+		control.LaneIngress: control.StatusOf(app.bridge.GetName(), app.bridge),
+		control.LaneEgress:  control.StatusOf(app.module.GetName(), app.module),
+		"errors":            app.errs.Snapshot(),
+	}
+}
+
+// delayStatus 延迟队列的状态
+func (app *App) delayStatus() map[string]any {
+	st := map[string]any{"len": app.delay.Len()}
+	if next, ok := app.delay.Next(); ok {
+		st["next"] = next.UnixMilli()
+	}
+	return st
+}
+
+// Pause 暂停ingress或egress
+func (app *App) Pause(name string) error {
+	c, err := app.lane(name)
+	if err != nil {
+		return err
+	}
+	return control.Pause(c)
+}
+
+// Resume 恢复ingress或egress
+func (app *App) Resume(name string) error {
+	c, err := app.lane(name)
+	if err != nil {
+		return err
+	}
+	return control.Resume(c)
+}
+
+// Rotate 强制切换当前的搬运文件
+func (app *App) Rotate() error {
+	return control.Rotate(app.bridge, app.module)
+}
+
+// Rescan 立即重新扫描搬运目录
+func (app *App) Rescan() error {
+	return control.Rescan(app.bridge, app.module)
+}
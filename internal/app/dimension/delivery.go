@@ -0,0 +1,86 @@
+package dimension
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/structs"
+	"github.com/chengfeiZhou/Wormhole/pkg/logger"
+)
+
+// deliverAfterKey 报文中带有投递时间时的字段, 用于跳过不需要延迟的报文
+var deliverAfterKey = []byte(`"deliverAfter":`)
+
+// schedMeta 延迟投递需要的报文元数据
+type schedMeta struct {
+	Route        string `json:"route"`
+	DeliverAfter int64  `json:"deliverAfter"`
+}
+
+// deliver 延迟投递: 未到投递时间或不在路由投递窗口内的报文保存到延迟队列, 到期后按顺序交给发送模块
+// 其他报文直接交给发送模块
+func (app *App) deliver(ctx context.Context) {
+	go app.delay.Run(ctx, app.release, func(name string, err error) {
+		app.Logger.Error(logger.ErrorReadFile, "延迟队列的报文文件", logger.ErrorField(err), logger.MakeField("file", name))
+	})
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case data, ok := <-app.msg:
+			if !ok {
+				return
+			}
+			if due, held := app.due(data); held {
+				err := app.delay.Push(due, data)
+				if err == nil {
+					continue
+				}
+				// 保存失败时直接投递, 不丢失报文
+				app.Logger.Error(logger.ErrorWriteFile, "保存延迟投递的报文", logger.ErrorField(err),
+					logger.MakeField("id", structs.PeekID(data)))
+			}
+			select {
+			case app.out <- data:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// release 延迟队列释放到期的报文; 投递计划变化后仍不在投递窗口内的报文重新入队
+func (app *App) release(ctx context.Context, data []byte) error {
+	if due, held := app.due(data); held {
+		if err := app.delay.Push(due, data); err == nil {
+			return nil
+		}
+	}
+	select {
+	case app.out <- data:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// due 返回报文的投递时间, 晚于当前时间时held为true
+func (app *App) due(data []byte) (due time.Time, held bool) {
+	if app.plan == nil && !bytes.Contains(data, deliverAfterKey) {
+		return time.Time{}, false
+	}
+	var m schedMeta
+	if err := json.Unmarshal(data, &m); err != nil {
+		// 格式错误的报文交给发送模块处理
+		return time.Time{}, false
+	}
+	now := time.Now()
+	at := now
+	if m.DeliverAfter > now.UnixMilli() {
+		at = time.UnixMilli(m.DeliverAfter)
+	}
+	due = app.plan.Due(m.Route, at)
+	return due, due.After(now)
+}
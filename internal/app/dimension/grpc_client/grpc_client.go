@@ -0,0 +1,221 @@
+package grpcclient
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/chengfeiZhou/Wormhole/internal/app/dimension"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/control"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/health"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/metrics"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/rawgrpc"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/structs"
+	"github.com/chengfeiZhou/Wormhole/pkg/certs"
+	"github.com/chengfeiZhou/Wormhole/pkg/logger"
+	"github.com/chengfeiZhou/Wormhole/pkg/trace"
+)
+
+// nolint
+type Adapter struct {
+	control.Switch // egress暂停开关
+	log            logger.Logger
+	target         string        // 转发目标(host:port)
+	msgChan        <-chan []byte // 报文转移通道
+	conn           *grpc.ClientConn
+	creds          credentials.TransportCredentials
+	dialOptions    []grpc.DialOption // 额外的连接选项
+	timeout        time.Duration
+	seq            control.Sequence
+	tracer         *trace.Tracer
+}
+
+type OptionFunc func(*Adapter)
+
+// WithLogger 设置日志记录器
+func WithLogger(log logger.Logger) OptionFunc {
+	return func(a *Adapter) {
+		a.log = log
+	}
+}
+
+// WithTarget 设置转发目标
+func WithTarget(target string) OptionFunc {
+	return func(a *Adapter) {
+		a.target = target
+	}
+}
+
+// WithTimeout 设置单次调用的超时时间
+func WithTimeout(t time.Duration) OptionFunc {
+	return func(a *Adapter) {
+		a.timeout = t
+	}
+}
+
+// WithCredentials 设置连接目标使用的传输凭证, 默认不使用TLS
+func WithCredentials(c credentials.TransportCredentials) OptionFunc {
+	return func(a *Adapter) {
+		a.creds = c
+	}
+}
+
+// NewAdapter 创建gRPC转发模块
+func NewAdapter(msgChan <-chan []byte, ops ...OptionFunc) *Adapter {
+	ad := &Adapter{
+		log:     logger.DefaultLogger(),
+		msgChan: msgChan,
+		target:  "127.0.0.1:9091",
+		creds:   insecure.NewCredentials(),
+		timeout: 10 * time.Second,
+	}
+	for _, op := range ops {
+		op(ad)
+	}
+	return ad
+}
+
+// GetName 返回模块名称 "grpc"
+func (a *Adapter) GetName() string {
+	return "grpc"
+}
+
+// Setup 根据应用配置初始化模块
+func (a *Adapter) Setup(app *dimension.App, msgChan <-chan []byte) error {
+	a.log = app.Logger
+	a.msgChan = msgChan
+	a.tracer = app.Tracer()
+	a.target = app.Config.GRPCTarget
+	a.timeout = time.Duration(app.Config.GRPCTimeout) * time.Second
+	a.creds = insecure.NewCredentials()
+	if app.Config.GRPCCA != "" {
+		pool, err := certs.LoadPool(app.Config.GRPCCA)
+		if err != nil {
+			a.log.Error(logger.ErrorTLS, "加载gRPC目标的CA证书", logger.ErrorField(err))
+			return err
+		}
+		a.creds = credentials.NewTLS(&tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12})
+	}
+	app.Health().Readiness(a.GetName(), "target", health.Dial(a.target))
+	return nil
+}
+
+// Help 打印gRPC模块的帮助信息
+func (a *Adapter) Help() {
+	fmt.Println("grpc module help")
+	fmt.Println("  -grpcTarget  转发目标(host:port)")
+	fmt.Println("  -grpcCA      校验目标证书的CA文件, 设置后使用TLS")
+	fmt.Println("  -grpcTimeout 调用超时(s)")
+}
+
+// Transform 返回gRPC报文的解析函数
+func (a *Adapter) Transform() structs.TransMessage {
+	return structs.TransGRPCMessage
+}
+
+// Run 按顺序转发通道中的报文, ctx结束时退出
+func (a *Adapter) Run(ctx context.Context) error {
+	a.log.Info("run service for proxy client for grpc", logger.MakeField("target", a.target))
+	conn, err := grpc.NewClient(a.target, append(a.dialOptions, grpc.WithTransportCredentials(a.creds))...)
+	if err != nil {
+		a.log.Error(logger.ErrorRequestExecutor, "创建gRPC连接", logger.ErrorField(err))
+		return err
+	}
+	a.conn = conn
+	defer conn.Close()
+	for {
+		// egress暂停时不再从通道中读取报文
+		in, resumed := a.msgChan, a.Resumed()
+		if resumed != nil {
+			in = nil
+		}
+		select {
+		case <-resumed:
+			continue
+		case data, ok := <-in:
+			if !ok {
+				a.log.Info("搬运请求客户端数据无效")
+				continue
+			}
+			metrics.MessageIn(a.GetName(), control.LaneEgress, len(data))
+			dataE, err := structs.TransGRPCMessage(data)
+			if err != nil {
+				a.log.Error(logger.ErrorParam, "搬运数据类型错误,无法格式化", logger.ErrorField(err))
+				continue
+			}
+			a.seq.Next()
+			// 按顺序调用, 保证同一个流中的报文到达目标的顺序
+			a.invoke(ctx, dataE.(*structs.GRPCMessage))
+		case <-ctx.Done():
+			a.log.Info("搬运请求客户端模块执行结束")
+			return nil
+		}
+	}
+}
+
+// Status 上报gRPC转发模块的运行状态
+func (a *Adapter) Status() map[string]any {
+	st := map[string]any{
+		"target":  a.target,
+		"lastSeq": a.seq.Last(),
+	}
+	if a.conn != nil {
+		st["state"] = a.conn.GetState().String()
+	}
+	return st
+}
+
+// invoke 将报文作为一元调用发送到目标
+// payload报文调用目标的wormhole.v1.Gate/Send, 捕获的调用按原方法转发
+func (a *Adapter) invoke(ctx context.Context, msg *structs.GRPCMessage) {
+	span := a.tracer.Start("dimension.grpc.egress", trace.KindClient, msg.TraceParent)
+	defer span.End()
+	span.SetAttr("rpc.system", "grpc")
+	span.SetAttr("rpc.method", msg.Method)
+	span.SetAttr("server.address", a.target)
+	span.SetAttr("wormhole.id", msg.ID)
+	method, data := msg.Method, msg.Data
+	if msg.Kind == structs.GRPCKindPayload {
+		method = rawgrpc.MethodSend
+		data = (&rawgrpc.Payload{Data: msg.Data, Metadata: msg.Attributes}).Marshal()
+	}
+	md := outgoing(msg.Metadata)
+	// 覆盖原始调用中可能携带的traceparent, 使目标服务成为本span的子节点
+	md.Set(trace.HeaderTraceparent, span.Traceparent())
+	callCtx, cancel := context.WithTimeout(metadata.NewOutgoingContext(ctx, md), a.timeout)
+	defer cancel()
+	var reply []byte
+	err := a.conn.Invoke(callCtx, method, &data, &reply, grpc.ForceCodec(rawgrpc.Codec{}))
+	if err != nil {
+		span.SetError(err)
+		a.log.Error(logger.ErrorRequestExecutor, "调用目标错误", logger.ErrorField(err),
+			logger.MakeField("method", method), logger.MakeField("id", msg.ID))
+		return
+	}
+	metrics.MessageOut(a.GetName(), control.LaneEgress, len(data))
+	metrics.ObserveLatency(a.GetName(), msg.StargateTime)
+	a.log.Info("调用转发成功", logger.MakeField("method", method), logger.MakeField("replySize", len(reply)),
+		logger.MakeField("id", msg.ID), logger.MakeField("traceId", span.Context().TraceIDString()))
+}
+
+// outgoing 由调用方的metadata生成转发调用的metadata, 去掉由gRPC传输层维护的字段
+func outgoing(in map[string][]string) metadata.MD {
+	md := metadata.MD{}
+	for k, vs := range in {
+		k = strings.ToLower(k)
+		switch {
+		case strings.HasPrefix(k, ":"), strings.HasPrefix(k, "grpc-"),
+			k == "content-type", k == "user-agent", k == "te":
+			continue
+		}
+		md.Append(k, vs...)
+	}
+	return md
+}
@@ -0,0 +1,114 @@
+package grpcclient
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/rawgrpc"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/structs"
+	"github.com/chengfeiZhou/Wormhole/pkg/trace"
+)
+
+// call 目标收到的调用
+type call struct {
+	method string
+	data   []byte
+	md     metadata.MD
+}
+
+// target 在内存连接上启动记录所有调用的目标服务
+func target(t *testing.T) (*bufconn.Listener, <-chan call) {
+	ln := bufconn.Listen(1 << 20)
+	calls := make(chan call, 10)
+	svc := grpc.NewServer(grpc.ForceServerCodec(rawgrpc.Codec{}),
+		grpc.UnknownServiceHandler(func(_ any, stream grpc.ServerStream) error {
+			method, _ := grpc.MethodFromServerStream(stream)
+			var data []byte
+			if err := stream.RecvMsg(&data); err != nil {
+				return err
+			}
+			md, _ := metadata.FromIncomingContext(stream.Context())
+			calls <- call{method: method, data: data, md: md}
+			reply := []byte{}
+			return stream.SendMsg(&reply)
+		}))
+	go func() {
+		_ = svc.Serve(ln)
+	}()
+	t.Cleanup(svc.Stop)
+	return ln, calls
+}
+
+func next(t *testing.T, calls <-chan call) call {
+	select {
+	case c := <-calls:
+		return c
+	case <-time.After(time.Second):
+		t.Fatal("目标没有收到调用")
+		return call{}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	ln, calls := target(t)
+	msgChan := make(chan []byte, 10)
+	a := NewAdapter(msgChan, WithTarget("passthrough:///bufnet"))
+	a.dialOptions = []grpc.DialOption{grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return ln.DialContext(ctx)
+	})}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- a.Run(ctx)
+	}()
+
+	push := func(msg *structs.GRPCMessage) {
+		b, err := msg.Marshal()
+		assert.NoError(t, err)
+		msgChan <- b
+	}
+	parent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	md := map[string][]string{
+		"x-tenant":              {"t1"},
+		"content-type":          {"application/grpc"},
+		"user-agent":            {"grpc-go"},
+		"grpc-timeout":          {"1S"},
+		trace.HeaderTraceparent: {parent},
+	}
+
+	// payload报文调用目标的Send
+	push(&structs.GRPCMessage{Meta: structs.Meta{ID: "id-1", TraceParent: parent}, Kind: structs.GRPCKindPayload,
+		Method: rawgrpc.MethodSendStream, Data: []byte("hello"), Attributes: map[string]string{"k": "v"}, Metadata: md})
+	c := next(t, calls)
+	assert.Equal(t, rawgrpc.MethodSend, c.method)
+	p := new(rawgrpc.Payload)
+	assert.NoError(t, p.Unmarshal(c.data))
+	assert.Equal(t, []byte("hello"), p.Data)
+	assert.Equal(t, map[string]string{"k": "v"}, p.Metadata)
+	assert.Equal(t, []string{"t1"}, c.md.Get("x-tenant"))
+	assert.Empty(t, c.md.Get("grpc-timeout"))
+	// traceparent由转发的span替换, 保持同一条链路
+	tp := c.md.Get(trace.HeaderTraceparent)
+	assert.Len(t, tp, 1)
+	assert.NotEqual(t, parent, tp[0])
+	assert.Contains(t, tp[0], "4bf92f3577b34da6a3ce929d0e0e4736")
+
+	// 捕获的调用按原方法和原始编码重放
+	req := []byte{0x0a, 0x03, 'o', '-', '1'}
+	push(&structs.GRPCMessage{Meta: structs.Meta{ID: "id-2"}, Kind: structs.GRPCKindCall,
+		Method: "/billing.v1.Orders/Create", Data: req, Metadata: map[string][]string{"x-tenant": {"t2"}}})
+	c = next(t, calls)
+	assert.Equal(t, "/billing.v1.Orders/Create", c.method)
+	assert.Equal(t, req, c.data)
+	assert.Equal(t, []string{"t2"}, c.md.Get("x-tenant"))
+
+	cancel()
+	assert.NoError(t, <-done)
+}
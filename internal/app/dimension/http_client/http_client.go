@@ -2,22 +2,62 @@ package httpclient
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/chengfeiZhou/Wormhole/internal/app/dimension"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/blob"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/control"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/credential"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/health"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/journal"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/metrics"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/policy"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/rewrite"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/route"
 	"github.com/chengfeiZhou/Wormhole/internal/pkg/structs"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/workpool"
+	"github.com/chengfeiZhou/Wormhole/pkg/certs"
 	"github.com/chengfeiZhou/Wormhole/pkg/logger"
+	"github.com/chengfeiZhou/Wormhole/pkg/trace"
+)
+
+// 转发目标的队列满时的处理
+const (
+	QueueFullBlock  = "block"  // 暂停读取搬运通道, 所有目标都暂停
+	QueueFullReject = "reject" // 丢弃该报文, 写入日志和响应记录
 )
 
 // nolint
 type Adapter struct {
-	log     logger.Logger
-	bind    string        // 转发目标
-	msgChan <-chan []byte // 报文转移通道
-	client  *http.Client
+	control.Switch // egress暂停开关
+	log            logger.Logger
+	bind           string                         // 转发目标
+	scheme         string                         // 转发到bind使用的协议: http, https
+	msgChan        <-chan []byte                  // 报文转移通道
+	client         *http.Client                   // 转发到bind以及没有单独配置TLS的目标
+	tlsConf        *tls.Config                    // client使用的TLS配置
+	clients        map[*route.Target]*http.Client // 单独配置了TLS的目标
+	seq            control.Sequence
+	tracer         *trace.Tracer
+	routes         *route.Targets    // 路由 => 转发目标, 没有路由的请求转发到bind
+	blobDir        string            // 落盘请求体分块所在的目录(搬运目录)
+	blobWait       time.Duration     // 等待分块搬运完成的时间
+	policy         *policy.Policy    // 不为空时转发前再次检查请求
+	rewriter       *rewrite.Rewriter // 为空时只删除逐跳请求头
+	credentials    *credential.Store // 为空时不替换凭证
+	workers        int               // 同时执行的请求数上限
+	perTarget      int               // 每个转发目标同时执行的请求数上限
+	queueSize      int               // 每个转发目标排队的请求数上限
+	queueFull      string            // 目标队列满时的处理: block, reject
+	rejected       atomic.Int64      // 因目标队列满丢弃的报文数
+	pool           *workpool.Pool
+	journal        *journal.Journal // 为空时不记录目标响应
 }
 
 type OptionFunc func(*Adapter)
@@ -67,20 +107,102 @@ func WithHTTPTransport(trans *http.Transport) OptionFunc {
 	}
 }
 
+// WithScheme 设置转发到bind使用的协议: http, https
+func WithScheme(scheme string) OptionFunc {
+	return func(a *Adapter) {
+		a.scheme = scheme
+	}
+}
+
+// WithTLSConfig 设置转发到https目标使用的TLS配置, 单独配置了TLS的路由目标除外
+// 与WithHTTPTransport同时使用时以WithHTTPTransport为准
+func WithTLSConfig(conf *tls.Config) OptionFunc {
+	return func(a *Adapter) {
+		a.tlsConf = conf
+	}
+}
+
+// WithRoutes 设置路由对应的转发目标
+func WithRoutes(t *route.Targets) OptionFunc {
+	return func(a *Adapter) {
+		a.routes = t
+	}
+}
+
+// WithBlob 设置落盘请求体分块所在的目录以及等待分块搬运完成的时间
+func WithBlob(dir string, wait time.Duration) OptionFunc {
+	return func(a *Adapter) {
+		a.blobDir = dir
+		a.blobWait = wait
+	}
+}
+
+// WithPolicy 设置转发前检查的请求策略
+func WithPolicy(p *policy.Policy) OptionFunc {
+	return func(a *Adapter) {
+		a.policy = p
+	}
+}
+
+// WithRewrite 设置转发请求的重写规则
+func WithRewrite(rw *rewrite.Rewriter) OptionFunc {
+	return func(a *Adapter) {
+		a.rewriter = rw
+	}
+}
+
+// WithJournal 设置记录目标响应的Journal
+func WithJournal(j *journal.Journal) OptionFunc {
+	return func(a *Adapter) {
+		a.journal = j
+	}
+}
+
+// WithCredentials 设置转发请求的凭证替换规则
+func WithCredentials(s *credential.Store) OptionFunc {
+	return func(a *Adapter) {
+		a.credentials = s
+	}
+}
+
+// WithWorkers 设置同时执行的请求数上限, 每个转发目标的上限(0与workers相同)以及每个目标的队列长度
+func WithWorkers(workers, perTarget, queueSize int) OptionFunc {
+	return func(a *Adapter) {
+		a.workers = workers
+		a.perTarget = perTarget
+		a.queueSize = queueSize
+	}
+}
+
+// WithQueueFull 设置转发目标的队列满时的处理: block(默认), reject
+func WithQueueFull(policy string) OptionFunc {
+	return func(a *Adapter) {
+		a.queueFull = policy
+	}
+}
+
 // NewAdapter 创建一个新的 Adapter 实例
 // msgChan 是一个只读的字节切片通道，用于接收消息
 // ops 是一个可变参数列表，用于配置 Adapter 的选项
 // 返回一个指向 Adapter 实例的指针
 func NewAdapter(msgChan <-chan []byte, ops ...OptionFunc) *Adapter {
 	ad := &Adapter{
-		log:     logger.DefaultLogger(),
-		msgChan: msgChan,
-		bind:    "127.0.0.1:8080",
-		client:  http.DefaultClient,
+		log:       logger.DefaultLogger(),
+		msgChan:   msgChan,
+		bind:      "127.0.0.1:8080",
+		scheme:    "http",
+		client:    new(http.Client),
+		blobWait:  time.Minute,
+		workers:   64,
+		queueSize: 1000,
+		queueFull: QueueFullBlock,
 	}
 	for _, op := range ops {
 		op(ad)
 	}
+	if ad.client.Transport == nil {
+		ad.client.Transport = newTransport(ad.tlsConf, ad.idleConns())
+	}
 	return ad
 }
 
@@ -102,14 +224,118 @@ func (a *Adapter) GetName() string {
 func (a *Adapter) Setup(app *dimension.App, msgChan <-chan []byte) error {
 	a.log = app.Logger
 	a.bind = app.Config.Bind
+	a.scheme = app.Config.BindScheme
 	a.msgChan = msgChan
+	a.tracer = app.Tracer()
+	a.journal = app.Journal()
+	a.blobDir = app.Config.HandlingPath
+	a.blobWait = time.Duration(app.Config.BlobWait) * time.Second
+	WithWorkers(app.Config.HTTPWorkers, app.Config.HTTPWorkersPerTarget, app.Config.HTTPQueueSize)(a)
+	WithQueueFull(app.Config.HTTPQueueFull)(a)
+	if a.scheme != "http" && a.scheme != "https" {
+		err := fmt.Errorf("bindScheme可选: http, https; 当前: %s", a.scheme)
+		a.log.Error(logger.ErrorParam, "转发协议", logger.ErrorField(err))
+		return err
+	}
+	if a.queueFull != QueueFullBlock && a.queueFull != QueueFullReject {
+		err := fmt.Errorf("httpQueueFull可选: %s, %s; 当前: %s", QueueFullBlock, QueueFullReject, a.queueFull)
+		a.log.Error(logger.ErrorParam, "转发目标的队列满时的处理", logger.ErrorField(err))
+		return err
+	}
+	tlsConf, err := (&certs.ClientTLS{
+		CA:         app.Config.HTTPCA,
+		Cert:       app.Config.HTTPCert,
+		Key:        app.Config.HTTPKey,
+		ServerName: app.Config.HTTPServerName,
+		MinVersion: app.Config.HTTPMinTLS,
+	}).Config(certs.WithLogger(a.log))
+	if err != nil {
+		a.log.Error(logger.ErrorTLS, "加载https转发的TLS配置", logger.ErrorField(err))
+		return err
+	}
+	a.tlsConf = tlsConf
 	a.client = &http.Client{
 		Timeout:   time.Duration(app.Config.HttpTimeout) * time.Second,
-		Transport: http.DefaultTransport,
+		Transport: newTransport(a.tlsConf, a.idleConns()),
+	}
+	if app.Config.Policy != "" {
+		p, err := policy.Load(app.Config.Policy)
+		if err != nil {
+			a.log.Error(logger.ErrorParam, "加载请求策略", logger.ErrorField(err))
+			return err
+		}
+		a.policy = p
+	}
+	if app.Config.Rewrite != "" {
+		rw, err := rewrite.Load(app.Config.Rewrite)
+		if err != nil {
+			a.log.Error(logger.ErrorParam, "加载重写规则", logger.ErrorField(err))
+			return err
+		}
+		a.rewriter = rw
+	}
+	if app.Config.Credentials != "" {
+		s, err := credential.Load(app.Config.Credentials)
+		if err != nil {
+			a.log.Error(logger.ErrorParam, "加载凭证文件", logger.ErrorField(err))
+			return err
+		}
+		a.credentials = s
+	}
+	if app.Config.Routes != "" {
+		a.clients = make(map[*route.Target]*http.Client)
+		routes, err := route.LoadTargets(app.Config.Routes, a.transport)
+		if err != nil {
+			a.log.Error(logger.ErrorParam, "加载路由转发目标", logger.ErrorField(err))
+			return err
+		}
+		a.routes = routes
+		for name, tg := range routes.Routes {
+			app.Health().Readiness(a.GetName(), "route:"+name, readiness(tg))
+		}
+	}
+	if a.routes != nil && a.routes.Default != nil {
+		app.Health().Readiness(a.GetName(), "target", readiness(a.routes.Default))
+	} else {
+		app.Health().Readiness(a.GetName(), "target", health.Dial(a.bind))
 	}
 	return nil
 }
 
+// idleConns 每个host保留的空闲连接数, 与每个目标的并发上限一致
+func (a *Adapter) idleConns() int {
+	if a.perTarget > 0 {
+		return a.perTarget
+	}
+	return a.workers
+}
+
+// transport 转发目标使用的Transport, 主动健康检查与转发请求共用
+// 单独配置了TLS的目标创建自己的客户端, 其他目标共享a.client
+func (a *Adapter) transport(tg *route.Target) (http.RoundTripper, error) {
+	if tg.TLS == nil {
+		return a.client.Transport, nil
+	}
+	conf, err := tg.TLS.Config(certs.WithLogger(a.log))
+	if err != nil {
+		return nil, fmt.Errorf("TLS配置: %w", err)
+	}
+	c := &http.Client{
+		Timeout:   a.client.Timeout,
+		Transport: newTransport(conf, a.idleConns()),
+	}
+	a.clients[tg] = c
+	return c.Transport, nil
+}
+
+// readiness 配置了主动健康检查的目标按检查结果判断, 否则检查是否有上游可以建立连接
+func readiness(tg *route.Target) health.Check {
+	if tg.HealthCheck != nil {
+		return tg.Group().Ready
+	}
+	return health.Dial(strings.Split(tg.Addr(), ",")...)
+}
+
 // Help 是Adapter结构体上的一个方法，用于打印http模块的帮助信息
 func (a *Adapter) Help() {
 	// TODO: go模板语法
@@ -132,21 +358,39 @@ func (a *Adapter) Transform() structs.TransMessage {
 //
 //	error: 如果在Run方法执行过程中发生错误，则返回非零的错误码；否则返回nil
 func (a *Adapter) Run(ctx context.Context) error {
-	a.log.Info("run service for proxy client for http", logger.MakeField("bind", a.bind))
+	a.log.Info("run service for proxy client for http", logger.MakeField("bind", a.scheme+"://"+a.bind),
+		logger.MakeField("workers", a.workers), logger.MakeField("workersPerTarget", a.perTarget))
+	a.pool = workpool.New(ctx, a.GetName(), a.workers, a.perTarget, a.queueSize)
+	defer a.pool.Wait()
+	if a.routes != nil {
+		go a.routes.Run(ctx)
+	}
 	for {
+		// egress暂停时不再从通道中读取报文
+		in, resumed := a.msgChan, a.Resumed()
+		if resumed != nil {
+			in = nil
+		}
 		select {
-		case data, ok := <-a.msgChan:
+		case <-resumed:
+			continue
+		case data, ok := <-in:
 			if !ok {
 				a.log.Info("搬运请求客户端数据无效")
 				continue
 			}
+			metrics.MessageIn(a.GetName(), control.LaneEgress, len(data))
 			dataE, err := structs.TransHTTPMessage(data)
 			if err != nil {
 				a.log.Error(logger.ErrorParam, "搬运数据类型错误,无法格式化", logger.ErrorField(err))
 				continue
 			}
-			// TODO: 并发请求, 当前不做限制; 后期可以考虑增加并发池
-			go a.sendRequest(ctx, dataE.(*structs.HTTPMessage))
+			a.seq.Next()
+			msg := dataE.(*structs.HTTPMessage)
+			if err = a.submit(ctx, msg); err != nil {
+				a.log.Info("搬运请求客户端模块执行结束")
+				return nil
+			}
 		case <-ctx.Done():
 			a.log.Info("搬运请求客户端模块执行结束")
 			return nil
@@ -154,6 +398,78 @@ func (a *Adapter) Run(ctx context.Context) error {
 	}
 }
 
+// submit 将报文加入转发目标的队列, 返回错误时结束Run
+// block: 目标的队列满时阻塞, 不再读取搬运通道(其他目标也随之暂停); reject: 丢弃该报文并记录, 继续分发其他目标
+func (a *Adapter) submit(ctx context.Context, msg *structs.HTTPMessage) error {
+	target := a.target(msg)
+	job := func() { a.sendRequest(ctx, msg) }
+	if a.queueFull != QueueFullReject {
+		return a.pool.Submit(ctx, target, job)
+	}
+	err := a.pool.TrySubmit(target, job)
+	if !errors.Is(err, workpool.ErrQueueFull) {
+		return err
+	}
+	a.rejected.Add(1)
+	if msg.BodyRef != nil {
+		blob.Remove(a.blobDir, msg.BodyRef)
+	}
+	a.record(&journal.Entry{ID: msg.ID, Route: msg.Route, Method: msg.Method, URL: msg.URL().String(),
+		Error: err.Error(), At: time.Now().UnixMilli()})
+	a.log.Warn(logger.ErrorRequestExecutor, "转发目标的队列已满, 丢弃报文", logger.MakeField("target", target),
+		logger.MakeField("route", msg.Route), logger.MakeField("id", msg.ID))
+	return nil
+}
+
+// Status 上报http发送模块的运行状态
+func (a *Adapter) Status() map[string]any {
+	st := map[string]any{
+		"bind":    a.bind,
+		"scheme":  a.scheme,
+		"lastSeq": a.seq.Last(),
+	}
+	if a.queueFull == QueueFullReject {
+		st["rejected"] = a.rejected.Load()
+	}
+	if a.routes != nil {
+		st["routes"] = len(a.routes.Routes)
+		upstreams := make(map[string]any, len(a.routes.Routes))
+		for name, tg := range a.routes.Routes {
+			upstreams[name] = tg.Group().Status()
+		}
+		if a.routes.Default != nil {
+			upstreams[""] = a.routes.Default.Group().Status()
+		}
+		st["upstreams"] = upstreams
+	}
+	if a.pool != nil {
+		st["workers"] = a.pool.Stats()
+	}
+	return st
+}
+
+// target 返回报文的转发目标(host:port), 用于按目标限制并发
+func (a *Adapter) target(dataE *structs.HTTPMessage) string {
+	tg, err := a.lookup(dataE)
+	if err != nil || tg == nil {
+		// 找不到目标的报文在sendRequest中记录错误
+		return a.bind
+	}
+	return tg.Addr()
+}
+
+// lookup 返回报文的转发目标, 返回nil时转发到bind
+// 没有路由的报文(或未配置路由)使用默认目标; 配置了路由但找不到对应目标时返回错误
+func (a *Adapter) lookup(dataE *structs.HTTPMessage) (*route.Target, error) {
+	if a.routes == nil {
+		return nil, nil
+	}
+	if dataE.Route == "" {
+		return a.routes.Default, nil
+	}
+	return a.routes.Lookup(dataE.Route)
+}
+
 // sendRequest 是一个Adapter类型的方法，用于发送HTTP请求
 //
 // 参数：
@@ -163,31 +479,132 @@ func (a *Adapter) Run(ctx context.Context) error {
 // 返回值：
 // 无返回值，该函数为void类型
 func (a *Adapter) sendRequest(ctx context.Context, dataE *structs.HTTPMessage) {
-	req, err := dataE.MakeRequest(a.bind)
+	span := a.tracer.Start("dimension.http.egress", trace.KindClient, dataE.TraceParent)
+	defer span.End()
+	span.SetAttr("http.method", dataE.Method)
+	span.SetAttr("wormhole.route", dataE.Route)
+	span.SetAttr("wormhole.id", dataE.ID)
+	if dataE.BodyRef != nil {
+		// 落盘的请求体在转发完成后删除, 转发失败的请求不重试
+		defer blob.Remove(a.blobDir, dataE.BodyRef)
+	}
+	// 被策略拒绝或无法生成请求的报文同样记录, URL在生成请求后替换为转发地址
+	entry := &journal.Entry{ID: dataE.ID, Route: dataE.Route, Method: dataE.Method, URL: dataE.URL().String(),
+		TraceID: span.Context().TraceIDString(), At: time.Now().UnixMilli()}
+	defer a.record(entry)
+	if a.policy != nil {
+		if err := a.policy.Check(dataE); err != nil {
+			entry.Error = err.Error()
+			span.SetError(err)
+			a.log.Warn(logger.ErrorPolicyDenied, "请求被策略拒绝", logger.ErrorField(err),
+				logger.MakeField("method", dataE.Method), logger.MakeField("URL", dataE.URL().String()),
+				logger.MakeField("id", dataE.ID))
+			return
+		}
+	}
+	req, client, done, err := a.makeRequest(dataE)
 	if err != nil {
+		entry.Error = err.Error()
+		span.SetError(err)
 		a.log.Error(logger.ErrorRequestExecutor, "请求生成错误", logger.ErrorField(err),
-			logger.MakeField("method", dataE.Method), logger.MakeField("URL", dataE.URL))
+			logger.MakeField("method", dataE.Method), logger.MakeField("URL", dataE.URL().String()), logger.MakeField("route", dataE.Route),
+			logger.MakeField("id", dataE.ID))
+		return
+	}
+	a.rewriter.Apply(req, dataE.Route)
+	// 覆盖原始请求中可能携带的traceparent, 使目标服务成为本span的子节点
+	req.Header.Set(trace.HeaderTraceparent, span.Traceparent())
+	span.SetAttr("server.address", req.URL.Host)
+	entry.Method, entry.URL = req.Method, req.URL.String()
+	// 凭证在重写之后替换, 入站凭证不会转发到目标
+	if err := a.credentials.Apply(ctx, req, dataE.Route); err != nil {
+		entry.Error = err.Error()
+		done(nil)
+		span.SetError(err)
+		a.log.Error(logger.ErrorRequestExecutor, "获取目标凭证错误", logger.ErrorField(err),
+			logger.MakeField("route", dataE.Route), logger.MakeField("id", dataE.ID))
 		return
 	}
-	resp, err := a.client.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
+		entry.Error = err.Error()
+		done(err)
+		span.SetError(err)
+		metrics.HTTPEgress(0, err)
 		a.log.Error(logger.ErrorRequestExecutor, "请求目标错误", logger.ErrorField(err),
-			logger.MakeField("method", dataE.Method), logger.MakeField("URL", dataE.URL))
+			logger.MakeField("method", dataE.Method), logger.MakeField("URL", dataE.URL().String()), logger.MakeField("id", dataE.ID))
 		return
 	}
 	defer resp.Body.Close()
-	a.log.Debugf(func() string {
-		data, err := io.ReadAll(resp.Body) // 将struct转成[]byte
-		if err != nil {
-			return err.Error()
-		}
-		return string(data)
-	}())
+	if resp.StatusCode >= http.StatusInternalServerError {
+		done(fmt.Errorf("目标响应: %s", resp.Status))
+	} else {
+		done(nil)
+	}
+	metrics.HTTPEgress(resp.StatusCode, nil)
+	span.SetAttr("http.status_code", resp.StatusCode)
+	entry.Status, entry.Header = resp.StatusCode, resp.Header.Clone()
+	if resp.StatusCode == http.StatusUnauthorized {
+		a.credentials.Invalidate(dataE.Route)
+	}
+	// 开启响应记录时只保留前bodyLimit字节, 其余部分读取后丢弃
+	if err := entry.ReadBody(resp.Body, a.journal.BodyLimit()); err != nil {
+		entry.Error = err.Error()
+	}
+	a.log.Debugf("%s", entry.Body)
 	if resp.StatusCode > http.StatusBadRequest {
+		span.SetError(fmt.Errorf("目标响应: %s", resp.Status))
 		a.log.Error(logger.ErrorRequestExecutor, "请求目标错误", logger.MakeField("respStatus", resp.Status),
 			logger.MakeField("method", dataE.Method), logger.MakeField("URL", req.URL.String()))
 		return
 	}
+	metrics.MessageOut(a.GetName(), control.LaneEgress, int(req.ContentLength))
+	metrics.ObserveLatency(a.GetName(), dataE.StargateTime)
 	a.log.Info("请求转发成功", logger.MakeField("method", dataE.Method), logger.MakeField("URL", req.URL.String()),
-		logger.MakeField("respStatus", resp.Status))
+		logger.MakeField("respStatus", resp.Status), logger.MakeField("traceId", span.Context().TraceIDString()))
+}
+
+// record 记录目标响应, 记录写入文件失败不影响转发
+func (a *Adapter) record(entry *journal.Entry) {
+	entry.Duration = time.Now().UnixMilli() - entry.At
+	if err := a.journal.Add(entry); err != nil {
+		a.log.Warn(logger.ErrorWriteFile, "写入响应记录", logger.ErrorField(err), logger.MakeField("id", entry.ID))
+	}
+}
+
+// makeRequest 根据报文的路由生成转发请求以及发送请求使用的客户端, done用于上报上游的请求结果(请求发出后必须调用)
+// 没有路由的报文(或未配置路由)转发到默认目标或bind; 配置了路由但找不到对应目标时返回错误
+func (a *Adapter) makeRequest(dataE *structs.HTTPMessage) (
+	req *http.Request, client *http.Client, done func(error), err error) {
+	tg, err := a.lookup(dataE)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	client = a.client
+	if tg == nil {
+		u := dataE.URL()
+		u.Scheme, u.Host, u.Fragment = a.scheme, a.bind, ""
+		req, err = dataE.MakeRequestTo(u)
+		done = func(error) {}
+	} else {
+		if c, ok := a.clients[tg]; ok {
+			client = c
+		}
+		m := tg.Pick(dataE.Header, dataE.Path)
+		req, err = dataE.MakeRequestTo(tg.ResolveOn(m, dataE.URL()))
+		done = func(err error) { tg.Done(m, err) }
+		if err != nil {
+			done(nil)
+		}
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if ref := dataE.BodyRef; ref != nil {
+		// 从落盘的分块中流式读取请求体
+		req.Body = blob.Open(a.blobDir, ref, a.blobWait)
+		req.ContentLength = ref.Size
+		req.GetBody = nil
+	}
+	return req, client, done, nil
 }
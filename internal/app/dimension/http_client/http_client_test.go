@@ -0,0 +1,151 @@
+package httpclient
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/journal"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/policy"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/route"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/structs"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	file := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(file, []byte(content), 0o600))
+	return file
+}
+
+func TestJournal(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("created"))
+	}))
+	defer target.Close()
+	u, _ := url.Parse(target.URL)
+	pol, err := policy.Load(writeFile(t, "policy.json", `{"rules": [{"path": "/api/**"}]}`))
+	assert.NoError(t, err)
+	routes, err := route.LoadTargets(writeFile(t, "routes.json", `{"routes": {"api": {"url": "`+target.URL+`"}}}`), nil)
+	assert.NoError(t, err)
+	j, err := journal.New(10, 1024, "")
+	assert.NoError(t, err)
+	a := NewAdapter(nil, WithPolicy(pol), WithRoutes(routes), WithJournal(j))
+
+	send := func(id, route, path string) journal.Entry {
+		a.sendRequest(context.Background(), &structs.HTTPMessage{
+			Meta:   structs.Meta{ID: id, Route: route},
+			Method: http.MethodPost, Scheme: "http", Host: "gw", Path: path, Header: http.Header{},
+		})
+		e, err := j.Lookup(id)
+		assert.NoError(t, err, id)
+		return e
+	}
+
+	e := send("ok", "api", "/api/orders")
+	assert.Equal(t, http.StatusCreated, e.Status)
+	assert.Equal(t, "created", e.Body)
+	assert.Equal(t, "http://"+u.Host+"/api/orders", e.URL)
+
+	// 被策略拒绝, 找不到转发目标的报文同样记录
+	e = send("denied", "api", "/admin")
+	assert.Zero(t, e.Status)
+	assert.Contains(t, e.Error, "default")
+	assert.Equal(t, "http://gw/admin", e.URL)
+	e = send("noroute", "unknown", "/api/orders")
+	assert.Zero(t, e.Status)
+	assert.NotEmpty(t, e.Error)
+	assert.Equal(t, http.MethodPost, e.Method)
+}
+
+func TestHealthCheckTLS(t *testing.T) {
+	var probes atomic.Int32
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" {
+			probes.Add(1)
+		}
+	}))
+	defer target.Close()
+	ca := writeFile(t, "ca.pem", string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: target.Certificate().Raw})))
+	check := `"healthCheck": {"path": "/healthz", "healthy": 1, "unhealthy": 1}`
+	a := NewAdapter(nil)
+	a.clients = make(map[*route.Target]*http.Client)
+	routes, err := route.LoadTargets(writeFile(t, "routes.json", `{"routes": {
+		"private": {"url": "`+target.URL+`", `+check+`, "tls": {"ca": "`+ca+`"}},
+		"system": {"url": "`+target.URL+`", `+check+`}
+	}}`), a.transport)
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go routes.Run(ctx)
+
+	// 主动健康检查使用目标的TLS配置, 系统CA不信任该上游
+	private, _ := routes.Lookup("private")
+	system, _ := routes.Lookup("system")
+	assert.Eventually(t, func() bool {
+		return probes.Load() > 0 && system.Group().Ready(ctx) != nil
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.NoError(t, private.Group().Ready(ctx))
+	assert.True(t, private.Group().Status()[0].Healthy)
+}
+
+func TestQueueFullReject(t *testing.T) {
+	block, entered := make(chan struct{}), make(chan struct{}, 10)
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-block
+	}))
+	defer slow.Close()
+	defer close(block)
+	served := make(chan string, 10)
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served <- r.URL.Path
+	}))
+	defer fast.Close()
+	routes, err := route.LoadTargets(writeFile(t, "routes.json", `{"routes": {
+		"slow": {"url": "`+slow.URL+`"}, "fast": {"url": "`+fast.URL+`"}
+	}}`), nil)
+	assert.NoError(t, err)
+	j, err := journal.New(10, 1024, "")
+	assert.NoError(t, err)
+	msgChan := make(chan []byte, 10)
+	a := NewAdapter(msgChan, WithRoutes(routes), WithJournal(j), WithWorkers(2, 1, 1), WithQueueFull(QueueFullReject))
+	push := func(id, route string) {
+		b, err := (&structs.HTTPMessage{Meta: structs.Meta{ID: id, Route: route},
+			Method: http.MethodGet, Scheme: "http", Host: "gw", Path: "/" + id, Header: http.Header{}}).Marshal()
+		assert.NoError(t, err)
+		msgChan <- b
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = a.Run(ctx)
+	}()
+
+	// slow: 1个执行中, 1个排队, 第3个丢弃; 不影响fast
+	push("s1", "slow")
+	<-entered
+	push("s2", "slow")
+	push("s3", "slow")
+	push("f1", "fast")
+	select {
+	case p := <-served:
+		assert.Equal(t, "/f1", p)
+	case <-time.After(time.Second):
+		t.Fatal("fast没有收到请求")
+	}
+	e, err := j.Lookup("s3")
+	assert.NoError(t, err)
+	assert.Zero(t, e.Status)
+	assert.Contains(t, e.Error, "队列已满")
+	assert.Equal(t, int64(1), a.rejected.Load())
+}
@@ -3,24 +3,54 @@ package kafkaproducer
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/IBM/sarama"
 	"github.com/chengfeiZhou/Wormhole/internal/app/dimension"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/control"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/health"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/metrics"
 	"github.com/chengfeiZhou/Wormhole/internal/pkg/structs"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/topicmap"
 	"github.com/chengfeiZhou/Wormhole/pkg/amqp/kafka"
 	"github.com/chengfeiZhou/Wormhole/pkg/logger"
+	"github.com/chengfeiZhou/Wormhole/pkg/trace"
 )
 
 // nolint
 type Adapter struct {
-	log     logger.Logger
-	msgChan <-chan []byte // 报文转移通道
-	prod    *kafka.Producer
-	Addrs   []string
+	control.Switch // egress暂停开关
+	log            logger.Logger
+	msgChan        <-chan []byte // 报文转移通道
+	prod           *kafka.Producer
+	Addrs          []string
+	seq            control.Sequence
+	tracer         *trace.Tracer
+	partitioner    string          // 默认分区策略
+	provenance     bool            // 写入来源消息头
+	topics         *topicmap.Table // 目标topic映射, 为空时生产到源topic
+	dropped        atomic.Int64    // 按映射规则丢弃的消息数
 }
 
 type OptionFunc func(*Adapter)
 
+// WithTopicMap 按映射表决定目标topic
+func WithTopicMap(t *topicmap.Table) OptionFunc {
+	return func(a *Adapter) {
+		a.topics = t
+	}
+}
+
+// WithProvenance 生产的消息带有来源消息头(集群, topic, 分区, offset)
+func WithProvenance(on bool) OptionFunc {
+	return func(a *Adapter) {
+		a.provenance = on
+	}
+}
+
 func NewAdapter(addrs []string, msgChan <-chan []byte, ops ...OptionFunc) *Adapter {
 	ad := &Adapter{
 		log:     logger.DefaultLogger(),
@@ -45,15 +75,26 @@ func (ad *Adapter) Setup(app *dimension.App, msgChan <-chan []byte) error {
 	var err error
 	ad.log = app.Logger
 	ad.msgChan = msgChan
+	ad.tracer = app.Tracer()
 
 	conf := app.Config
 	kafkaOps := []kafka.OptionFunc{
 		kafka.WithLogger(ad.log),
+		kafka.ProducerWithPartitioner(conf.KafkaPartitioner),
 	}
 	if conf.KafkaUser != "" && conf.KafkaPasswd != "" {
 		kafkaOps = append(kafkaOps, kafka.WitchBaseAuth(conf.KafkaUser, conf.KafkaPasswd, sarama.SASLMechanism(conf.KafkaMechanism)))
 	}
 	ad.Addrs = conf.KafkaAddrs
+	ad.partitioner = conf.KafkaPartitioner
+	ad.provenance = conf.KafkaProvenance
+	if conf.KafkaTopicMap != "" {
+		if ad.topics, err = topicmap.Load(conf.KafkaTopicMap); err != nil {
+			ad.log.Error(logger.ErrorParam, "加载topic映射", logger.ErrorField(err))
+			return err
+		}
+	}
+	app.Health().Readiness(ad.GetName(), "broker", health.Dial(ad.Addrs...))
 	ad.prod, err = kafka.NewProducer(conf.KafkaAddrs, kafkaOps...)
 	if err != nil {
 		ad.log.Error(logger.ErrorKafkaProducer, "create kafka producer", logger.ErrorField(err))
@@ -62,13 +103,29 @@ func (ad *Adapter) Setup(app *dimension.App, msgChan <-chan []byte) error {
 	return nil
 }
 func (ad *Adapter) Help() {
-	// TODO: go模板语法
 	fmt.Println("kafka producer module help")
+	fmt.Println("  -kafkaAddrs       目标kafka地址('host1:9092,host2:9092')")
+	fmt.Println("  -kafkaTopicMap    topic映射文件(JSON), 为空时生产到源topic")
+	fmt.Println("  -kafkaPartitioner 默认分区策略(hash, source, roundrobin, random)")
+	fmt.Println("  -kafkaProvenance  写入来源消息头")
+	fmt.Println("  -kafkaUser        鉴权用户名")
+	fmt.Println("  -kafkaPasswd      鉴权密码")
+	fmt.Println("  -kafkaMechanism   鉴权的加密算法")
 }
 func (ad *Adapter) Transform() structs.TransMessage {
 	return structs.TransKafkaMessage
 }
 
+// Status 上报kafka生产模块的运行状态
+func (ad *Adapter) Status() map[string]any {
+	return map[string]any{
+		"addrs":       ad.Addrs,
+		"lastSeq":     ad.seq.Last(),
+		"dropped":     ad.dropped.Load(),
+		"partitioner": ad.partitioner,
+	}
+}
+
 // Run 执行监听服务
 func (ad *Adapter) Run(ctx context.Context) error {
 	ad.log.Info("run service for proxy client for kafka", logger.MakeField("kafka", ad.Addrs))
@@ -79,23 +136,54 @@ func (ad *Adapter) Run(ctx context.Context) error {
 		signal <- struct{}{}
 	}()
 	for {
+		// egress暂停时不再从通道中读取报文
+		in, resumed := ad.msgChan, ad.Resumed()
+		if resumed != nil {
+			in = nil
+		}
 		select {
-		case data, ok := <-ad.msgChan:
+		case <-resumed:
+			continue
+		case data, ok := <-in:
 			if !ok {
 				continue
 			}
+			metrics.MessageIn(ad.GetName(), control.LaneEgress, len(data))
 			dataMsg, err := structs.TransKafkaMessage(data)
 			if err != nil {
 				ad.log.Error(logger.ErrorParam, "搬运数据类型错误", logger.ErrorField(err))
 				continue
 			}
 			dataM := dataMsg.(*structs.KafkaMessage)
-			ad.log.Info("kafka数据写入", logger.MakeField(dataM.Topic, dataM.Key), logger.MakeField("timestamp", dataM.Timestamp))
-			asyncSendChan <- &kafka.Msg{
-				Topic: dataM.Topic,
-				Key:   dataM.Key,
-				Value: dataM.Value,
+			dest := ad.topics.Resolve(dataM)
+			if dest.Drop {
+				ad.dropped.Add(1)
+				ad.log.Debugf("按topic映射规则[%s]丢弃: %s", dest.Rule, dataM.Topic)
+				continue
+			}
+			ad.log.Info("kafka数据写入", logger.MakeField("seq", ad.seq.Next()), logger.MakeField("topic", dest.Topic), logger.MakeField("key", dataM.Key),
+				logger.MakeField("timestamp", dataM.Timestamp))
+			span := ad.tracer.Start("dimension.kafka.produce", trace.KindProducer, dataM.TraceParent)
+			span.SetAttr("messaging.system", "kafka")
+			span.SetAttr("messaging.destination.name", dest.Topic)
+			msg := &kafka.Msg{
+				Topic:       dest.Topic,
+				Key:         string(dataM.KeyBytes()),
+				Value:       dataM.Value,
+				Headers:     ad.headers(dataM, span.Traceparent()),
+				Partitioner: dest.Partitioner,
+				Partition:   -1,
+			}
+			if dataM.Partition != nil {
+				msg.Partition = *dataM.Partition
 			}
+			if dataM.Timestamp > 0 {
+				msg.Timestamp = time.UnixMilli(dataM.Timestamp)
+			}
+			asyncSendChan <- msg
+			span.End()
+			metrics.MessageOut(ad.GetName(), control.LaneEgress, len(dataM.Value))
+			metrics.ObserveLatency(ad.GetName(), dataM.StargateTime)
 		case <-signal:
 			ad.log.Info("kafka异步生产者退出")
 			return nil
@@ -105,3 +193,30 @@ func (ad *Adapter) Run(ctx context.Context) error {
 		}
 	}
 }
+
+// headers 源消息的消息头, traceparent替换为次元的链路; 开启provenance时追加来源消息头
+func (ad *Adapter) headers(m *structs.KafkaMessage, traceparent string) []kafka.Header {
+	hs := make([]kafka.Header, 0, len(m.Headers)+5)
+	for _, h := range m.Headers {
+		if strings.EqualFold(h.Key, trace.HeaderTraceparent) {
+			continue
+		}
+		hs = append(hs, kafka.Header{Key: h.Key, Value: h.Value})
+	}
+	hs = append(hs, kafka.Header{Key: trace.HeaderTraceparent, Value: []byte(traceparent)})
+	if !ad.provenance {
+		return hs
+	}
+	hs = append(hs,
+		kafka.Header{Key: structs.HeaderSourceCluster, Value: []byte(m.Cluster)},
+		kafka.Header{Key: structs.HeaderSourceTopic, Value: []byte(m.Topic)},
+	)
+	// 旧版本的搬运记录没有源分区和offset
+	if m.Partition != nil {
+		hs = append(hs, kafka.Header{Key: structs.HeaderSourcePartition, Value: []byte(strconv.FormatInt(int64(*m.Partition), 10))})
+	}
+	if m.Offset != nil {
+		hs = append(hs, kafka.Header{Key: structs.HeaderSourceOffset, Value: []byte(strconv.FormatInt(*m.Offset, 10))})
+	}
+	return hs
+}
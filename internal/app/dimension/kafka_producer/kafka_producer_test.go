@@ -0,0 +1,46 @@
+package kafkaproducer
+
+import (
+	"testing"
+
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/structs"
+	"github.com/chengfeiZhou/Wormhole/pkg/amqp/kafka"
+	"github.com/chengfeiZhou/Wormhole/pkg/trace"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeaders(t *testing.T) {
+	partition, offset := int32(2), int64(7)
+	m := &structs.KafkaMessage{
+		Cluster:   "outer",
+		Topic:     "orders",
+		Partition: &partition,
+		Offset:    &offset,
+		Headers: []structs.KafkaHeader{
+			{Key: "tenant", Value: []byte("a")},
+			{Key: "Traceparent", Value: []byte("00-old")},
+		},
+	}
+	ad := &Adapter{}
+	assert.Equal(t, []kafka.Header{
+		{Key: "tenant", Value: []byte("a")},
+		{Key: trace.HeaderTraceparent, Value: []byte("00-new")},
+	}, ad.headers(m, "00-new"))
+
+	ad = &Adapter{provenance: true}
+	hs := ad.headers(m, "00-new")
+	assert.Equal(t, []kafka.Header{
+		{Key: structs.HeaderSourceCluster, Value: []byte("outer")},
+		{Key: structs.HeaderSourceTopic, Value: []byte("orders")},
+		{Key: structs.HeaderSourcePartition, Value: []byte("2")},
+		{Key: structs.HeaderSourceOffset, Value: []byte("7")},
+	}, hs[2:])
+
+	// 旧版本的搬运记录没有源分区和offset
+	m.Partition, m.Offset = nil, nil
+	hs = ad.headers(m, "00-new")
+	assert.Equal(t, []kafka.Header{
+		{Key: structs.HeaderSourceCluster, Value: []byte("outer")},
+		{Key: structs.HeaderSourceTopic, Value: []byte("orders")},
+	}, hs[2:])
+}
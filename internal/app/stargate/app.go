@@ -3,9 +3,16 @@ package stargate
 import (
 	"context"
 	"fmt"
+	"net/http"
 
 	config "github.com/chengfeiZhou/Wormhole/configs/stargate"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/admin"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/control"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/health"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/metrics"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/tracking"
 	"github.com/chengfeiZhou/Wormhole/pkg/logger"
+	"github.com/chengfeiZhou/Wormhole/pkg/trace"
 )
 
 // Module 接口定义了Stargate模块的接口。
@@ -33,6 +40,11 @@ type App struct {
 	bridges map[string]Bridge // 注册的 Bridge
 	module  Module            // 被实例化的Module
 	bridge  Bridge            // 被实例化的Bridge
+	admin   *admin.Server     // 管理端服务
+	health  *health.Registry  // 健康检查
+	tracer  *trace.Tracer     // 链路追踪
+	tracker *tracking.Tracker // 报文搬运状态
+	errs    control.ErrorCounter
 	Logger  logger.Logger
 	Config  *config.Config
 }
@@ -174,7 +186,29 @@ func (app *App) Setup(ctx context.Context, module, bridge string, args []string)
 			app.Logger = log
 		}
 	}
+	app.Logger = logger.WithHooks(app.Logger, app.errs.Hook, metrics.Hook)
+	app.admin = admin.NewServer(app,
+		admin.WithLogger(app.Logger),
+		admin.WithListen(app.Config.AdminListen),
+		admin.WithSocket(app.Config.AdminSocket),
+		admin.WithToken(app.Config.AdminToken),
+	)
+	if err := app.admin.Check(); err != nil {
+		return err
+	}
+	exporter, err := trace.NewExporter(app.Config.TraceExporter, app.Config.TraceTarget)
+	if err != nil {
+		return err
+	}
+	app.tracer = trace.NewTracer(app.name, trace.WithLogger(app.Logger), trace.WithExporter(exporter))
 	app.msg = make(chan []byte, app.Config.ChannelSize)
+	metrics.RegisterChannel(func() int { return len(app.msg) }, cap(app.msg))
+	app.admin.Handle(http.MethodGet, "/metrics", metrics.Handler())
+	app.tracker = tracking.NewTracker(app.Config.TrackingSize)
+	app.admin.Handle(http.MethodGet, "/messages/:id", app.tracker.Handler())
+	app.health = health.NewRegistry()
+	app.admin.HandlePublic(http.MethodGet, "/healthz", app.health.LivenessHandler())
+	app.admin.HandlePublic(http.MethodGet, "/readyz", app.health.ReadinessHandler())
 	if err := app.module.Setup(app, app.msg); err != nil {
 		return err
 	}
@@ -189,6 +223,11 @@ func (app *App) Setup(ctx context.Context, module, bridge string, args []string)
 // 如果bridge或module中的任何一个返回错误，该错误将被返回
 // 否则，将返回nil
 func (app *App) Run(ctx context.Context) error {
+	go func() {
+		// 管理端服务异常不影响搬运主流程
+		_ = app.admin.Run(ctx)
+	}()
+	go app.tracer.Run(ctx)
 	signal := make(chan error)
 	go func() {
 		signal <- app.bridge.Run(ctx)
@@ -199,3 +238,82 @@ func (app *App) Run(ctx context.Context) error {
 	}()
 	return <-signal
 }
+
+// Admin 返回管理端服务, 用于注册额外的管理接口
+func (app *App) Admin() *admin.Server {
+	return app.admin
+}
+
+// Health 返回健康检查注册表, 组件在Setup时注册各自的检查项
+func (app *App) Health() *health.Registry {
+	return app.health
+}
+
+// Tracer 返回链路追踪器
+func (app *App) Tracer() *trace.Tracer {
+	return app.tracer
+}
+
+// Tracker 返回报文搬运状态记录
+func (app *App) Tracker() *tracking.Tracker {
+	return app.tracker
+}
+
+// Name 返回服务名称
+func (app *App) Name() string {
+	return app.name
+}
+
+// lane 根据名称返回对应的组件: ingress => module, egress => bridge
+func (app *App) lane(name string) (any, error) {
+	switch name {
+	case control.LaneIngress:
+		return app.module, nil
+	case control.LaneEgress:
+		return app.bridge, nil
+	default:
+		return nil, control.ErrUnknownLane
+	}
+}
+
+// Status 返回应用的运行状态: 组件状态, 搬运队列深度以及按错误码统计的错误数
+func (app *App) Status() map[string]any {
+	return map[string]any{
+		"name": app.name,
+		"queue": map[string]int{
+			"len": len(app.msg),
+			"cap": cap(app.msg),
+		},
+		control.LaneIngress: control.StatusOf(app.module.GetName(), app.module),
+		control.LaneEgress:  control.StatusOf(app.bridge.GetName(), app.bridge),
+		"errors":            app.errs.Snapshot(),
+	}
+}
+
+// Pause 暂停ingress或egress
+func (app *App) Pause(name string) error {
+	c, err := app.lane(name)
+	if err != nil {
+		return err
+	}
+	return control.Pause(c)
+}
+
+// Resume 恢复ingress或egress
+func (app *App) Resume(name string) error {
+	c, err := app.lane(name)
+	if err != nil {
+		return err
+	}
+	return control.Resume(c)
+}
+
+// Rotate 强制切换当前的搬运文件
+func (app *App) Rotate() error {
+	return control.Rotate(app.bridge, app.module)
+}
+
+// Rescan 立即重新扫描搬运目录
+func (app *App) Rescan() error {
+	return control.Rescan(app.bridge, app.module)
+}
@@ -0,0 +1,359 @@
+package grpcserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/chengfeiZhou/Wormhole/internal/app/stargate"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/auth"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/control"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/metrics"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/rawgrpc"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/structs"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/tracking"
+	"github.com/chengfeiZhou/Wormhole/pkg/certs"
+	"github.com/chengfeiZhou/Wormhole/pkg/logger"
+	"github.com/chengfeiZhou/Wormhole/pkg/trace"
+)
+
+// metadataID 返回给调用方的报文ID(响应header)
+const metadataID = "x-wormhole-id"
+
+// nolint
+type Adapter struct {
+	control.Switch // 暂停时拒绝调用
+	log            logger.Logger
+	listen         string
+	msgChan        chan<- []byte // 报文转移通道
+	seq            control.Sequence
+	bound          atomic.Bool // 是否已经完成端口监听
+	tracer         *trace.Tracer
+	tracker        *tracking.Tracker
+	certs          *certs.Reloader     // 不为空时启用TLS
+	authn          auth.Chain          // 不为空时校验调用方
+	services       map[string]struct{} // 捕获一元调用的服务, 包含*时捕获所有服务
+	maxMsgSize     int                 // 单条消息上限, <=0使用gRPC默认值(4MB)
+}
+
+type OptionFunc func(*Adapter)
+
+// WithLogger 设置日志记录器
+func WithLogger(log logger.Logger) OptionFunc {
+	return func(a *Adapter) {
+		a.log = log
+	}
+}
+
+// WithListen 设置监听地址
+func WithListen(listen string) OptionFunc {
+	return func(a *Adapter) {
+		a.listen = listen
+	}
+}
+
+// WithTLS 启用TLS, certs负责证书的加载和热更新
+func WithTLS(r *certs.Reloader) OptionFunc {
+	return func(a *Adapter) {
+		a.certs = r
+	}
+}
+
+// WithAuth 设置调用方认证
+func WithAuth(c auth.Chain) OptionFunc {
+	return func(a *Adapter) {
+		a.authn = c
+	}
+}
+
+// WithServices 设置捕获一元调用的服务(package.Service), *表示所有服务
+func WithServices(services ...string) OptionFunc {
+	return func(a *Adapter) {
+		for _, s := range services {
+			if s = strings.TrimSpace(s); s != "" {
+				a.services[s] = struct{}{}
+			}
+		}
+	}
+}
+
+// NewAdapter 创建gRPC接收模块
+func NewAdapter(msgChan chan<- []byte, ops ...OptionFunc) *Adapter {
+	ad := &Adapter{
+		log:      logger.DefaultLogger(),
+		msgChan:  msgChan,
+		listen:   "0.0.0.0:9090",
+		services: make(map[string]struct{}),
+	}
+	for _, op := range ops {
+		op(ad)
+	}
+	return ad
+}
+
+// GetName 返回模块名称 "grpc"
+func (a *Adapter) GetName() string {
+	return "grpc"
+}
+
+// Setup 根据应用配置初始化模块
+func (a *Adapter) Setup(app *stargate.App, msgChan chan<- []byte) error {
+	a.msgChan = msgChan
+	a.log = app.Logger
+	a.listen = app.Config.GRPCListen
+	a.tracer = app.Tracer()
+	a.tracker = app.Tracker()
+	a.maxMsgSize = int(app.Config.MaxBodySize)
+	if a.services == nil {
+		a.services = make(map[string]struct{})
+	}
+	WithServices(app.Config.GRPCServices...)(a)
+	if conf := app.Config; conf.TLSCert != "" {
+		ops := []certs.OptionFunc{certs.WithLogger(a.log)}
+		if conf.TLSClientCA != "" {
+			ops = append(ops, certs.WithClientCA(conf.TLSClientCA, conf.TLSClientAuth))
+		}
+		r, err := certs.NewReloader(conf.TLSCert, conf.TLSKey, ops...)
+		if err != nil {
+			a.log.Error(logger.ErrorTLS, "加载TLS证书", logger.ErrorField(err))
+			return err
+		}
+		a.certs = r
+	}
+	authn, err := auth.NewChain(auth.Options{
+		APIKeys:     app.Config.AuthAPIKeys,
+		HMACKeys:    app.Config.AuthHMACKeys,
+		HMACWindow:  time.Duration(app.Config.AuthHMACWindow) * time.Second,
+		JWKS:        app.Config.AuthJWKS,
+		JWTIssuer:   app.Config.AuthJWTIssuer,
+		JWTAudience: app.Config.AuthJWTAudience,
+	})
+	if err != nil {
+		a.log.Error(logger.ErrorAuthFailed, "加载认证配置", logger.ErrorField(err))
+		return err
+	}
+	a.authn = authn
+	if !a.authn.Enabled() {
+		a.log.Warn(logger.ErrorAuthFailed, "gRPC接收模块未启用调用方认证")
+	}
+	app.Health().Liveness(a.GetName(), "listener", a.checkListener)
+	return nil
+}
+
+// Help 打印gRPC模块的帮助信息
+func (a *Adapter) Help() {
+	fmt.Println("grpc module help")
+	fmt.Printf("  通用接收服务: %s (Send, SendStream), 定义见 api/proto/wormhole/v1/gate.proto\n", rawgrpc.GateService)
+	fmt.Println("  -grpcListen   监听地址")
+	fmt.Println("  -grpcServices 捕获一元调用的服务('billing.v1.Orders,report.v1.Daily'), *表示所有服务")
+}
+
+// Run 启动gRPC服务, ctx结束时优雅退出
+func (a *Adapter) Run(ctx context.Context) error {
+	a.log.Info("run service for grpc", logger.MakeField("listen", a.listen))
+	svc := a.newServer()
+	ln, err := net.Listen("tcp", a.listen)
+	if err != nil {
+		a.log.Error(logger.ErrorHTTPHandle, "gRPC服务监听", logger.ErrorField(err))
+		return err
+	}
+	a.bound.Store(true)
+	defer a.bound.Store(false)
+	go func() {
+		<-ctx.Done()
+		svc.GracefulStop()
+	}()
+	if err := svc.Serve(ln); err != nil {
+		a.log.Error(logger.ErrorHTTPHandle, "gRPC服务", logger.ErrorField(err))
+		return err
+	}
+	return nil
+}
+
+// newServer 创建gRPC服务, 所有调用都由handle处理
+func (a *Adapter) newServer() *grpc.Server {
+	ops := []grpc.ServerOption{
+		grpc.ForceServerCodec(rawgrpc.Codec{}),
+		grpc.UnknownServiceHandler(a.handle),
+	}
+	if a.maxMsgSize > 0 {
+		ops = append(ops, grpc.MaxRecvMsgSize(a.maxMsgSize))
+	}
+	if a.certs != nil {
+		ops = append(ops, grpc.Creds(credentials.NewTLS(a.certs.ServerConfig())))
+	}
+	return grpc.NewServer(ops...)
+}
+
+// handle 处理所有的gRPC调用: 通用接收服务以及被捕获服务的一元调用
+func (a *Adapter) handle(_ any, stream grpc.ServerStream) error {
+	if a.Paused() {
+		return status.Error(codes.Unavailable, "请求转发已暂停")
+	}
+	method, _ := grpc.MethodFromServerStream(stream)
+	switch method {
+	case rawgrpc.MethodSend:
+		return a.handleSend(stream, method, false)
+	case rawgrpc.MethodSendStream:
+		return a.handleSend(stream, method, true)
+	}
+	if !a.captured(method) {
+		return status.Errorf(codes.Unimplemented, "未开放的方法: %s", method)
+	}
+	var data []byte
+	if err := stream.RecvMsg(&data); err != nil {
+		return err
+	}
+	msg := &structs.GRPCMessage{Kind: structs.GRPCKindCall, Method: method, Data: data}
+	id, err := a.accept(stream.Context(), msg)
+	if err != nil {
+		return err
+	}
+	_ = stream.SetHeader(metadata.Pairs(metadataID, id))
+	// 空消息是任意protobuf消息的默认值
+	empty := []byte{}
+	return stream.SendMsg(&empty)
+}
+
+// handleSend 处理wormhole.v1.Gate的Send和SendStream
+func (a *Adapter) handleSend(stream grpc.ServerStream, method string, streaming bool) error {
+	reply := new(rawgrpc.SendReply)
+	for {
+		var data []byte
+		err := stream.RecvMsg(&data)
+		if errors.Is(err, io.EOF) && streaming {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		p := new(rawgrpc.Payload)
+		if err := p.Unmarshal(data); err != nil {
+			return status.Errorf(codes.InvalidArgument, "Payload解析失败: %s", err)
+		}
+		msg := &structs.GRPCMessage{Kind: structs.GRPCKindPayload, Method: method, Data: p.Data, Attributes: p.Metadata}
+		id, err := a.accept(stream.Context(), msg)
+		if err != nil {
+			return err
+		}
+		reply.IDs = append(reply.IDs, id)
+		if !streaming {
+			break
+		}
+	}
+	_ = stream.SetHeader(metadata.MD{metadataID: reply.IDs})
+	b := reply.Marshal()
+	return stream.SendMsg(&b)
+}
+
+// accept 认证调用方, 补全报文信息并写入搬运通道, 返回报文ID
+func (a *Adapter) accept(ctx context.Context, msg *structs.GRPCMessage) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	span := a.tracer.Start("stargate.grpc.ingress", trace.KindServer, first(md, trace.HeaderTraceparent))
+	defer span.End()
+	span.SetAttr("rpc.system", "grpc")
+	span.SetAttr("rpc.method", msg.Method)
+	metrics.MessageIn(a.GetName(), control.LaneIngress, len(msg.Data))
+	if p, ok := peer.FromContext(ctx); ok {
+		msg.RemoteAddr = p.Addr.String()
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			msg.ClientIdentity = structs.VerifiedClientIdentity(&info.State)
+		}
+	}
+	header := http.Header{}
+	for k, vs := range md {
+		for _, v := range vs {
+			header.Add(k, v)
+		}
+	}
+	if a.authn.Enabled() {
+		sum := sha256.Sum256(msg.Data)
+		r := &http.Request{Method: http.MethodPost, URL: &url.URL{Path: msg.Method}, Header: header, RemoteAddr: msg.RemoteAddr}
+		principal, err := a.authn.Authenticate(r, sum[:])
+		if err != nil {
+			span.SetError(err)
+			a.log.Warn(logger.ErrorAuthFailed, "调用方认证失败", logger.ErrorField(err),
+				logger.MakeField("remote", msg.RemoteAddr), logger.MakeField("method", msg.Method))
+			return "", status.Error(codes.Unauthenticated, "未授权的请求")
+		}
+		a.authn.Strip(header)
+		msg.Principal = principal
+		span.SetAttr("enduser.id", principal.Subject)
+	}
+	msg.Metadata = make(map[string][]string, len(header))
+	for k, vs := range header {
+		msg.Metadata[strings.ToLower(k)] = vs
+	}
+	msg.ID = tracking.NewID()
+	msg.StargateTime = time.Now().UnixMilli()
+	msg.TraceParent = span.Traceparent()
+	span.SetAttr("wormhole.id", msg.ID)
+	msgB, err := msg.Marshal()
+	if err != nil {
+		span.SetError(err)
+		return "", status.Errorf(codes.Internal, "请求转发处理失败: %s", err)
+	}
+	a.tracker.Queued(msg.ID)
+	a.msgChan <- msgB
+	metrics.MessageOut(a.GetName(), control.LaneIngress, len(msgB))
+	a.log.Info("接收到gRPC请求", logger.MakeField("seq", a.seq.Next()), logger.MakeField("method", msg.Method),
+		logger.MakeField("remote", msg.RemoteAddr), logger.MakeField("size", len(msg.Data)),
+		logger.MakeField("traceId", span.Context().TraceIDString()), logger.MakeField("id", msg.ID))
+	return msg.ID, nil
+}
+
+// captured 判断方法所属的服务是否被捕获
+func (a *Adapter) captured(method string) bool {
+	if _, ok := a.services["*"]; ok {
+		return true
+	}
+	service, _ := rawgrpc.SplitMethod(method)
+	_, ok := a.services[service]
+	return ok
+}
+
+// Status 上报gRPC模块的运行状态
+func (a *Adapter) Status() map[string]any {
+	services := make([]string, 0, len(a.services))
+	for s := range a.services {
+		services = append(services, s)
+	}
+	return map[string]any{
+		"listen":   a.listen,
+		"lastSeq":  a.seq.Last(),
+		"tls":      a.certs != nil,
+		"auth":     a.authn.Names(),
+		"services": services,
+	}
+}
+
+// checkListener 健康检查: 服务端口是否已经完成监听
+func (a *Adapter) checkListener(ctx context.Context) error {
+	if !a.bound.Load() {
+		return fmt.Errorf("端口未监听: %s", a.listen)
+	}
+	return nil
+}
+
+// first 返回metadata中key的第一个值
+func first(md metadata.MD, key string) string {
+	if vs := md.Get(key); len(vs) > 0 {
+		return vs[0]
+	}
+	return ""
+}
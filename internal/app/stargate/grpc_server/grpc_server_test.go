@@ -0,0 +1,143 @@
+package grpcserver
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/auth"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/rawgrpc"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/structs"
+)
+
+// serve 在内存连接上启动gRPC接收模块, 返回连接到该模块的客户端
+func serve(t *testing.T, a *Adapter) *grpc.ClientConn {
+	ln := bufconn.Listen(1 << 20)
+	svc := a.newServer()
+	go func() {
+		_ = svc.Serve(ln)
+	}()
+	t.Cleanup(svc.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return ln.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(rawgrpc.Codec{})))
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+// received 读取搬运通道中的下一条报文
+func received(t *testing.T, msgChan <-chan []byte) *structs.GRPCMessage {
+	select {
+	case b := <-msgChan:
+		msg := new(structs.GRPCMessage)
+		assert.NoError(t, msg.Unmarshal(b))
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("没有收到报文")
+		return nil
+	}
+}
+
+func TestSend(t *testing.T) {
+	msgChan := make(chan []byte, 10)
+	conn := serve(t, NewAdapter(msgChan))
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-tenant", "t1")
+
+	// 一元Send
+	req := (&rawgrpc.Payload{Data: []byte("hello"), Metadata: map[string]string{"k": "v"}}).Marshal()
+	var resp []byte
+	var header metadata.MD
+	assert.NoError(t, conn.Invoke(ctx, rawgrpc.MethodSend, &req, &resp, grpc.Header(&header)))
+	reply := new(rawgrpc.SendReply)
+	assert.NoError(t, reply.Unmarshal(resp))
+	assert.Len(t, reply.IDs, 1)
+	assert.Equal(t, reply.IDs, header.Get(metadataID))
+	msg := received(t, msgChan)
+	assert.Equal(t, structs.GRPCKindPayload, msg.Kind)
+	assert.Equal(t, rawgrpc.MethodSend, msg.Method)
+	assert.Equal(t, []byte("hello"), msg.Data)
+	assert.Equal(t, map[string]string{"k": "v"}, msg.Attributes)
+	assert.Equal(t, []string{"t1"}, msg.Metadata["x-tenant"])
+	assert.Equal(t, reply.IDs[0], msg.ID)
+
+	// 客户端流: 每条Payload单独搬运, 按顺序返回ID
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ClientStreams: true}, rawgrpc.MethodSendStream)
+	assert.NoError(t, err)
+	for _, d := range []string{"a", "b", "c"} {
+		p := (&rawgrpc.Payload{Data: []byte(d)}).Marshal()
+		assert.NoError(t, stream.SendMsg(&p))
+	}
+	assert.NoError(t, stream.CloseSend())
+	assert.NoError(t, stream.RecvMsg(&resp))
+	reply = new(rawgrpc.SendReply)
+	assert.NoError(t, reply.Unmarshal(resp))
+	assert.Len(t, reply.IDs, 3)
+	for i, d := range []string{"a", "b", "c"} {
+		msg = received(t, msgChan)
+		assert.Equal(t, rawgrpc.MethodSendStream, msg.Method)
+		assert.Equal(t, []byte(d), msg.Data)
+		assert.Equal(t, reply.IDs[i], msg.ID)
+	}
+}
+
+func TestCapturedCall(t *testing.T) {
+	msgChan := make(chan []byte, 10)
+	conn := serve(t, NewAdapter(msgChan, WithServices("billing.v1.Orders")))
+
+	// 捕获的一元调用按原始编码搬运, 立即回复空消息
+	req := []byte{0x0a, 0x03, 'o', '-', '1'}
+	resp := []byte("x")
+	var header metadata.MD
+	assert.NoError(t, conn.Invoke(context.Background(), "/billing.v1.Orders/Create", &req, &resp, grpc.Header(&header)))
+	assert.Empty(t, resp)
+	msg := received(t, msgChan)
+	assert.Equal(t, structs.GRPCKindCall, msg.Kind)
+	assert.Equal(t, "/billing.v1.Orders/Create", msg.Method)
+	assert.Equal(t, req, msg.Data)
+	assert.Equal(t, header.Get(metadataID), []string{msg.ID})
+
+	// 没有捕获的服务
+	err := conn.Invoke(context.Background(), "/report.v1.Daily/Get", &req, &resp)
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+	assert.Len(t, msgChan, 0)
+}
+
+func TestAuth(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "keys.json")
+	b, _ := json.Marshal(map[string]string{"app": "key1"})
+	assert.NoError(t, os.WriteFile(file, b, 0o600))
+	authn, err := auth.NewChain(auth.Options{APIKeys: file})
+	assert.NoError(t, err)
+	msgChan := make(chan []byte, 10)
+	conn := serve(t, NewAdapter(msgChan, WithAuth(authn)))
+
+	req := (&rawgrpc.Payload{Data: []byte("hello")}).Marshal()
+	var resp []byte
+	err = conn.Invoke(context.Background(), rawgrpc.MethodSend, &req, &resp)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Len(t, msgChan, 0)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), auth.HeaderAPIKey, "key1")
+	assert.NoError(t, conn.Invoke(ctx, rawgrpc.MethodSend, &req, &resp))
+	msg := received(t, msgChan)
+	assert.Equal(t, "app", msg.Principal.Subject)
+	// API key不随报文搬运
+	_, ok := msg.Metadata["x-wormhole-api-key"]
+	assert.False(t, ok)
+}
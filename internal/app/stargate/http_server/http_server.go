@@ -2,22 +2,60 @@ package httpserver
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/chengfeiZhou/Wormhole/internal/app/stargate"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/auth"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/blob"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/control"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/metrics"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/policy"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/ratelimit"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/route"
 	"github.com/chengfeiZhou/Wormhole/internal/pkg/structs"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/tracking"
+	"github.com/chengfeiZhou/Wormhole/pkg/certs"
 	"github.com/chengfeiZhou/Wormhole/pkg/logger"
 	types "github.com/chengfeiZhou/Wormhole/pkg/structs"
+	"github.com/chengfeiZhou/Wormhole/pkg/trace"
 )
 
 // nolint
 type Adapter struct {
-	log     logger.Logger
-	listen  string
-	msgChan chan<- []byte // 报文转移通道
+	control.Switch // 暂停时拒绝请求
+	log            logger.Logger
+	listen         string
+	msgChan        chan<- []byte // 报文转移通道
+	seq            control.Sequence
+	bound          atomic.Bool // 是否已经完成端口监听
+	tracer         *trace.Tracer
+	certs          *certs.Reloader // 不为空时启用https
+	authn          auth.Chain      // 不为空时校验调用方
+	routes         *route.Table    // 不为空时按路由表匹配请求
+	maxBodySize    int64           // 随搬运记录写入的请求体上限, <0不限制
+	spool          *spoolOption    // 不为空时超出maxBodySize的请求体落盘, 否则返回413
+	tracker        *tracking.Tracker
+	limiter        *ratelimit.Limiter // 不为空时按调用方限流
+	policy         *policy.Policy     // 不为空时只转发策略允许的请求
+	statusPath     string             // 不为空时在该路径下提供报文状态查询
+}
+
+// spoolOption 请求体落盘的配置
+type spoolOption struct {
+	dir       string        // 分块写入的目录(搬运目录)
+	chunkSize int64         // 分块大小
+	maxSize   int64         // 落盘上限, 0不限制
+	timeout   time.Duration // 落盘请求的读写超时
 }
 
 type OptionFunc func(*Adapter)
@@ -42,15 +80,74 @@ func WithListen(bind string) OptionFunc {
 	}
 }
 
+// WithTLS 启用https, certs负责证书的加载和热更新
+func WithTLS(r *certs.Reloader) OptionFunc {
+	return func(a *Adapter) {
+		a.certs = r
+	}
+}
+
+// WithMaxBodySize 设置随搬运记录写入的请求体上限, <0不限制
+func WithMaxBodySize(size int64) OptionFunc {
+	return func(a *Adapter) {
+		a.maxBodySize = size
+	}
+}
+
+// WithSpool 超出请求体上限的请求体按chunkSize分块写入dir, 随搬运文件一起摆渡
+// maxSize: 落盘上限, 0不限制; timeout: 落盘请求的读写超时
+func WithSpool(dir string, chunkSize, maxSize int64, timeout time.Duration) OptionFunc {
+	return func(a *Adapter) {
+		a.spool = &spoolOption{dir: dir, chunkSize: chunkSize, maxSize: maxSize, timeout: timeout}
+	}
+}
+
+// WithAuth 设置调用方认证
+func WithAuth(c auth.Chain) OptionFunc {
+	return func(a *Adapter) {
+		a.authn = c
+	}
+}
+
+// WithRoutes 设置路由表
+func WithRoutes(t *route.Table) OptionFunc {
+	return func(a *Adapter) {
+		a.routes = t
+	}
+}
+
+// WithTracking 记录报文搬运状态; statusPath不为空时在该路径前缀下提供查询(GET statusPath<id>)
+func WithTracking(t *tracking.Tracker, statusPath string) OptionFunc {
+	return func(a *Adapter) {
+		a.tracker = t
+		a.statusPath = statusPath
+	}
+}
+
+// WithRateLimit 设置调用方限流与每日配额
+func WithRateLimit(l *ratelimit.Limiter) OptionFunc {
+	return func(a *Adapter) {
+		a.limiter = l
+	}
+}
+
+// WithPolicy 设置请求策略
+func WithPolicy(p *policy.Policy) OptionFunc {
+	return func(a *Adapter) {
+		a.policy = p
+	}
+}
+
 // NewAdapter 函数用于创建一个新的Adapter实例
 // msgChan 是一个通道，用于发送字节切片类型的消息
 // ops 是一个可变参数列表，用于传递多个OptionFunc类型的函数选项
 // 函数返回一个指向新创建的Adapter实例的指针
 func NewAdapter(msgChan chan<- []byte, ops ...OptionFunc) *Adapter {
 	ad := &Adapter{
-		log:     logger.DefaultLogger(),
-		msgChan: msgChan,
-		listen:  "0.0.0.0:8080",
+		log:         logger.DefaultLogger(),
+		msgChan:     msgChan,
+		listen:      "0.0.0.0:8080",
+		maxBodySize: -1,
 	}
 	for _, op := range ops {
 		op(ad)
@@ -71,6 +168,66 @@ func (a *Adapter) Setup(app *stargate.App, msgChan chan<- []byte) error {
 	a.msgChan = msgChan
 	a.log = app.Logger
 	a.listen = app.Config.Listen
+	a.tracer = app.Tracer()
+	a.maxBodySize = app.Config.MaxBodySize
+	WithTracking(app.Tracker(), app.Config.StatusPath)(a)
+	switch app.Config.LargeBody {
+	case "reject":
+	case "spool":
+		WithSpool(app.Config.HandlingPath, app.Config.FileMaxSize, app.Config.MaxSpoolSize,
+			time.Duration(app.Config.SpoolTimeout)*time.Second)(a)
+	default:
+		return fmt.Errorf("largeBody可选: reject, spool; 当前: %s", app.Config.LargeBody)
+	}
+	if conf := app.Config; conf.TLSCert != "" {
+		ops := []certs.OptionFunc{certs.WithLogger(a.log)}
+		if conf.TLSClientCA != "" {
+			ops = append(ops, certs.WithClientCA(conf.TLSClientCA, conf.TLSClientAuth))
+		}
+		r, err := certs.NewReloader(conf.TLSCert, conf.TLSKey, ops...)
+		if err != nil {
+			a.log.Error(logger.ErrorTLS, "加载https证书", logger.ErrorField(err))
+			return err
+		}
+		a.certs = r
+	}
+	authn, err := auth.NewChain(auth.Options{
+		APIKeys:     app.Config.AuthAPIKeys,
+		HMACKeys:    app.Config.AuthHMACKeys,
+		HMACWindow:  time.Duration(app.Config.AuthHMACWindow) * time.Second,
+		JWKS:        app.Config.AuthJWKS,
+		JWTIssuer:   app.Config.AuthJWTIssuer,
+		JWTAudience: app.Config.AuthJWTAudience,
+	})
+	if err != nil {
+		a.log.Error(logger.ErrorAuthFailed, "加载认证配置", logger.ErrorField(err))
+		return err
+	}
+	a.authn = authn
+	if !a.authn.Enabled() {
+		a.log.Warn(logger.ErrorAuthFailed, "http接收模块未启用调用方认证")
+	}
+	if app.Config.Routes != "" {
+		if a.routes, err = route.LoadTable(app.Config.Routes); err != nil {
+			a.log.Error(logger.ErrorParam, "加载路由表", logger.ErrorField(err))
+			return err
+		}
+	}
+	if app.Config.RateLimits != "" {
+		conf, errL := ratelimit.LoadConfig(app.Config.RateLimits)
+		if errL != nil {
+			a.log.Error(logger.ErrorParam, "加载限流配置", logger.ErrorField(errL))
+			return errL
+		}
+		a.limiter = ratelimit.New(conf)
+	}
+	if app.Config.Policy != "" {
+		if a.policy, err = policy.Load(app.Config.Policy); err != nil {
+			a.log.Error(logger.ErrorParam, "加载请求策略", logger.ErrorField(err))
+			return err
+		}
+	}
+	app.Health().Liveness(a.GetName(), "listener", a.checkListener)
 	return nil
 }
 
@@ -92,17 +249,147 @@ func (a *Adapter) Help() {
 //	w: http.ResponseWriter，用于向客户端发送响应
 //	r: *http.Request，表示客户端发送的HTTP请求
 func (a *Adapter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	msg, err := structs.ParseRequest(r)
+	if a.statusPath != "" && r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, a.statusPath) {
+		a.serveStatus(w, r)
+		return
+	}
+	if a.Paused() {
+		a.response(w, http.StatusServiceUnavailable, &types.HttpRespData{
+			Code:    -1,
+			Message: "请求转发已暂停",
+			Data:    nil,
+		})
+		return
+	}
+	// 延续调用方传入的链路, 没有时开始新的链路
+	span := a.tracer.Start("stargate.http.ingress", trace.KindServer, r.Header.Get(trace.HeaderTraceparent))
+	defer span.End()
+	span.SetAttr("http.method", r.Method)
+	span.SetAttr("url.path", r.URL.Path)
+	span.SetAttr("client.address", r.RemoteAddr)
+	// 只依赖请求头的检查(认证, 策略, 路由, 限流)在读取请求体之前完成, 被拒绝的请求不会读取或落盘请求体
+	msg := structs.NewRequestMessage(r)
+	var pending *http.Request // 需要请求体摘要才能完成认证(HMAC)的请求
+	if a.authn.Enabled() {
+		principal, errA := a.authn.AuthenticateHeader(r)
+		switch {
+		case errors.Is(errA, auth.ErrNeedBody):
+			// 保留认证头的副本, 读取请求体后校验签名
+			pending = r.Clone(r.Context())
+		case errA != nil:
+			a.unauthorized(w, r, span, errA)
+			return
+		default:
+			msg.Principal = principal
+			span.SetAttr("enduser.id", principal.Subject)
+		}
+		a.authn.Strip(msg.Header)
+	}
+	if a.policy != nil {
+		if err := a.policy.CheckRequest(msg); err != nil {
+			span.SetError(err)
+			a.log.Warn(logger.ErrorPolicyDenied, "请求被策略拒绝", logger.ErrorField(err),
+				logger.MakeField("remote", r.RemoteAddr), logger.MakeField("method", msg.Method),
+				logger.MakeField("url", msg.URL().String()))
+			a.response(w, http.StatusForbidden, &types.HttpRespData{
+				Code:    -1,
+				Message: "请求被策略拒绝",
+				Data:    nil,
+			})
+			return
+		}
+	}
+	var err error
+	if a.routes != nil {
+		if msg.Route, err = a.routes.Match(r); err != nil {
+			span.SetError(err)
+			a.response(w, http.StatusNotFound, &types.HttpRespData{
+				Code:    -1,
+				Message: "没有匹配的路由",
+				Data:    nil,
+			})
+			return
+		}
+		span.SetAttr("wormhole.route", msg.Route)
+	}
+	// 按认证的调用方限流时, 等待签名校验后再检查
+	limited := a.limiter != nil && (pending == nil || a.limiter.Key() != ratelimit.KeyPrincipal)
+	if limited {
+		key := a.limitKey(msg)
+		if !a.allow(w, r, span, key, a.limiter.Allow(key, max(msg.ContentLength, 0))) {
+			return
+		}
+	}
+	if v := r.Header.Get(structs.HeaderDeliverAfter); v != "" {
+		// 投递时间只由次元使用, 不转发到目标
+		delete(msg.Header, structs.HeaderDeliverAfter)
+		if msg.DeliverAfter, err = structs.ParseDeliverAfter(v); err != nil {
+			span.SetError(err)
+			a.response(w, http.StatusBadRequest, &types.HttpRespData{
+				Code:    -1,
+				Message: err.Error(),
+				Data:    nil,
+			})
+			return
+		}
+	}
+	bodySum, err := a.readBody(w, r, msg)
 	if err != nil {
-		a.response(w, http.StatusInternalServerError, &types.HttpRespData{
+		span.SetError(err)
+		code := http.StatusInternalServerError
+		if errors.Is(err, structs.ErrBodyTooLarge) || errors.Is(err, blob.ErrTooLarge) {
+			code = http.StatusRequestEntityTooLarge
+		}
+		a.response(w, code, &types.HttpRespData{
 			Code:    -1,
 			Message: "请求转发处理失败",
 			Data:    map[string]any{"error": err.Error()},
 		})
 		return
 	}
+	committed := false
+	defer func() {
+		// 请求没有进入搬运通道时删除已落盘的请求体
+		if !committed && msg.BodyRef != nil {
+			blob.Remove(a.spool.dir, msg.BodyRef)
+		}
+	}()
+	if msg.BodyRef != nil {
+		span.SetAttr("wormhole.body.spooled", msg.BodyRef.Size)
+	}
+	if pending != nil {
+		principal, errA := a.authn.Authenticate(pending, bodySum)
+		if errA != nil {
+			a.unauthorized(w, r, span, errA)
+			return
+		}
+		msg.Principal = principal
+		span.SetAttr("enduser.id", principal.Subject)
+	}
+	if a.limiter != nil && (!limited || msg.ContentLength < 0) {
+		key := a.limitKey(msg)
+		var res ratelimit.Result
+		if limited {
+			// 分块传输的请求体读取后才知道大小
+			res = a.limiter.Consume(key, int64(bodySize(msg)))
+		} else {
+			res = a.limiter.Allow(key, int64(bodySize(msg)))
+		}
+		if !a.allow(w, r, span, key, res) {
+			return
+		}
+	}
+	msg.ID = tracking.NewID()
+	span.SetAttr("wormhole.id", msg.ID)
+	msg.StargateTime = time.Now().UnixMilli()
+	msg.TraceParent = span.Traceparent()
+	if msg.ClientIdentity != nil {
+		span.SetAttr("tls.client.subject", msg.ClientIdentity.Subject)
+	}
+	metrics.MessageIn(a.GetName(), control.LaneIngress, bodySize(msg))
 	msgB, err := msg.Marshal()
 	if err != nil {
+		span.SetError(err)
 		a.response(w, http.StatusInternalServerError, &types.HttpRespData{
 			Code:    -1,
 			Message: "请求转发处理失败",
@@ -110,17 +397,148 @@ func (a *Adapter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	a.tracker.Queued(msg.ID)
 	a.msgChan <- msgB
-	a.log.Info("接收到请求", logger.MakeField("method", msg.Method), logger.MakeField("remote", msg.RemoteAddr),
-		logger.MakeField("url", msg.URL), logger.MakeField("contentLength", msg.ContentLength))
+	committed = true
+	metrics.MessageOut(a.GetName(), control.LaneIngress, len(msgB))
+	a.log.Info("接收到请求", logger.MakeField("seq", a.seq.Next()), logger.MakeField("method", msg.Method),
+		logger.MakeField("remote", msg.RemoteAddr), logger.MakeField("url", msg.URL().String()), logger.MakeField("route", msg.Route),
+		logger.MakeField("contentLength", msg.ContentLength), logger.MakeField("traceId", span.Context().TraceIDString()),
+		logger.MakeField("id", msg.ID))
 
+	w.Header().Set(tracking.HeaderID, msg.ID)
 	a.response(w, http.StatusOK, &types.HttpRespData{
 		Code:    0,
 		Message: "请求转发成功",
+		Data:    map[string]any{"id": msg.ID},
+	})
+}
+
+// serveStatus 查询报文搬运状态, 启用认证时需要与转发请求相同的认证
+func (a *Adapter) serveStatus(w http.ResponseWriter, r *http.Request) {
+	if a.authn.Enabled() {
+		sum := sha256.Sum256(nil)
+		if _, err := a.authn.Authenticate(r, sum[:]); err != nil {
+			a.log.Warn(logger.ErrorAuthFailed, "调用方认证失败", logger.ErrorField(err),
+				logger.MakeField("remote", r.RemoteAddr), logger.MakeField("url", r.URL.String()))
+			a.response(w, http.StatusUnauthorized, &types.HttpRespData{
+				Code:    -1,
+				Message: "未授权的请求",
+				Data:    nil,
+			})
+			return
+		}
+	}
+	a.tracker.Handler().ServeHTTP(w, r)
+}
+
+// readBody 读取请求体写入msg, 并返回请求体的sha256
+// 请求体超出maxBodySize时: 未配置落盘返回structs.ErrBodyTooLarge; 否则分块落盘, 报文中只保留BodyRef
+func (a *Adapter) readBody(w http.ResponseWriter, r *http.Request, msg *structs.HTTPMessage) ([]byte, error) {
+	defer r.Body.Close()
+	body, rest, err := structs.ReadBodyLimit(r, a.maxBodySize)
+	if err == nil {
+		msg.Body = body
+		sum := sha256.Sum256(body)
+		return sum[:], nil
+	}
+	if !errors.Is(err, structs.ErrBodyTooLarge) || a.spool == nil {
+		return nil, err
+	}
+	// 落盘的请求体可能很大, 延长本次请求的读写超时
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Now().Add(a.spool.timeout))
+	_ = rc.SetWriteDeadline(time.Now().Add(a.spool.timeout))
+	ref, err := blob.Spool(a.spool.dir, rest, a.spool.chunkSize, a.spool.maxSize)
+	if err != nil {
+		return nil, err
+	}
+	sum, err := hex.DecodeString(ref.SHA256)
+	if err != nil {
+		blob.Remove(a.spool.dir, ref)
+		return nil, err
+	}
+	msg.BodyRef = ref
+	a.log.Info("请求体落盘", logger.MakeField("id", ref.ID), logger.MakeField("size", ref.Size),
+		logger.MakeField("chunks", ref.Chunks))
+	return sum, nil
+}
+
+// unauthorized 认证失败时返回401
+func (a *Adapter) unauthorized(w http.ResponseWriter, r *http.Request, span *trace.Span, err error) {
+	span.SetError(err)
+	a.log.Warn(logger.ErrorAuthFailed, "调用方认证失败", logger.ErrorField(err),
+		logger.MakeField("remote", r.RemoteAddr), logger.MakeField("url", r.URL.String()))
+	a.response(w, http.StatusUnauthorized, &types.HttpRespData{
+		Code:    -1,
+		Message: "未授权的请求",
 		Data:    nil,
 	})
 }
 
+// allow 写入限流响应头, 超出限制时返回429和false
+func (a *Adapter) allow(w http.ResponseWriter, r *http.Request, span *trace.Span, key string, res ratelimit.Result) bool {
+	res.SetHeaders(w.Header())
+	if res.Err == nil {
+		return true
+	}
+	span.SetError(res.Err)
+	a.log.Warn(logger.ErrorRateLimited, "调用方超出限制", logger.ErrorField(res.Err),
+		logger.MakeField("key", key), logger.MakeField("remote", r.RemoteAddr))
+	a.response(w, http.StatusTooManyRequests, &types.HttpRespData{
+		Code:    -1,
+		Message: res.Err.Error(),
+		Data:    nil,
+	})
+	return false
+}
+
+// limitKey 按限流维度返回调用方
+func (a *Adapter) limitKey(msg *structs.HTTPMessage) string {
+	switch a.limiter.Key() {
+	case ratelimit.KeyPrincipal:
+		if msg.Principal != nil {
+			return msg.Principal.Method + ":" + msg.Principal.Subject
+		}
+	case ratelimit.KeyRoute:
+		return msg.Route
+	}
+	host, _, err := net.SplitHostPort(msg.RemoteAddr)
+	if err != nil {
+		return msg.RemoteAddr
+	}
+	return host
+}
+
+// bodySize 返回请求体大小
+func bodySize(msg *structs.HTTPMessage) int {
+	if msg.BodyRef != nil {
+		return int(msg.BodyRef.Size)
+	}
+	return len(msg.Body)
+}
+
+// Status 上报http模块的运行状态
+func (a *Adapter) Status() map[string]any {
+	st := map[string]any{
+		"listen":  a.listen,
+		"lastSeq": a.seq.Last(),
+		"tls":     a.certs != nil,
+		"auth":    a.authn.Names(),
+	}
+	if a.routes != nil {
+		st["routes"] = len(a.routes.Routes)
+	}
+	if a.limiter != nil {
+		st["rateLimitKey"] = a.limiter.Key()
+	}
+	if a.certs != nil {
+		st["certNotAfter"] = a.certs.NotAfter()
+		st["clientAuth"] = a.certs.ClientAuth().String()
+	}
+	return st
+}
+
 // response 是Adapter结构体的方法，用于将HTTP响应数据写入到http.ResponseWriter中
 //
 // 参数：
@@ -153,9 +571,28 @@ func (a *Adapter) Run(ctx context.Context) error {
 		ReadTimeout:    10 * time.Second,
 		WriteTimeout:   10 * time.Second,
 		MaxHeaderBytes: 1 << 20}
-	if err := svc.ListenAndServe(); err != nil {
+	ln, err := net.Listen("tcp", a.listen)
+	if err != nil {
+		a.log.Fatal(logger.ErrorHTTPHandle, "conversion of Entry Service", logger.ErrorField(err))
+		return err
+	}
+	if a.certs != nil {
+		ln = tls.NewListener(ln, a.certs.ServerConfig())
+		a.log.Info("https enabled", logger.MakeField("clientAuth", a.certs.ClientAuth().String()))
+	}
+	a.bound.Store(true)
+	defer a.bound.Store(false)
+	if err := svc.Serve(ln); err != nil {
 		a.log.Fatal(logger.ErrorHTTPHandle, "conversion of Entry Service", logger.ErrorField(err))
 		return err
 	}
 	return nil
 }
+
+// checkListener 健康检查: 服务端口是否已经完成监听
+func (a *Adapter) checkListener(ctx context.Context) error {
+	if !a.bound.Load() {
+		return fmt.Errorf("端口未监听: %s", a.listen)
+	}
+	return nil
+}
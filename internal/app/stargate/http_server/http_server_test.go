@@ -0,0 +1,123 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/auth"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/policy"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingBody 记录请求体是否被读取
+type countingBody struct {
+	r    *strings.Reader
+	read int
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.read += n
+	return n, err
+}
+
+func (b *countingBody) Close() error {
+	return nil
+}
+
+func writeJSON(t *testing.T, name string, v any) string {
+	data, err := json.Marshal(v)
+	assert.NoError(t, err)
+	file := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(file, data, 0o600))
+	return file
+}
+
+func TestCheckBeforeBody(t *testing.T) {
+	authn, err := auth.NewChain(auth.Options{
+		APIKeys:    writeJSON(t, "keys.json", map[string]string{"app": "key1"}),
+		HMACKeys:   writeJSON(t, "hmac.json", map[string]string{"k1": "secret"}),
+		HMACWindow: time.Minute,
+	})
+	assert.NoError(t, err)
+	pol, err := policy.Load(writeJSON(t, "policy.json", map[string]any{
+		"rules": []map[string]any{{"path": "/api/**"}},
+	}))
+	assert.NoError(t, err)
+	msgChan := make(chan []byte, 10)
+	a := NewAdapter(msgChan, WithAuth(authn), WithPolicy(pol), WithMaxBodySize(4),
+		WithSpool(t.TempDir(), 4, 0, time.Minute),
+		WithRateLimit(ratelimit.New(&ratelimit.Config{
+			Key:     ratelimit.KeyPrincipal,
+			Default: ratelimit.Limit{DailyMessages: 2},
+		})))
+
+	serve := func(path string, header map[string]string) (int, *countingBody) {
+		body := &countingBody{r: strings.NewReader("0123456789")}
+		r := httptest.NewRequest(http.MethodPost, path, body)
+		r.ContentLength = 10
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, r)
+		return w.Code, body
+	}
+	apiKey := map[string]string{auth.HeaderAPIKey: "key1"}
+
+	// 未认证, 策略拒绝的请求不读取请求体
+	code, body := serve("/api/orders", nil)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Zero(t, body.read)
+	code, body = serve("/api/orders", map[string]string{auth.HeaderAPIKey: "bad"})
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Zero(t, body.read)
+	code, body = serve("/admin", apiKey)
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Zero(t, body.read)
+	// 路径穿越不匹配/api/**
+	for _, path := range []string{"/api/../admin", "/api/%2e%2e/admin", "/api/%2E%2E/admin"} {
+		code, body = serve(path, apiKey)
+		assert.Equal(t, http.StatusForbidden, code, path)
+		assert.Zero(t, body.read, path)
+	}
+
+	// 通过检查后读取(落盘)请求体
+	code, body = serve("/api/orders", apiKey)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 10, body.read)
+	assert.Len(t, msgChan, 1)
+
+	// HMAC: 请求头检查通过后读取请求体校验签名
+	ts := time.Now().Unix()
+	hmacHeader := func(payload string) map[string]string {
+		return map[string]string{
+			auth.HeaderKeyID:     "k1",
+			auth.HeaderTimestamp: strconv.FormatInt(ts, 10),
+			auth.HeaderSignature: auth.Sign([]byte("secret"), http.MethodPost, "/api/orders", ts, []byte(payload)),
+		}
+	}
+	code, body = serve("/api/orders", map[string]string{auth.HeaderKeyID: "k2", auth.HeaderSignature: "x"})
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Zero(t, body.read)
+	code, _ = serve("/api/orders", hmacHeader("other"))
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = serve("/api/orders", hmacHeader("0123456789"))
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, msgChan, 2)
+
+	// 超出配额的请求不读取请求体
+	code, _ = serve("/api/orders", apiKey)
+	assert.Equal(t, http.StatusOK, code)
+	code, body = serve("/api/orders", apiKey)
+	assert.Equal(t, http.StatusTooManyRequests, code)
+	assert.Zero(t, body.read)
+}
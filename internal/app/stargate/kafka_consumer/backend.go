@@ -0,0 +1,147 @@
+package kafkaconsumer
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/IBM/sarama"
+
+	"github.com/chengfeiZhou/Wormhole/pkg/amqp/confluent"
+	kafka "github.com/chengfeiZhou/Wormhole/pkg/amqp/kafka"
+)
+
+// kafka客户端
+const (
+	BackendSarama    = "sarama"    // 纯Go实现
+	BackendConfluent = "confluent" // librdkafka, 需要cgo
+)
+
+// 没有提交offset时的起始位置
+const (
+	OffsetOldest = "oldest"
+	OffsetNewest = "newest"
+)
+
+// consumer 消费者组, 由sarama或confluent实现
+type consumer interface {
+	Run(ctx context.Context) error
+	Topics() []string
+}
+
+// record 消费到的消息, 与客户端无关
+type record struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Headers   []header
+	Timestamp time.Time
+}
+
+type header struct {
+	Key   string
+	Value []byte
+}
+
+// parseOffset 解析起始位置: oldest, newest, 时间(RFC3339或unix秒); 按时间开始时at不为零
+func parseOffset(v string) (oldest bool, at time.Time, err error) {
+	switch v {
+	case OffsetOldest, "":
+		return true, time.Time{}, nil
+	case OffsetNewest:
+		return false, time.Time{}, nil
+	}
+	if sec, errI := strconv.ParseInt(v, 10, 64); errI == nil && sec > 0 {
+		return true, time.Unix(sec, 0), nil
+	}
+	if at, err = time.Parse(time.RFC3339, v); err != nil {
+		return false, time.Time{}, fmt.Errorf("起始位置格式错误(oldest, newest, RFC3339或unix秒): %s", v)
+	}
+	return true, at, nil
+}
+
+// newConsumer 按配置的客户端创建消费者组
+func (ad *Adapter) newConsumer() (consumer, error) {
+	oldest, at, err := parseOffset(ad.Offset)
+	if err != nil {
+		return nil, err
+	}
+	if ad.Regex != "" {
+		if _, err = regexp.Compile(ad.Regex); err != nil {
+			return nil, fmt.Errorf("topic正则: %w", err)
+		}
+	}
+	switch ad.Backend {
+	case BackendSarama, "":
+		return ad.newSarama(oldest, at)
+	case BackendConfluent:
+		return ad.newConfluent(oldest, at)
+	}
+	return nil, fmt.Errorf("不支持的kafka客户端: %s", ad.Backend)
+}
+
+func (ad *Adapter) newSarama(oldest bool, at time.Time) (consumer, error) {
+	initial := sarama.OffsetNewest
+	if oldest {
+		initial = sarama.OffsetOldest
+	}
+	ops := []kafka.OptionFunc{
+		kafka.WithLogger(ad.log),
+		kafka.ConsumerBeginAt(initial),
+	}
+	if !at.IsZero() {
+		ops = append(ops, kafka.ConsumerBeginAtTime(at))
+	}
+	if ad.user != "" && ad.passwd != "" {
+		ops = append(ops, kafka.WitchBaseAuth(ad.user, ad.passwd, sarama.SASLMechanism(ad.mechanism)))
+	}
+	if ad.Regex != "" {
+		ops = append(ops, kafka.ConsumerTopicRegex(ad.Regex, ad.Refresh))
+	}
+	cg, err := kafka.NewConsumerGroup(ad.Addrs, ad.Topics, ad.GroupID, func(ctx context.Context, d *kafka.Data) error {
+		rec := &record{Topic: d.Topic, Partition: d.Partition, Offset: d.Offset, Key: d.Key, Value: d.Value, Timestamp: d.FaninTime}
+		for _, h := range d.Headers {
+			rec.Headers = append(rec.Headers, header{Key: h.Key, Value: h.Value})
+		}
+		return ad.consumerHandle(ctx, rec)
+	}, ops...)
+	if err != nil {
+		return nil, err
+	}
+	return cg, nil
+}
+
+func (ad *Adapter) newConfluent(oldest bool, at time.Time) (consumer, error) {
+	reset := "latest"
+	if oldest {
+		reset = "earliest"
+	}
+	ops := []confluent.OptionFunc{
+		confluent.WithLogger(ad.log),
+		confluent.ConsumerOffsetReset(reset),
+	}
+	if !at.IsZero() {
+		ops = append(ops, confluent.ConsumerBeginAtTime(at))
+	}
+	if ad.user != "" && ad.passwd != "" {
+		ops = append(ops, confluent.WitchBaseAuth(ad.user, ad.passwd, ad.mechanism))
+	}
+	if ad.Regex != "" {
+		ops = append(ops, confluent.ConsumerTopicRegex(ad.Regex, ad.Refresh))
+	}
+	cg, err := confluent.NewConsumerGroup(ad.Addrs, ad.Topics, ad.GroupID, func(ctx context.Context, d *confluent.Data) error {
+		rec := &record{Topic: d.Topic, Partition: d.Partition, Offset: d.Offset, Key: d.Key, Value: d.Value, Timestamp: d.FaninTime}
+		for _, h := range d.Headers {
+			rec.Headers = append(rec.Headers, header{Key: h.Key, Value: h.Value})
+		}
+		return ad.consumerHandle(ctx, rec)
+	}, ops...)
+	if err != nil {
+		return nil, err
+	}
+	return cg, nil
+}
@@ -2,25 +2,46 @@ package kafkaconsumer
 
 import (
 	"context"
-
-	kafka "github.com/chengfeiZhou/Wormhole/pkg/amqp/confluent"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/chengfeiZhou/Wormhole/internal/app/stargate"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/control"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/health"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/metrics"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/ratelimit"
 	"github.com/chengfeiZhou/Wormhole/internal/pkg/structs"
 	"github.com/chengfeiZhou/Wormhole/pkg/logger"
+	"github.com/chengfeiZhou/Wormhole/pkg/trace"
 )
 
 const (
-	groupID = "wormhole_stargate"
+	defaultGroupID = "wormhole_stargate"
+	defaultRefresh = time.Minute
 )
 
 // nolint
 type Adapter struct {
-	Addrs   []string
-	Topics  []string
-	log     logger.Logger
-	msgChan chan<- []byte        // 报文转移通道
-	cg      *kafka.ConsumerGroup // kafa的消费者组
+	control.Switch // 暂停时阻塞消费
+	Addrs          []string
+	Topics         []string
+	GroupID        string        // 消费者组
+	Offset         string        // 没有提交offset时的起始位置: oldest, newest, 时间(RFC3339或unix秒)
+	Regex          string        // 按正则订阅topic, 与Topics合并
+	Refresh        time.Duration // 正则订阅刷新topic列表的间隔
+	Backend        string        // kafka客户端: sarama, confluent
+	Cluster        string        // 源集群名称, 为空时使用Addrs
+	user           string
+	passwd         string
+	mechanism      string
+	log            logger.Logger
+	msgChan        chan<- []byte // 报文转移通道
+	cg             consumer      // kafa的消费者组
+	seq            control.Sequence
+	tracer         *trace.Tracer
+	limiter        *ratelimit.Limiter // 不为空时按topic限流, 超出时阻塞消费
 }
 
 type OptionFunc func(*Adapter)
@@ -34,6 +55,56 @@ func WithLogger(log logger.Logger) OptionFunc {
 	}
 }
 
+// WithRateLimit 设置按topic的限流与每日配额
+func WithRateLimit(l *ratelimit.Limiter) OptionFunc {
+	return func(a *Adapter) {
+		a.limiter = l
+	}
+}
+
+// WithGroupID 设置消费者组, 默认wormhole_stargate
+func WithGroupID(groupID string) OptionFunc {
+	return func(a *Adapter) {
+		a.GroupID = groupID
+	}
+}
+
+// WithOffset 设置没有提交offset时的起始位置: oldest, newest, 时间(RFC3339或unix秒), 默认oldest
+func WithOffset(offset string) OptionFunc {
+	return func(a *Adapter) {
+		a.Offset = offset
+	}
+}
+
+// WithTopicRegex 订阅名称匹配正则的topic, 每隔refresh刷新一次topic列表
+func WithTopicRegex(pattern string, refresh time.Duration) OptionFunc {
+	return func(a *Adapter) {
+		a.Regex = pattern
+		a.Refresh = refresh
+	}
+}
+
+// WithBackend 设置kafka客户端: sarama, confluent, 默认sarama
+func WithBackend(backend string) OptionFunc {
+	return func(a *Adapter) {
+		a.Backend = backend
+	}
+}
+
+// WithCluster 设置源集群名称, 随消息搬运
+func WithCluster(cluster string) OptionFunc {
+	return func(a *Adapter) {
+		a.Cluster = cluster
+	}
+}
+
+// WithAuth 设置kafka鉴权的用户名, 密码与加密算法
+func WithAuth(user, passwd, mechanism string) OptionFunc {
+	return func(a *Adapter) {
+		a.user, a.passwd, a.mechanism = user, passwd, mechanism
+	}
+}
+
 // NewAdapter 创建一个新的Adapter实例
 // addrs: Kafka的地址列表
 // topics: 需要订阅的Kafka主题列表
@@ -44,18 +115,20 @@ func NewAdapter(addrs, topics []string, msgChan chan<- []byte, ops ...OptionFunc
 	ad := &Adapter{
 		Addrs:   addrs,
 		Topics:  topics,
+		GroupID: defaultGroupID,
+		Offset:  OffsetOldest,
+		Refresh: defaultRefresh,
+		Backend: BackendSarama,
 		log:     logger.DefaultLogger(),
 		msgChan: msgChan,
 	}
-	cg, err := kafka.NewConsumerGroup(addrs, topics, groupID, ad.consumerHandle)
-	if err != nil {
-		ad.log.Error(logger.ErrorKafkaConsumer, "create consumer group", logger.ErrorField(err))
-		return ad
-	}
-	ad.cg = cg
 	for _, op := range ops {
 		op(ad)
 	}
+	if ad.Cluster == "" {
+		ad.Cluster = strings.Join(ad.Addrs, ",")
+	}
+	// 消费者组在Setup或Run中创建, 避免重复创建时泄露连接
 	return ad
 }
 
@@ -71,27 +144,54 @@ func (ad *Adapter) GetName() string {
 func (ad *Adapter) Setup(app *stargate.App, msgChan chan<- []byte) error {
 	ad.log = app.Logger
 	ad.msgChan = msgChan
+	ad.tracer = app.Tracer()
 	conf := app.Config
-	kafkaOps := []kafka.OptionFunc{
-		kafka.WithLogger(ad.log),
+	ad.Addrs = conf.KafkaAddrs
+	ad.Topics = conf.KafkaTopics
+	ad.GroupID = conf.KafkaGroupID
+	ad.Offset = conf.KafkaOffset
+	ad.Regex = conf.KafkaRegex
+	ad.Refresh = time.Duration(conf.KafkaRefresh) * time.Second
+	ad.Backend = conf.KafkaBackend
+	ad.Cluster = conf.KafkaCluster
+	ad.user, ad.passwd, ad.mechanism = conf.KafkaUser, conf.KafkaPasswd, conf.KafkaMechanism
+	if ad.Cluster == "" {
+		ad.Cluster = strings.Join(ad.Addrs, ",")
 	}
-	if conf.KafkaUser != "" && conf.KafkaPasswd != "" {
-		kafkaOps = append(kafkaOps, kafka.WitchBaseAuth(conf.KafkaUser, conf.KafkaPasswd, conf.KafkaMechanism))
+	if ad.cg == nil {
+		cg, err := ad.newConsumer()
+		if err != nil {
+			ad.log.Error(logger.ErrorKafkaConsumer, "create consumer group", logger.ErrorField(err))
+			return err
+		}
+		ad.cg = cg
 	}
-	cg, err := kafka.NewConsumerGroup(conf.KafkaAddrs, conf.KafkaTopics, groupID, ad.consumerHandle, kafkaOps...)
-	if err != nil {
-		ad.log.Error(logger.ErrorKafkaConsumer, "create consumer group", logger.ErrorField(err))
-		return err
+	if conf.RateLimits != "" {
+		rc, errL := ratelimit.LoadConfig(conf.RateLimits)
+		if errL != nil {
+			ad.log.Error(logger.ErrorParam, "加载限流配置", logger.ErrorField(errL))
+			return errL
+		}
+		ad.limiter = ratelimit.New(rc)
 	}
-	ad.cg = cg
-	ad.Addrs = conf.KafkaAddrs
-	ad.Topics = conf.KafkaTopics
+	app.Health().Readiness(ad.GetName(), "broker", health.Dial(ad.Addrs...))
 	return nil
 }
 
 // Help 是一个Adapter类型的方法，用于提供适配器的帮助信息
 func (ad *Adapter) Help() {
-
+	fmt.Println("kafka module help")
+	fmt.Println("  -kafkaAddrs     kafka地址('host1:9092,host2:9092')")
+	fmt.Println("  -kafkaTopics    订阅topic('topic1,topic2')")
+	fmt.Println("  -kafkaRegex     按正则订阅topic, 与kafkaTopics合并")
+	fmt.Println("  -kafkaRefresh   正则订阅刷新topic列表的间隔(s)")
+	fmt.Println("  -kafkaGroupID   消费者组")
+	fmt.Println("  -kafkaOffset    没有提交offset时的起始位置(oldest, newest, RFC3339或unix秒)")
+	fmt.Println("  -kafkaBackend   kafka客户端(sarama, confluent)")
+	fmt.Println("  -kafkaCluster   源集群名称, 随消息搬运")
+	fmt.Println("  -kafkaUser      鉴权用户名")
+	fmt.Println("  -kafkaPasswd    鉴权密码")
+	fmt.Println("  -kafkaMechanism 鉴权的加密算法")
 }
 
 // consumerHandle 是一个Adapter类型的方法，用于处理Kafka消费者接收到的数据
@@ -99,27 +199,88 @@ func (ad *Adapter) Help() {
 // 参数：
 //
 //	ctx context.Context：上下文对象，用于控制goroutine的生命周期
-//	data *kafka.Data：Kafka接收到的数据
+//	data *record：Kafka接收到的数据
 //
 // 返回值：
 //
 //	error：处理过程中发生的错误，如果没有错误则返回nil
-func (ad *Adapter) consumerHandle(ctx context.Context, data *kafka.Data) error {
+func (ad *Adapter) consumerHandle(ctx context.Context, data *record) error {
+	if err := ad.Wait(ctx); err != nil {
+		return err
+	}
+	// 超出限制时阻塞, 由kafka保留未消费的消息; 超过每日字节配额的消息永远无法通过, 跳过
+	if err := ad.limiter.Wait(ctx, data.Topic, int64(len(data.Value))); err != nil {
+		if errors.Is(err, ratelimit.ErrQuota) {
+			ad.log.Warn(logger.ErrorKafkaConsumer, "跳过超出配额的消息", logger.ErrorField(err),
+				logger.MakeField("topic", data.Topic), logger.MakeField("partition", data.Partition),
+				logger.MakeField("offset", data.Offset))
+			return nil
+		}
+		return err
+	}
+	metrics.MessageIn(ad.GetName(), control.LaneIngress, len(data.Value))
+	span := ad.tracer.Start("stargate.kafka.consume", trace.KindConsumer, "")
+	defer span.End()
+	span.SetAttr("messaging.system", "kafka")
+	span.SetAttr("messaging.destination.name", data.Topic)
+	span.SetAttr("messaging.kafka.destination.partition", data.Partition)
+	span.SetAttr("messaging.kafka.message.offset", data.Offset)
 	msg := &structs.KafkaMessage{
+		Meta: structs.Meta{
+			StargateTime: time.Now().UnixMilli(),
+			TraceParent:  span.Traceparent(),
+		},
+		Cluster:   ad.Cluster,
 		Topic:     data.Topic,
-		Key:       string(data.Key),
+		Partition: &data.Partition,
+		Offset:    &data.Offset,
 		Value:     data.Value,
-		Timestamp: data.FaninTime.UnixMilli(),
+	}
+	if !data.Timestamp.IsZero() {
+		msg.Timestamp = data.Timestamp.UnixMilli()
+	}
+	msg.SetKey(data.Key)
+	for _, h := range data.Headers {
+		msg.Headers = append(msg.Headers, structs.KafkaHeader{Key: h.Key, Value: h.Value})
+		if !strings.EqualFold(h.Key, structs.HeaderDeliverAfter) {
+			continue
+		}
+		// 格式错误的投递时间忽略, 不阻塞消费
+		deliverAfter, errD := structs.ParseDeliverAfter(string(h.Value))
+		if errD != nil {
+			ad.log.Warn(logger.ErrorKafkaConsumer, "消息头中的投递时间", logger.ErrorField(errD),
+				logger.MakeField("topic", data.Topic))
+			continue
+		}
+		msg.DeliverAfter = deliverAfter
 	}
 	msgB, err := msg.Marshal()
 	if err != nil {
+		span.SetError(err)
 		ad.log.Error(logger.ErrorKafkaConsumer, "marshal kafka message", logger.ErrorField(err))
 		return err
 	}
 	ad.msgChan <- msgB
+	ad.seq.Next()
+	metrics.MessageOut(ad.GetName(), control.LaneIngress, len(msgB))
 	return nil
 }
 
+// Status 上报kafka模块的运行状态
+func (ad *Adapter) Status() map[string]any {
+	status := map[string]any{
+		"topics":  ad.Topics,
+		"regex":   ad.Regex,
+		"groupID": ad.GroupID,
+		"backend": ad.Backend,
+		"lastSeq": ad.seq.Last(),
+	}
+	if ad.cg != nil {
+		status["subscribed"] = ad.cg.Topics()
+	}
+	return status
+}
+
 // Run 执行监听服务
 // Run 启动Kafka消费者服务
 // ctx: 上下文对象，用于控制服务的启动和停止
@@ -127,12 +288,20 @@ func (ad *Adapter) consumerHandle(ctx context.Context, data *kafka.Data) error {
 // error: 如果服务启动失败，则返回非零的错误码；否则返回nil
 func (ad *Adapter) Run(ctx context.Context) error {
 	ad.log.Info("run stargate service for kafka consumer", logger.MakeField("addrs", ad.Addrs),
-		logger.MakeField("topics", ad.Topics))
-	if ad.cg != nil {
-		if err := ad.cg.Run(ctx); err != nil {
-			ad.log.Error(logger.ErrorKafkaConsumer, "kafka消费", logger.ErrorField(err))
+		logger.MakeField("topics", ad.Topics), logger.MakeField("regex", ad.Regex),
+		logger.MakeField("groupID", ad.GroupID), logger.MakeField("backend", ad.Backend))
+	if ad.cg == nil {
+		// 没有经过Setup(如: 由NewAdapter创建)时在此创建消费者组
+		cg, err := ad.newConsumer()
+		if err != nil {
+			ad.log.Error(logger.ErrorKafkaConsumer, "create consumer group", logger.ErrorField(err))
 			return err
 		}
+		ad.cg = cg
+	}
+	if err := ad.cg.Run(ctx); err != nil {
+		ad.log.Error(logger.ErrorKafkaConsumer, "kafka消费", logger.ErrorField(err))
+		return err
 	}
 	ad.log.Info("stargate service stop for kafka consumer")
 	return nil
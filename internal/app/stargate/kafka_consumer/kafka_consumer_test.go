@@ -0,0 +1,52 @@
+package kafkaconsumer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseOffset(t *testing.T) {
+	oldest, at, err := parseOffset("oldest")
+	assert.NoError(t, err)
+	assert.True(t, oldest)
+	assert.True(t, at.IsZero())
+
+	oldest, _, err = parseOffset("newest")
+	assert.NoError(t, err)
+	assert.False(t, oldest)
+
+	_, at, err = parseOffset("1760745600")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Unix(1760745600, 0), at)
+
+	_, at, err = parseOffset("2026-10-18T08:00:00+08:00")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1792281600), at.Unix())
+
+	_, _, err = parseOffset("yesterday")
+	assert.Error(t, err)
+}
+
+func TestNewConsumer(t *testing.T) {
+	// NewAdapter不创建消费者组, 参数错误在连接kafka之前返回
+	ad := NewAdapter([]string{"127.0.0.1:1"}, []string{"orders"}, nil)
+	assert.Nil(t, ad.cg)
+	assert.Equal(t, defaultGroupID, ad.GroupID)
+	assert.Error(t, NewAdapter([]string{"127.0.0.1:1"}, []string{"orders"}, nil, WithBackend("rdkafka")).Run(context.Background()))
+
+	for _, ops := range [][]OptionFunc{
+		{WithBackend("rdkafka")},
+		{WithOffset("yesterday")},
+		{WithTopicRegex("orders.(", time.Minute)},
+		{WithTopicRegex("orders", 0)},
+	} {
+		ad = NewAdapter([]string{"127.0.0.1:1"}, []string{"orders"}, nil, ops...)
+		_, err := ad.newConsumer()
+		assert.Error(t, err)
+	}
+	_, err := NewAdapter([]string{"127.0.0.1:1"}, nil, nil, WithBackend(BackendConfluent)).newConsumer()
+	assert.Error(t, err)
+}
@@ -0,0 +1,525 @@
+package wsserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/chengfeiZhou/Wormhole/internal/app/stargate"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/auth"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/control"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/metrics"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/policy"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/ratelimit"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/structs"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/tracking"
+	"github.com/chengfeiZhou/Wormhole/pkg/certs"
+	"github.com/chengfeiZhou/Wormhole/pkg/logger"
+	types "github.com/chengfeiZhou/Wormhole/pkg/structs"
+	"github.com/chengfeiZhou/Wormhole/pkg/trace"
+)
+
+// nolint
+type Adapter struct {
+	control.Switch // 暂停时拒绝新连接, 已有连接停止读取
+	log            logger.Logger
+	listen         string
+	msgChan        chan<- []byte // 报文转移通道
+	seq            control.Sequence
+	bound          atomic.Bool // 是否已经完成端口监听
+	tracer         *trace.Tracer
+	tracker        *tracking.Tracker
+	certs          *certs.Reloader    // 不为空时启用TLS(wss)
+	authn          auth.Chain         // 不为空时在握手时校验调用方
+	limiter        *ratelimit.Limiter // 不为空时按调用方限流, 超出时暂停读取该连接
+	policy         *policy.Policy     // 不为空时检查握手请求
+	upgrader       websocket.Upgrader
+	maxConns       int           // 连接数上限, 0不限制
+	maxFrameSize   int64         // 单帧上限
+	stall          time.Duration // 帧无法写入搬运通道的最长等待, 0一直等待
+	ping           time.Duration // 心跳间隔, 0不发送
+	ack            bool          // 每帧写入搬运通道后回复报文ID
+	ctx            context.Context
+	mu             sync.Mutex
+	conns          map[*websocket.Conn]struct{}
+	reserved       int // 已占用的连接名额, 包括握手中的连接
+}
+
+type OptionFunc func(*Adapter)
+
+// WithLogger 设置日志记录器
+func WithLogger(log logger.Logger) OptionFunc {
+	return func(a *Adapter) {
+		a.log = log
+	}
+}
+
+// WithListen 设置监听地址
+func WithListen(listen string) OptionFunc {
+	return func(a *Adapter) {
+		a.listen = listen
+	}
+}
+
+// WithTLS 启用TLS(wss), certs负责证书的加载和热更新
+func WithTLS(r *certs.Reloader) OptionFunc {
+	return func(a *Adapter) {
+		a.certs = r
+	}
+}
+
+// WithAuth 设置调用方认证
+func WithAuth(c auth.Chain) OptionFunc {
+	return func(a *Adapter) {
+		a.authn = c
+	}
+}
+
+// WithRateLimit 设置调用方限流与每日配额
+func WithRateLimit(l *ratelimit.Limiter) OptionFunc {
+	return func(a *Adapter) {
+		a.limiter = l
+	}
+}
+
+// WithPolicy 设置握手请求的策略
+func WithPolicy(p *policy.Policy) OptionFunc {
+	return func(a *Adapter) {
+		a.policy = p
+	}
+}
+
+// WithLimits 设置连接数上限(0不限制)和单帧上限
+func WithLimits(maxConns int, maxFrameSize int64) OptionFunc {
+	return func(a *Adapter) {
+		a.maxConns = maxConns
+		a.maxFrameSize = maxFrameSize
+	}
+}
+
+// WithBackpressure 设置帧无法写入搬运通道时的最长等待(0一直等待)以及心跳间隔(0不发送)
+func WithBackpressure(stall, ping time.Duration) OptionFunc {
+	return func(a *Adapter) {
+		a.stall = stall
+		a.ping = ping
+	}
+}
+
+// WithAck 每帧写入搬运通道后回复报文ID
+func WithAck(ack bool) OptionFunc {
+	return func(a *Adapter) {
+		a.ack = ack
+	}
+}
+
+// NewAdapter 创建websocket接收模块
+func NewAdapter(msgChan chan<- []byte, ops ...OptionFunc) *Adapter {
+	ad := &Adapter{
+		log:          logger.DefaultLogger(),
+		msgChan:      msgChan,
+		listen:       "0.0.0.0:8090",
+		maxFrameSize: 1 << 20,
+		stall:        30 * time.Second,
+		ping:         30 * time.Second,
+		ctx:          context.Background(),
+		conns:        make(map[*websocket.Conn]struct{}),
+	}
+	for _, op := range ops {
+		op(ad)
+	}
+	return ad
+}
+
+// GetName 返回模块名称 "websocket"
+func (a *Adapter) GetName() string {
+	return "websocket"
+}
+
+// Setup 根据应用配置初始化模块
+func (a *Adapter) Setup(app *stargate.App, msgChan chan<- []byte) error {
+	a.msgChan = msgChan
+	a.log = app.Logger
+	a.listen = app.Config.WSListen
+	a.tracer = app.Tracer()
+	a.tracker = app.Tracker()
+	a.ctx = context.Background()
+	a.conns = make(map[*websocket.Conn]struct{})
+	WithLimits(app.Config.WSMaxConns, app.Config.WSMaxFrameSize)(a)
+	WithBackpressure(time.Duration(app.Config.WSStallTimeout)*time.Second,
+		time.Duration(app.Config.WSPingInterval)*time.Second)(a)
+	WithAck(app.Config.WSAck)(a)
+	if conf := app.Config; conf.TLSCert != "" {
+		ops := []certs.OptionFunc{certs.WithLogger(a.log)}
+		if conf.TLSClientCA != "" {
+			ops = append(ops, certs.WithClientCA(conf.TLSClientCA, conf.TLSClientAuth))
+		}
+		r, err := certs.NewReloader(conf.TLSCert, conf.TLSKey, ops...)
+		if err != nil {
+			a.log.Error(logger.ErrorTLS, "加载TLS证书", logger.ErrorField(err))
+			return err
+		}
+		a.certs = r
+	}
+	authn, err := auth.NewChain(auth.Options{
+		APIKeys:     app.Config.AuthAPIKeys,
+		HMACKeys:    app.Config.AuthHMACKeys,
+		HMACWindow:  time.Duration(app.Config.AuthHMACWindow) * time.Second,
+		JWKS:        app.Config.AuthJWKS,
+		JWTIssuer:   app.Config.AuthJWTIssuer,
+		JWTAudience: app.Config.AuthJWTAudience,
+	})
+	if err != nil {
+		a.log.Error(logger.ErrorAuthFailed, "加载认证配置", logger.ErrorField(err))
+		return err
+	}
+	a.authn = authn
+	if !a.authn.Enabled() {
+		a.log.Warn(logger.ErrorAuthFailed, "websocket接收模块未启用调用方认证")
+	}
+	if app.Config.RateLimits != "" {
+		conf, errL := ratelimit.LoadConfig(app.Config.RateLimits)
+		if errL != nil {
+			a.log.Error(logger.ErrorParam, "加载限流配置", logger.ErrorField(errL))
+			return errL
+		}
+		a.limiter = ratelimit.New(conf)
+	}
+	if app.Config.Policy != "" {
+		if a.policy, err = policy.Load(app.Config.Policy); err != nil {
+			a.log.Error(logger.ErrorParam, "加载请求策略", logger.ErrorField(err))
+			return err
+		}
+	}
+	app.Health().Liveness(a.GetName(), "listener", a.checkListener)
+	return nil
+}
+
+// Help 打印websocket模块的帮助信息
+func (a *Adapter) Help() {
+	fmt.Println("websocket module help")
+	fmt.Println("  -wsListen       监听地址, 任意路径均可握手")
+	fmt.Println("  -wsMaxConns     连接数上限")
+	fmt.Println("  -wsMaxFrameSize 单帧上限(byte)")
+	fmt.Println("  -wsStallTimeout 帧无法写入搬运通道的最长等待(s)")
+	fmt.Println("  -wsPingInterval 心跳间隔(s)")
+	fmt.Println("  -wsAck          每帧回复报文ID")
+}
+
+// ServeHTTP 校验握手请求并升级为websocket连接, 连接关闭前不返回
+func (a *Adapter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if a.Paused() {
+		a.response(w, http.StatusServiceUnavailable, "请求转发已暂停")
+		return
+	}
+	if !websocket.IsWebSocketUpgrade(r) {
+		a.response(w, http.StatusBadRequest, "需要websocket握手请求")
+		return
+	}
+	// 握手之前占用名额, 并发的握手不会超过上限
+	if !a.reserve() {
+		a.log.Warn(logger.ErrorWebSocket, "websocket连接数达到上限", logger.MakeField("remote", r.RemoteAddr),
+			logger.MakeField("maxConns", a.maxConns))
+		a.response(w, http.StatusServiceUnavailable, "连接数达到上限")
+		return
+	}
+	defer a.unreserve()
+	// 连接上的所有帧共享同一个span, 延续握手请求中的链路
+	span := a.tracer.Start("stargate.websocket.conn", trace.KindServer, r.Header.Get(trace.HeaderTraceparent))
+	defer span.End()
+	span.SetAttr("url.path", r.URL.Path)
+	span.SetAttr("client.address", r.RemoteAddr)
+	meta := &structs.WSConn{
+		ID:             tracking.NewID(),
+		Path:           r.URL.Path,
+		RawQuery:       r.URL.RawQuery,
+		RemoteAddr:     r.RemoteAddr,
+		ClientIdentity: structs.VerifiedClientIdentity(r.TLS),
+	}
+	span.SetAttr("wormhole.conn", meta.ID)
+	if a.authn.Enabled() {
+		sum := sha256.Sum256(nil)
+		principal, err := a.authn.Authenticate(r, sum[:])
+		if err != nil {
+			span.SetError(err)
+			a.log.Warn(logger.ErrorAuthFailed, "调用方认证失败", logger.ErrorField(err),
+				logger.MakeField("remote", r.RemoteAddr), logger.MakeField("path", r.URL.Path))
+			a.response(w, http.StatusUnauthorized, "未授权的请求")
+			return
+		}
+		a.authn.Strip(r.Header)
+		meta.Principal = principal
+		span.SetAttr("enduser.id", principal.Subject)
+	}
+	if a.policy != nil {
+		hs := &structs.HTTPMessage{Method: r.Method, Path: r.URL.Path, RawQuery: r.URL.RawQuery, Header: r.Header}
+		if err := a.policy.Check(hs); err != nil {
+			span.SetError(err)
+			a.log.Warn(logger.ErrorPolicyDenied, "请求被策略拒绝", logger.ErrorField(err),
+				logger.MakeField("remote", r.RemoteAddr), logger.MakeField("path", r.URL.Path))
+			a.response(w, http.StatusForbidden, "请求被策略拒绝")
+			return
+		}
+	}
+	conn, err := a.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade已经向调用方回复了错误
+		span.SetError(err)
+		a.log.Warn(logger.ErrorWebSocket, "websocket握手失败", logger.ErrorField(err), logger.MakeField("remote", r.RemoteAddr))
+		return
+	}
+	meta.Subprotocol = conn.Subprotocol()
+	meta.ConnectedAt = time.Now().UnixMilli()
+	a.track(conn, true)
+	defer a.track(conn, false)
+	defer conn.Close()
+	a.log.Info("websocket连接建立", logger.MakeField("conn", meta.ID), logger.MakeField("remote", meta.RemoteAddr),
+		logger.MakeField("path", meta.Path), logger.MakeField("traceId", span.Context().TraceIDString()))
+	frames, err := a.serveConn(conn, meta, span)
+	if err != nil {
+		span.SetError(err)
+	}
+	span.SetAttr("wormhole.frames", frames)
+	a.log.Info("websocket连接关闭", logger.MakeField("conn", meta.ID), logger.MakeField("frames", frames),
+		logger.MakeField("reason", fmt.Sprint(err)))
+}
+
+// serveConn 按顺序读取连接上的帧并写入搬运通道, 返回已搬运的帧数和连接结束的原因
+// 读取与写入在同一个goroutine中: 搬运通道阻塞或超出限流时不再读取, 由TCP窗口将压力传递给调用方
+func (a *Adapter) serveConn(conn *websocket.Conn, meta *structs.WSConn, span *trace.Span) (uint64, error) {
+	conn.SetReadLimit(a.maxFrameSize)
+	if a.ping > 0 {
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(2 * a.ping))
+		})
+		done := make(chan struct{})
+		defer close(done)
+		go a.keepalive(conn, done)
+	}
+	key := a.limitKey(meta)
+	var frames uint64
+	for {
+		if resumed := a.Resumed(); resumed != nil {
+			// 暂停期间不读取
+			select {
+			case <-resumed:
+			case <-a.ctx.Done():
+				return frames, a.ctx.Err()
+			}
+		}
+		if a.ping > 0 {
+			// 只计算等待调用方的时间, 不包括限流和搬运通道阻塞的时间
+			_ = conn.SetReadDeadline(time.Now().Add(2 * a.ping))
+		}
+		typ, data, err := conn.ReadMessage()
+		if err != nil {
+			if errors.Is(err, websocket.ErrReadLimit) {
+				a.log.Warn(logger.ErrorWebSocket, "websocket帧超出上限", logger.MakeField("conn", meta.ID),
+					logger.MakeField("maxFrameSize", a.maxFrameSize))
+				a.closeConn(conn, websocket.CloseMessageTooBig, "frame too large")
+			}
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				return frames, nil
+			}
+			return frames, err
+		}
+		if err = a.limiter.Wait(a.ctx, key, int64(len(data))); err != nil {
+			if errors.Is(err, ratelimit.ErrQuota) {
+				// 超过每日字节配额的帧永远无法通过, 跳过
+				a.log.Warn(logger.ErrorWebSocket, "跳过超出配额的websocket帧", logger.ErrorField(err),
+					logger.MakeField("conn", meta.ID))
+				continue
+			}
+			return frames, err
+		}
+		msg := &structs.WSMessage{Conn: meta, Seq: frames + 1, Type: structs.WSFrameText, Data: data}
+		if typ == websocket.BinaryMessage {
+			msg.Type = structs.WSFrameBinary
+		}
+		msg.ID = tracking.NewID()
+		msg.StargateTime = time.Now().UnixMilli()
+		msg.TraceParent = span.Traceparent()
+		metrics.MessageIn(a.GetName(), control.LaneIngress, len(data))
+		msgB, err := msg.Marshal()
+		if err != nil {
+			return frames, err
+		}
+		a.tracker.Queued(msg.ID)
+		if err = a.enqueue(msgB); err != nil {
+			a.tracker.Failed(msg.ID, err)
+			a.log.Warn(logger.ErrorWebSocket, "搬运通道阻塞, 关闭websocket连接", logger.ErrorField(err),
+				logger.MakeField("conn", meta.ID), logger.MakeField("stall", a.stall.String()))
+			a.closeConn(conn, websocket.CloseTryAgainLater, "stalled")
+			return frames, err
+		}
+		frames = msg.Seq
+		metrics.MessageOut(a.GetName(), control.LaneIngress, len(msgB))
+		a.log.Debugf("接收到websocket帧 seq=%d conn=%s frame=%d size=%d id=%s",
+			a.seq.Next(), meta.ID, msg.Seq, len(data), msg.ID)
+		if a.ack {
+			if err = conn.WriteJSON(map[string]any{"seq": msg.Seq, "id": msg.ID}); err != nil {
+				return frames, err
+			}
+		}
+	}
+}
+
+// enqueue 写入搬运通道, 超过stall仍无法写入时返回错误
+func (a *Adapter) enqueue(msgB []byte) error {
+	if a.stall <= 0 {
+		a.msgChan <- msgB
+		return nil
+	}
+	t := time.NewTimer(a.stall)
+	defer t.Stop()
+	select {
+	case a.msgChan <- msgB:
+		return nil
+	case <-t.C:
+		return fmt.Errorf("搬运通道%s内无法写入", a.stall)
+	}
+}
+
+// keepalive 定时发送ping, done关闭时退出
+func (a *Adapter) keepalive(conn *websocket.Conn, done <-chan struct{}) {
+	t := time.NewTicker(a.ping)
+	defer t.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(a.ping)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// closeConn 发送关闭帧
+func (a *Adapter) closeConn(conn *websocket.Conn, code int, text string) {
+	_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(time.Second))
+}
+
+// track 登记或注销连接
+func (a *Adapter) track(conn *websocket.Conn, add bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if add {
+		a.conns[conn] = struct{}{}
+		return
+	}
+	delete(a.conns, conn)
+}
+
+// reserve 占用一个连接名额, 达到maxConns时返回false; 握手失败或连接关闭后调用unreserve释放
+func (a *Adapter) reserve() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.maxConns > 0 && a.reserved >= a.maxConns {
+		return false
+	}
+	a.reserved++
+	return true
+}
+
+func (a *Adapter) unreserve() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.reserved--
+}
+
+func (a *Adapter) connCount() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.conns)
+}
+
+// limitKey 按限流维度返回调用方, 按路由限流时使用握手路径
+func (a *Adapter) limitKey(meta *structs.WSConn) string {
+	switch a.limiter.Key() {
+	case ratelimit.KeyPrincipal:
+		if meta.Principal != nil {
+			return meta.Principal.Method + ":" + meta.Principal.Subject
+		}
+	case ratelimit.KeyRoute:
+		return meta.Path
+	}
+	host, _, err := net.SplitHostPort(meta.RemoteAddr)
+	if err != nil {
+		return meta.RemoteAddr
+	}
+	return host
+}
+
+// response 拒绝握手请求
+func (a *Adapter) response(w http.ResponseWriter, code int, message string) {
+	msb, _ := json.Marshal(&types.HttpRespData{Code: -1, Message: message, Data: nil})
+	w.WriteHeader(code)
+	_, _ = w.Write(msb)
+}
+
+// Status 上报websocket模块的运行状态
+func (a *Adapter) Status() map[string]any {
+	st := map[string]any{
+		"listen":  a.listen,
+		"lastSeq": a.seq.Last(),
+		"tls":     a.certs != nil,
+		"auth":    a.authn.Names(),
+		"conns":   a.connCount(),
+	}
+	if a.limiter != nil {
+		st["rateLimitKey"] = a.limiter.Key()
+	}
+	return st
+}
+
+// Run 启动websocket服务, ctx结束时关闭所有连接
+func (a *Adapter) Run(ctx context.Context) error {
+	a.log.Info("run service for websocket", logger.MakeField("listen", a.listen))
+	a.ctx = ctx
+	// 握手超时; 升级后的连接由心跳和wsStallTimeout控制
+	svc := &http.Server{Handler: a, ReadHeaderTimeout: 10 * time.Second, MaxHeaderBytes: 1 << 20}
+	ln, err := net.Listen("tcp", a.listen)
+	if err != nil {
+		a.log.Error(logger.ErrorHTTPHandle, "websocket服务监听", logger.ErrorField(err))
+		return err
+	}
+	if a.certs != nil {
+		ln = tls.NewListener(ln, a.certs.ServerConfig())
+	}
+	a.bound.Store(true)
+	defer a.bound.Store(false)
+	go func() {
+		<-ctx.Done()
+		_ = svc.Close()
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		for conn := range a.conns {
+			a.closeConn(conn, websocket.CloseGoingAway, "shutdown")
+			_ = conn.Close()
+		}
+	}()
+	if err := svc.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		a.log.Error(logger.ErrorHTTPHandle, "websocket服务", logger.ErrorField(err))
+		return err
+	}
+	return nil
+}
+
+// checkListener 健康检查: 服务端口是否已经完成监听
+func (a *Adapter) checkListener(ctx context.Context) error {
+	if !a.bound.Load() {
+		return fmt.Errorf("端口未监听: %s", a.listen)
+	}
+	return nil
+}
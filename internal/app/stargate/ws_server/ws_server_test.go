@@ -0,0 +1,173 @@
+package wsserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/auth"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/policy"
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/structs"
+)
+
+func writeJSON(t *testing.T, name string, v any) string {
+	data, err := json.Marshal(v)
+	assert.NoError(t, err)
+	file := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(file, data, 0o600))
+	return file
+}
+
+// serve 启动websocket接收模块, 返回ws://地址
+func serve(t *testing.T, a *Adapter) string {
+	srv := httptest.NewServer(a)
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+// dial 握手, 失败时返回HTTP状态码
+func dial(t *testing.T, url string, header http.Header) (*websocket.Conn, int) {
+	conn, resp, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		assert.ErrorIs(t, err, websocket.ErrBadHandshake)
+		defer resp.Body.Close()
+		return nil, resp.StatusCode
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn, resp.StatusCode
+}
+
+// closeCode 读取直到连接关闭, 返回关闭帧的状态码
+func closeCode(t *testing.T, conn *websocket.Conn) int {
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		var ce *websocket.CloseError
+		if assert.ErrorAs(t, err, &ce) {
+			return ce.Code
+		}
+		return 0
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	authn, err := auth.NewChain(auth.Options{APIKeys: writeJSON(t, "keys.json", map[string]string{"app": "key1"})})
+	assert.NoError(t, err)
+	pol, err := policy.Load(writeJSON(t, "policy.json", map[string]any{
+		"rules": []map[string]any{{"path": "/ws/**", "methods": []string{"GET"}}},
+	}))
+	assert.NoError(t, err)
+	msgChan := make(chan []byte, 10)
+	url := serve(t, NewAdapter(msgChan, WithAuth(authn), WithPolicy(pol), WithBackpressure(time.Second, 0), WithAck(true)))
+	header := http.Header{auth.HeaderAPIKey: {"key1"}}
+
+	// 认证与策略在握手时检查, 失败时不建立连接
+	_, code := dial(t, url+"/ws/orders", nil)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	_, code = dial(t, url+"/ws/orders", http.Header{auth.HeaderAPIKey: {"bad"}})
+	assert.Equal(t, http.StatusUnauthorized, code)
+	_, code = dial(t, url+"/admin", header)
+	assert.Equal(t, http.StatusForbidden, code)
+	_, code = dial(t, url+"/ws/../admin", header)
+	assert.Equal(t, http.StatusForbidden, code)
+
+	// 每帧写入搬运通道后回复报文ID
+	conn, code := dial(t, url+"/ws/orders?x=1", header)
+	assert.Equal(t, http.StatusSwitchingProtocols, code)
+	for i, frame := range []string{"a", "b"} {
+		assert.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(frame)))
+		ack := struct {
+			Seq uint64 `json:"seq"`
+			ID  string `json:"id"`
+		}{}
+		assert.NoError(t, conn.ReadJSON(&ack))
+		assert.Equal(t, uint64(i+1), ack.Seq)
+
+		msg := new(structs.WSMessage)
+		assert.NoError(t, msg.Unmarshal(<-msgChan))
+		assert.Equal(t, ack.ID, msg.ID)
+		assert.Equal(t, ack.Seq, msg.Seq)
+		assert.Equal(t, []byte(frame), msg.Data)
+		assert.Equal(t, structs.WSFrameText, msg.Type)
+		assert.Equal(t, "/ws/orders", msg.Conn.Path)
+		assert.Equal(t, "x=1", msg.Conn.RawQuery)
+		assert.Equal(t, "app", msg.Conn.Principal.Subject)
+	}
+}
+
+func TestFrameLimit(t *testing.T) {
+	msgChan := make(chan []byte, 10)
+	url := serve(t, NewAdapter(msgChan, WithLimits(0, 8), WithBackpressure(time.Second, 0)))
+	conn, _ := dial(t, url, nil)
+	assert.NoError(t, conn.WriteMessage(websocket.BinaryMessage, []byte("12345678")))
+	assert.NoError(t, conn.WriteMessage(websocket.BinaryMessage, []byte("123456789")))
+	assert.Equal(t, websocket.CloseMessageTooBig, closeCode(t, conn))
+	// 超出上限之前的帧正常搬运
+	assert.Len(t, msgChan, 1)
+}
+
+func TestStall(t *testing.T) {
+	msgChan := make(chan []byte, 1)
+	url := serve(t, NewAdapter(msgChan, WithBackpressure(50*time.Millisecond, 0)))
+	conn, _ := dial(t, url, nil)
+	assert.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte("a")))
+	// 搬运通道已满, 超过stall后关闭连接
+	assert.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte("b")))
+	assert.Equal(t, websocket.CloseTryAgainLater, closeCode(t, conn))
+	assert.Len(t, msgChan, 1)
+}
+
+func TestMaxConns(t *testing.T) {
+	a := NewAdapter(make(chan []byte, 1), WithLimits(1, 1024), WithBackpressure(time.Second, 0))
+	url := serve(t, a)
+	_, code := dial(t, url, nil)
+	assert.Equal(t, http.StatusSwitchingProtocols, code)
+	assert.Eventually(t, func() bool { return a.connCount() == 1 }, time.Second, 10*time.Millisecond)
+	_, code = dial(t, url, nil)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+}
+
+func TestMaxConnsConcurrent(t *testing.T) {
+	a := NewAdapter(make(chan []byte, 1), WithLimits(3, 1024), WithBackpressure(time.Second, 0))
+	url := serve(t, a)
+	// 握手中的连接同样占用名额
+	assert.True(t, a.reserve())
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+		ok int
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, resp, err := websocket.DefaultDialer.Dial(url, nil)
+			if err != nil {
+				assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+				_ = resp.Body.Close()
+				return
+			}
+			t.Cleanup(func() { _ = conn.Close() })
+			mu.Lock()
+			ok++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 2, ok)
+	a.unreserve()
+	_, code := dial(t, url, nil)
+	assert.Equal(t, http.StatusSwitchingProtocols, code)
+}
@@ -0,0 +1,276 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chengfeiZhou/Wormhole/pkg/logger"
+	types "github.com/chengfeiZhou/Wormhole/pkg/structs"
+	"github.com/gin-contrib/pprof"
+	"github.com/gin-gonic/gin"
+)
+
+// Controller admin API操作的目标, 由stargate.App和dimension.App实现
+type Controller interface {
+	Status() map[string]any
+	Pause(lane string) error
+	Resume(lane string) error
+	Rotate() error
+	Rescan() error
+}
+
+// Server 管理端HTTP服务
+// nolint
+type Server struct {
+	log    logger.Logger
+	ctl    Controller
+	listen string // tcp监听地址
+	socket string // unix socket路径, 非空时优先使用
+	token  string // 鉴权token, 为空时不鉴权(只允许监听本机地址或unix socket)
+	engine *gin.Engine
+	api    *gin.RouterGroup
+	public map[string]bool // 不需要鉴权的路径
+}
+
+type OptionFunc func(*Server)
+
+// WithLogger 设置Server的日志记录器
+func WithLogger(log logger.Logger) OptionFunc {
+	return func(s *Server) {
+		s.log = log
+	}
+}
+
+// WithListen 设置Server的tcp监听地址
+func WithListen(listen string) OptionFunc {
+	return func(s *Server) {
+		s.listen = listen
+	}
+}
+
+// WithSocket 设置Server监听的unix socket路径, 设置后不再监听tcp地址
+func WithSocket(path string) OptionFunc {
+	return func(s *Server) {
+		s.socket = path
+	}
+}
+
+// WithToken 设置访问管理接口所需的Bearer token
+func WithToken(token string) OptionFunc {
+	return func(s *Server) {
+		s.token = token
+	}
+}
+
+// NewServer 创建管理端服务
+// ctl: 被管理的应用
+// ops: 可选的OptionFunc函数列表
+func NewServer(ctl Controller, ops ...OptionFunc) *Server {
+	s := &Server{
+		log:    logger.DefaultLogger(),
+		ctl:    ctl,
+		public: make(map[string]bool),
+	}
+	for _, op := range ops {
+		op(s)
+	}
+	gin.SetMode(gin.ReleaseMode)
+	s.engine = gin.New()
+	s.engine.Use(gin.Recovery(), s.auth)
+	pprof.Register(s.engine) // 性能
+	s.api = s.engine.Group("/admin")
+	s.api.GET("/status", s.status)
+	s.api.POST("/:lane/pause", s.pause)
+	s.api.POST("/:lane/resume", s.resume)
+	s.api.POST("/rotate", s.rotate)
+	s.api.POST("/rescan", s.rescan)
+	s.api.GET("/logger/level", s.getLevel)
+	s.api.PUT("/logger/level", s.setLevel)
+	return s
+}
+
+// Enabled 是否配置了监听地址
+func (s *Server) Enabled() bool {
+	return s.listen != "" || s.socket != ""
+}
+
+// Check 检查配置: 没有鉴权token时只允许监听本机地址或unix socket
+func (s *Server) Check() error {
+	if s.Enabled() && s.token == "" && s.socket == "" && !loopback(s.listen) {
+		return fmt.Errorf("admin接口监听非本机地址%s时必须设置鉴权token", s.listen)
+	}
+	return nil
+}
+
+// Handle 在根路径下注册额外的处理器(如: /metrics)
+func (s *Server) Handle(method, path string, h http.Handler) {
+	s.engine.Handle(method, path, gin.WrapH(h))
+}
+
+// HandlePublic 在根路径下注册不需要鉴权的处理器(如: 健康检查)
+func (s *Server) HandlePublic(method, path string, h http.Handler) {
+	s.public[path] = true
+	s.engine.Handle(method, path, gin.WrapH(h))
+}
+
+// HandleAPI 在/admin路径下注册额外的处理器
+func (s *Server) HandleAPI(method, path string, h gin.HandlerFunc) {
+	s.api.Handle(method, path, h)
+}
+
+// auth 校验Bearer token
+func (s *Server) auth(c *gin.Context) {
+	if s.token == "" || s.public[c.FullPath()] {
+		c.Next()
+		return
+	}
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, &types.HttpRespData{Code: -1, Message: "未授权的访问"})
+		return
+	}
+	c.Next()
+}
+
+func (s *Server) status(c *gin.Context) {
+	ok(c, s.ctl.Status())
+}
+
+func (s *Server) pause(c *gin.Context) {
+	lane := c.Param("lane")
+	if err := s.ctl.Pause(lane); err != nil {
+		fail(c, err)
+		return
+	}
+	s.log.Info("admin: 暂停", logger.MakeField("lane", lane))
+	ok(c, nil)
+}
+
+func (s *Server) resume(c *gin.Context) {
+	lane := c.Param("lane")
+	if err := s.ctl.Resume(lane); err != nil {
+		fail(c, err)
+		return
+	}
+	s.log.Info("admin: 恢复", logger.MakeField("lane", lane))
+	ok(c, nil)
+}
+
+func (s *Server) rotate(c *gin.Context) {
+	if err := s.ctl.Rotate(); err != nil {
+		fail(c, err)
+		return
+	}
+	s.log.Info("admin: 切换搬运文件")
+	ok(c, nil)
+}
+
+func (s *Server) rescan(c *gin.Context) {
+	if err := s.ctl.Rescan(); err != nil {
+		fail(c, err)
+		return
+	}
+	s.log.Info("admin: 重新扫描搬运目录")
+	ok(c, nil)
+}
+
+func (s *Server) getLevel(c *gin.Context) {
+	ok(c, map[string]any{"level": s.log.GetLevel()})
+}
+
+func (s *Server) setLevel(c *gin.Context) {
+	req := struct {
+		Level string `json:"level"`
+	}{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		fail(c, err)
+		return
+	}
+	lv, err := logger.ParseLevel(req.Level)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	s.log.SetLevel(lv)
+	s.log.Info("admin: 设置日志级别", logger.MakeField("level", s.log.GetLevel()))
+	ok(c, map[string]any{"level": s.log.GetLevel()})
+}
+
+func ok(c *gin.Context, data map[string]any) {
+	c.JSON(http.StatusOK, &types.HttpRespData{Code: 0, Message: "ok", Data: data})
+}
+
+func fail(c *gin.Context, err error) {
+	c.JSON(http.StatusBadRequest, &types.HttpRespData{Code: -1, Message: err.Error()})
+}
+
+// loopback 监听地址是否只能从本机访问
+func loopback(listen string) bool {
+	host, _, err := net.SplitHostPort(listen)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// listener 根据配置创建监听
+func (s *Server) listener() (net.Listener, error) {
+	if s.socket == "" {
+		return net.Listen("tcp", s.listen)
+	}
+	if err := os.RemoveAll(s.socket); err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", s.socket)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(s.socket, 0o600); err != nil {
+		_ = ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// Run 启动管理端服务, ctx结束时关闭服务
+func (s *Server) Run(ctx context.Context) error {
+	if !s.Enabled() {
+		return nil
+	}
+	if err := s.Check(); err != nil {
+		s.log.Error(logger.ErrorAdminServer, "admin监听", logger.ErrorField(err))
+		return err
+	}
+	ln, err := s.listener()
+	if err != nil {
+		s.log.Error(logger.ErrorAdminServer, "admin监听", logger.ErrorField(err))
+		return err
+	}
+	s.log.Info("run admin service", logger.MakeField("addr", ln.Addr().String()))
+	svc := &http.Server{
+		Handler:           s.engine,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		sctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = svc.Shutdown(sctx)
+	}()
+	if err := svc.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		s.log.Error(logger.ErrorAdminServer, "admin服务", logger.ErrorField(err))
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package admin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheck(t *testing.T) {
+	for listen, ok := range map[string]bool{
+		"127.0.0.1:3000": true,
+		"localhost:3000": true,
+		"[::1]:3000":     true,
+		"0.0.0.0:3000":   false,
+		":3000":          false,
+		"10.0.0.1:3000":  false,
+	} {
+		err := NewServer(nil, WithListen(listen)).Check()
+		assert.Equal(t, ok, err == nil, listen)
+		// 设置token后允许监听任意地址
+		assert.NoError(t, NewServer(nil, WithListen(listen), WithToken("secret")).Check(), listen)
+	}
+	assert.NoError(t, NewServer(nil, WithListen("0.0.0.0:3000"), WithSocket("/tmp/admin.sock")).Check())
+	assert.NoError(t, NewServer(nil).Check())
+}
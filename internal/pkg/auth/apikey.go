@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/structs"
+)
+
+const (
+	HeaderAPIKey = "X-Wormhole-Api-Key"
+
+	sha256Prefix = "sha256:"
+)
+
+// APIKey 静态API key认证
+// nolint
+type APIKey struct {
+	keys map[string][]byte // 名称 => sha256(key)
+}
+
+// NewAPIKey 从JSON文件加载API key
+// 文件格式: {"名称": "key"}, key也可以写成 "sha256:<16进制摘要>" 以避免明文保存
+func NewAPIKey(path string) (*APIKey, error) {
+	raw := map[string]string{}
+	if err := loadJSON(path, &raw); err != nil {
+		return nil, err
+	}
+	a := &APIKey{keys: make(map[string][]byte, len(raw))}
+	for name, key := range raw {
+		if strings.HasPrefix(key, sha256Prefix) {
+			sum, err := hex.DecodeString(strings.TrimPrefix(key, sha256Prefix))
+			if err != nil || len(sum) != sha256.Size {
+				return nil, fmt.Errorf("API key摘要格式错误: %s", name)
+			}
+			a.keys[name] = sum
+			continue
+		}
+		sum := sha256.Sum256([]byte(key))
+		a.keys[name] = sum[:]
+	}
+	return a, nil
+}
+
+// Name 实现Authenticator
+func (a *APIKey) Name() string {
+	return MethodAPIKey
+}
+
+// Authenticate 实现Authenticator
+func (a *APIKey) Authenticate(r *http.Request, _ []byte) (*structs.Principal, error) {
+	key := r.Header.Get(HeaderAPIKey)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+	sum := sha256.Sum256([]byte(key))
+	var matched string
+	// 比较所有key, 耗时与匹配位置无关
+	for name, want := range a.keys {
+		if subtle.ConstantTimeCompare(sum[:], want) == 1 {
+			matched = name
+		}
+	}
+	if matched == "" {
+		return nil, ErrInvalid
+	}
+	return &structs.Principal{Method: MethodAPIKey, Subject: matched}, nil
+}
+
+// Strip 删除API key请求头
+func (a *APIKey) Strip(h http.Header) {
+	h.Del(HeaderAPIKey)
+}
+
+func loadJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("解析%s: %w", path, err)
+	}
+	return nil
+}
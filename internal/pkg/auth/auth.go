@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/structs"
+)
+
+const (
+	MethodAPIKey = "apikey"
+	MethodHMAC   = "hmac"
+	MethodJWT    = "jwt"
+)
+
+var (
+	// ErrNoCredentials 请求中没有该认证方式的凭证, 由Chain继续尝试下一种方式
+	ErrNoCredentials = errors.New("缺少认证凭证")
+	ErrInvalid       = errors.New("认证凭证无效")
+	// ErrNeedBody 凭证中包含请求体的摘要(HMAC), 请求头检查通过, 需要读取请求体后再校验
+	ErrNeedBody = errors.New("需要请求体摘要")
+)
+
+// Authenticator 认证方式
+type Authenticator interface {
+	// Name 认证方式名称
+	Name() string
+	// Authenticate 校验请求, bodySum为请求体的sha256
+	// (请求体可能已落盘, 不再保留在内存中, 所以只提供摘要)
+	// 请求中没有该方式的凭证时返回ErrNoCredentials;
+	// bodySum为nil时只校验请求头, 需要请求体摘要的方式检查请求头后返回ErrNeedBody
+	Authenticate(r *http.Request, bodySum []byte) (*structs.Principal, error)
+}
+
+// Chain 依次尝试多种认证方式, 任意一种通过即认证成功
+type Chain []Authenticator
+
+// Enabled 是否配置了认证方式
+func (c Chain) Enabled() bool {
+	return len(c) > 0
+}
+
+// Authenticate 依次尝试各认证方式
+// 某种方式的凭证存在但校验失败时直接返回错误, 不再尝试其它方式
+func (c Chain) Authenticate(r *http.Request, bodySum []byte) (*structs.Principal, error) {
+	for _, a := range c {
+		p, err := a.Authenticate(r, bodySum)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+	return nil, ErrNoCredentials
+}
+
+// AuthenticateHeader 读取请求体之前只按请求头认证, 未认证的请求不必读取请求体
+// 返回ErrNeedBody时需要读取请求体后调用Authenticate
+func (c Chain) AuthenticateHeader(r *http.Request) (*structs.Principal, error) {
+	return c.Authenticate(r, nil)
+}
+
+// Strip 删除只用于星门认证的请求头, 避免被转发到次元
+func (c Chain) Strip(h http.Header) {
+	for _, a := range c {
+		if s, ok := a.(interface{ Strip(http.Header) }); ok {
+			s.Strip(h)
+		}
+	}
+}
+
+// Options 各认证方式的配置, 为空的认证方式不启用
+// nolint
+type Options struct {
+	APIKeys     string        // API key文件
+	HMACKeys    string        // HMAC签名密钥文件
+	HMACWindow  time.Duration // HMAC时间戳允许的偏差
+	JWKS        []string      // JWKS文件
+	JWTIssuer   string
+	JWTAudience string
+}
+
+// NewChain 根据配置创建认证链, 顺序: API key, HMAC, JWT
+func NewChain(o Options) (Chain, error) {
+	var c Chain
+	if o.APIKeys != "" {
+		a, err := NewAPIKey(o.APIKeys)
+		if err != nil {
+			return nil, err
+		}
+		c = append(c, a)
+	}
+	if o.HMACKeys != "" {
+		h, err := NewHMAC(o.HMACKeys, o.HMACWindow)
+		if err != nil {
+			return nil, err
+		}
+		c = append(c, h)
+	}
+	if len(o.JWKS) > 0 {
+		j, err := NewJWT(o.JWKS, WithIssuer(o.JWTIssuer), WithAudience(o.JWTAudience))
+		if err != nil {
+			return nil, err
+		}
+		c = append(c, j)
+	}
+	return c, nil
+}
+
+// Names 返回已启用的认证方式
+func (c Chain) Names() []string {
+	names := make([]string, 0, len(c))
+	for _, a := range c {
+		names = append(names, a.Name())
+	}
+	return names
+}
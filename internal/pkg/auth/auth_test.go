@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeJSON(t *testing.T, v any) string {
+	data, err := json.Marshal(v)
+	assert.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "auth.json")
+	assert.NoError(t, os.WriteFile(path, data, 0o600))
+	return path
+}
+
+func TestAPIKey(t *testing.T) {
+	sum := sha256.Sum256([]byte("hashed-key"))
+	a, err := NewAPIKey(writeJSON(t, map[string]string{
+		"billing": "plain-key",
+		"report":  sha256Prefix + hex.EncodeToString(sum[:]),
+	}))
+	assert.NoError(t, err)
+	tests := []struct {
+		name    string
+		key     string
+		subject string
+		err     error
+	}{
+		{name: "plain", key: "plain-key", subject: "billing"},
+		{name: "hashed", key: "hashed-key", subject: "report"},
+		{name: "wrong", key: "nope", err: ErrInvalid},
+		{name: "missing", key: "", err: ErrNoCredentials},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/x", nil)
+			if tt.key != "" {
+				r.Header.Set(HeaderAPIKey, tt.key)
+			}
+			p, err := a.Authenticate(r, nil)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.subject, p.Subject)
+		})
+	}
+}
+
+func TestHMAC(t *testing.T) {
+	h, err := NewHMAC(writeJSON(t, map[string]string{"k1": "secret"}), time.Minute)
+	assert.NoError(t, err)
+	body := []byte(`{"a":1}`)
+	sum := sha256.Sum256(body)
+	request := func(ts int64, sig string) *http.Request {
+		r := httptest.NewRequest("POST", "/api?q=1", nil)
+		r.Header.Set(HeaderKeyID, "k1")
+		r.Header.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+		r.Header.Set(HeaderSignature, sig)
+		return r
+	}
+	now := time.Now().Unix()
+	sig := Sign([]byte("secret"), "POST", "/api?q=1", now, body)
+
+	// 只有请求头时检查密钥和时间戳, 不记录签名
+	_, err = Chain{h}.AuthenticateHeader(request(now, sig))
+	assert.ErrorIs(t, err, ErrNeedBody)
+	r := request(now, sig)
+	r.Header.Set(HeaderKeyID, "k2")
+	_, err = Chain{h}.AuthenticateHeader(r)
+	assert.ErrorIs(t, err, ErrInvalid)
+
+	p, err := h.Authenticate(request(now, sig), sum[:])
+	assert.NoError(t, err)
+	assert.Equal(t, "k1", p.Subject)
+
+	_, err = h.Authenticate(request(now, sig), sum[:]) // 重放
+	assert.ErrorIs(t, err, ErrInvalid)
+
+	_, err = h.Authenticate(request(now, Sign([]byte("secret"), "POST", "/api?q=1", now, []byte("x"))), sum[:])
+	assert.ErrorIs(t, err, ErrInvalid)
+
+	old := now - 3600
+	_, err = h.Authenticate(request(old, Sign([]byte("secret"), "POST", "/api?q=1", old, body)), sum[:])
+	assert.ErrorIs(t, err, ErrInvalid)
+}
+
+func TestJWT(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	jwks := map[string]any{"keys": []map[string]string{{
+		"kty": "RSA", "kid": "k1", "use": "sig",
+		"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}}
+	j, err := NewJWT([]string{writeJSON(t, jwks)}, WithIssuer("idp"))
+	assert.NoError(t, err)
+
+	sign := func(method jwt.SigningMethod, k any, claims jwt.MapClaims) string {
+		tk := jwt.NewWithClaims(method, claims)
+		tk.Header["kid"] = "k1"
+		s, errS := tk.SignedString(k)
+		assert.NoError(t, errS)
+		return s
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "valid", token: sign(jwt.SigningMethodRS256, key, jwt.MapClaims{"sub": "alice", "iss": "idp", "exp": exp})},
+		{name: "expired", token: sign(jwt.SigningMethodRS256, key, jwt.MapClaims{"sub": "alice", "iss": "idp", "exp": time.Now().Add(-time.Hour).Unix()}), wantErr: true},
+		{name: "wrong issuer", token: sign(jwt.SigningMethodRS256, key, jwt.MapClaims{"sub": "alice", "iss": "other", "exp": exp}), wantErr: true},
+		{name: "hmac not allowed", token: sign(jwt.SigningMethodHS256, []byte("k"), jwt.MapClaims{"sub": "alice", "iss": "idp", "exp": exp}), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/x", nil)
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+			p, err := j.Authenticate(r, nil)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalid)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "alice", p.Subject)
+		})
+	}
+}
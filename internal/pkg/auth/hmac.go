@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/structs"
+)
+
+const (
+	HeaderKeyID     = "X-Wormhole-Key-Id"
+	HeaderTimestamp = "X-Wormhole-Timestamp" // unix秒
+	HeaderSignature = "X-Wormhole-Signature" // 16进制HMAC-SHA256
+)
+
+// HMAC 请求签名认证
+// 签名内容: METHOD\nPATH?QUERY\nTIMESTAMP\nHEX(SHA256(BODY))
+// 时间戳与星门时间相差超过window的请求被拒绝; window内同一签名只能使用一次
+// nolint
+type HMAC struct {
+	secrets map[string][]byte // key id => secret
+	window  time.Duration
+	mu      sync.Mutex
+	seen    map[string]time.Time // 已使用的签名 => 过期时间
+	swept   time.Time            // 最后一次清理过期签名的时间
+}
+
+// NewHMAC 从JSON文件加载签名密钥
+// 文件格式: {"key id": "secret"}
+// window: 允许的时间偏差
+func NewHMAC(path string, window time.Duration) (*HMAC, error) {
+	raw := map[string]string{}
+	if err := loadJSON(path, &raw); err != nil {
+		return nil, err
+	}
+	h := &HMAC{
+		secrets: make(map[string][]byte, len(raw)),
+		window:  window,
+		seen:    make(map[string]time.Time),
+	}
+	for id, secret := range raw {
+		h.secrets[id] = []byte(secret)
+	}
+	return h, nil
+}
+
+// Name 实现Authenticator
+func (h *HMAC) Name() string {
+	return MethodHMAC
+}
+
+// Sign 计算请求签名, 供调用方参考实现
+func Sign(secret []byte, method, uri string, timestamp int64, body []byte) string {
+	sum := sha256.Sum256(body)
+	return signSum(secret, method, uri, timestamp, sum[:])
+}
+
+// signSum 使用请求体的sha256计算签名
+func signSum(secret []byte, method, uri string, timestamp int64, bodySum []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s\n%s\n%d\n%s", method, uri, timestamp, hex.EncodeToString(bodySum))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Authenticate 实现Authenticator
+func (h *HMAC) Authenticate(r *http.Request, bodySum []byte) (*structs.Principal, error) {
+	id, sig := r.Header.Get(HeaderKeyID), r.Header.Get(HeaderSignature)
+	if id == "" && sig == "" {
+		return nil, ErrNoCredentials
+	}
+	secret, ok := h.secrets[id]
+	if !ok {
+		return nil, ErrInvalid
+	}
+	ts, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: 时间戳格式错误", ErrInvalid)
+	}
+	now := time.Now()
+	if d := now.Sub(time.Unix(ts, 0)); d > h.window || d < -h.window {
+		return nil, fmt.Errorf("%w: 时间戳超出允许范围", ErrInvalid)
+	}
+	if bodySum == nil {
+		return nil, ErrNeedBody
+	}
+	want := signSum(secret, r.Method, r.URL.RequestURI(), ts, bodySum)
+	if !hmac.Equal([]byte(want), []byte(sig)) {
+		return nil, ErrInvalid
+	}
+	if !h.remember(sig, now) {
+		return nil, fmt.Errorf("%w: 重复的签名", ErrInvalid)
+	}
+	return &structs.Principal{Method: MethodHMAC, Subject: id}, nil
+}
+
+// remember 记录签名, 签名已使用过时返回false
+func (h *HMAC) remember(sig string, now time.Time) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if now.Sub(h.swept) > time.Second {
+		for s, exp := range h.seen {
+			if now.After(exp) {
+				delete(h.seen, s)
+			}
+		}
+		h.swept = now
+	}
+	if _, ok := h.seen[sig]; ok {
+		return false
+	}
+	// 时间戳在 [now-window, now+window] 内有效, 记录到最晚可能的过期时间
+	h.seen[sig] = now.Add(2 * h.window)
+	return true
+}
+
+// Strip 删除签名相关的请求头
+func (h *HMAC) Strip(hd http.Header) {
+	hd.Del(HeaderKeyID)
+	hd.Del(HeaderTimestamp)
+	hd.Del(HeaderSignature)
+}
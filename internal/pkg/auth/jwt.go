@@ -0,0 +1,245 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/structs"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var jwtMethods = []string{
+	"RS256", "RS384", "RS512", "PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512", "EdDSA",
+}
+
+// JWT 使用本地JWKS文件校验Bearer token
+// JWKS文件更新后自动重新加载(最多延迟10秒)
+// nolint
+type JWT struct {
+	files    []string
+	issuer   string
+	audience string
+	leeway   time.Duration
+
+	mu      sync.RWMutex
+	keys    map[string]any // kid => 公钥
+	modTime time.Time
+	checked time.Time
+}
+
+type JWTOptionFunc func(*JWT)
+
+// WithIssuer 校验iss
+func WithIssuer(iss string) JWTOptionFunc {
+	return func(j *JWT) {
+		j.issuer = iss
+	}
+}
+
+// WithAudience 校验aud
+func WithAudience(aud string) JWTOptionFunc {
+	return func(j *JWT) {
+		j.audience = aud
+	}
+}
+
+// NewJWT 加载JWKS文件
+// files: 一个或多个JWKS文件路径
+func NewJWT(files []string, ops ...JWTOptionFunc) (*JWT, error) {
+	j := &JWT{files: files, leeway: 30 * time.Second}
+	for _, op := range ops {
+		op(j)
+	}
+	if err := j.load(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// Name 实现Authenticator
+func (j *JWT) Name() string {
+	return MethodJWT
+}
+
+// Authenticate 实现Authenticator
+func (j *JWT) Authenticate(r *http.Request, _ []byte) (*structs.Principal, error) {
+	authz := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authz, "Bearer ") {
+		return nil, ErrNoCredentials
+	}
+	j.maybeReload()
+	ops := []jwt.ParserOption{jwt.WithValidMethods(jwtMethods), jwt.WithLeeway(j.leeway), jwt.WithExpirationRequired()}
+	if j.issuer != "" {
+		ops = append(ops, jwt.WithIssuer(j.issuer))
+	}
+	if j.audience != "" {
+		ops = append(ops, jwt.WithAudience(j.audience))
+	}
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(strings.TrimPrefix(authz, "Bearer "), claims, j.key, ops...); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalid, err)
+	}
+	sub, _ := claims.GetSubject()
+	return &structs.Principal{Method: MethodJWT, Subject: sub, Claims: claims}, nil
+}
+
+// key 根据token的kid查找公钥; 没有kid且只有一个公钥时使用该公钥
+func (j *JWT) key(t *jwt.Token) (any, error) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" && len(j.keys) == 1 {
+		for _, k := range j.keys {
+			return k, nil
+		}
+	}
+	if k, ok := j.keys[kid]; ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("未知的kid: %s", kid)
+}
+
+func (j *JWT) maybeReload() {
+	j.mu.RLock()
+	due := time.Since(j.checked) >= 10*time.Second
+	j.mu.RUnlock()
+	if !due {
+		return
+	}
+	mt, err := latestModTime(j.files)
+	j.mu.Lock()
+	j.checked = time.Now()
+	changed := err == nil && mt.After(j.modTime)
+	j.mu.Unlock()
+	if changed {
+		_ = j.load() // 加载失败时继续使用原有的公钥
+	}
+}
+
+func (j *JWT) load() error {
+	mt, err := latestModTime(j.files)
+	if err != nil {
+		return err
+	}
+	keys := make(map[string]any)
+	for _, f := range j.files {
+		set := struct {
+			Keys []jwk `json:"keys"`
+		}{}
+		if err := loadJSON(f, &set); err != nil {
+			return err
+		}
+		for _, k := range set.Keys {
+			if k.Use != "" && k.Use != "sig" {
+				continue
+			}
+			pub, err := k.publicKey()
+			if err != nil {
+				return fmt.Errorf("%s kid=%s: %w", f, k.Kid, err)
+			}
+			keys[k.Kid] = pub
+		}
+	}
+	if len(keys) == 0 {
+		return errors.New("JWKS中没有可用的签名公钥")
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.keys = keys
+	j.modTime = mt
+	j.checked = time.Now()
+	return nil
+}
+
+// jwk RFC 7517中用到的字段
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := b64Int(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := b64Int(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("不支持的曲线: %s", k.Crv)
+		}
+		x, err := b64Int(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := b64Int(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("不支持的曲线: %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("Ed25519公钥格式错误")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("不支持的密钥类型: %s", k.Kty)
+	}
+}
+
+func b64Int(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func latestModTime(files []string) (time.Time, error) {
+	var latest time.Time
+	for _, f := range files {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return latest, err
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
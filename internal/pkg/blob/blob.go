@@ -0,0 +1,172 @@
+package blob
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"time"
+
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/structs"
+	"github.com/chengfeiZhou/Wormhole/pkg/storage/files"
+)
+
+const (
+	Ext = ".blob" // 请求体分块文件后缀
+
+	pollInterval = 500 * time.Millisecond
+)
+
+var (
+	ErrTooLarge = errors.New("请求体超出落盘上限")
+	ErrChecksum = errors.New("请求体校验失败")
+)
+
+// chunkName 分块文件名: blob_<id>_<序号>.blob
+func chunkName(id string, n int) string {
+	return fmt.Sprintf("blob_%s_%05d%s", id, n, Ext)
+}
+
+// Spool 将r中的数据按chunkSize分块写入dir
+// 每个分块先写入临时目录, 写完后再移动到dir, 保证dir中只出现完整的分块
+// maxSize > 0 时, 数据超出maxSize返回ErrTooLarge并删除已写入的分块
+func Spool(dir string, r io.Reader, chunkSize, maxSize int64) (*structs.BodyRef, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	ref := &structs.BodyRef{ID: hex.EncodeToString(id)}
+	if maxSize > 0 {
+		r = io.LimitReader(r, maxSize+1)
+	}
+	h := sha256.New()
+	for {
+		n, err := spoolChunk(dir, chunkName(ref.ID, ref.Chunks), io.TeeReader(r, h), chunkSize)
+		if n > 0 {
+			ref.Chunks++
+			ref.Size += n
+		}
+		if maxSize > 0 && ref.Size > maxSize {
+			Remove(dir, ref)
+			return nil, ErrTooLarge
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			Remove(dir, ref)
+			return nil, err
+		}
+	}
+	ref.SHA256 = hex.EncodeToString(h.Sum(nil))
+	return ref, nil
+}
+
+// spoolChunk 写入一个分块, 数据读完时返回io.EOF
+func spoolChunk(dir, name string, r io.Reader, size int64) (int64, error) {
+	tmp, err := os.CreateTemp("", "wormhole_blob_*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	n, errC := io.CopyN(tmp, r, size)
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	if errC != nil && !errors.Is(errC, io.EOF) {
+		return 0, errC
+	}
+	if n > 0 {
+		if err := files.MoveFile(tmp.Name(), files.JoinPath(dir, name)); err != nil {
+			return 0, err
+		}
+	}
+	if n < size {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Remove 删除请求体的所有分块
+func Remove(dir string, ref *structs.BodyRef) {
+	for i := 0; i < ref.Chunks; i++ {
+		_ = os.Remove(files.JoinPath(dir, chunkName(ref.ID, i)))
+	}
+}
+
+// Open 按顺序读取请求体的分块
+// 分块还没有搬运到dir时最多等待wait; 读完后校验大小和sha256, 不一致时返回ErrChecksum
+func Open(dir string, ref *structs.BodyRef, wait time.Duration) io.ReadCloser {
+	return &reader{dir: dir, ref: ref, wait: wait, h: sha256.New()}
+}
+
+// nolint
+type reader struct {
+	dir  string
+	ref  *structs.BodyRef
+	wait time.Duration
+	next int      // 下一个分块的序号
+	cur  *os.File // 正在读取的分块
+	h    hash.Hash
+	size int64
+}
+
+// Read 实现io.Reader
+func (r *reader) Read(p []byte) (int, error) {
+	for {
+		if r.cur == nil {
+			if r.next >= r.ref.Chunks {
+				return 0, r.verify()
+			}
+			f, err := r.open(chunkName(r.ref.ID, r.next))
+			if err != nil {
+				return 0, err
+			}
+			r.cur = f
+			r.next++
+		}
+		n, err := r.cur.Read(p)
+		r.h.Write(p[:n])
+		r.size += int64(n)
+		if errors.Is(err, io.EOF) {
+			r.cur.Close()
+			r.cur = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+// Close 实现io.Closer
+func (r *reader) Close() error {
+	if r.cur != nil {
+		return r.cur.Close()
+	}
+	return nil
+}
+
+// open 打开分块, 分块不存在时等待
+func (r *reader) open(name string) (*os.File, error) {
+	deadline := time.Now().Add(r.wait)
+	for {
+		f, err := os.Open(files.JoinPath(r.dir, name))
+		if err == nil || !errors.Is(err, os.ErrNotExist) || time.Now().After(deadline) {
+			return f, err
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+func (r *reader) verify() error {
+	if r.size != r.ref.Size || hex.EncodeToString(r.h.Sum(nil)) != r.ref.SHA256 {
+		return fmt.Errorf("%w: %s", ErrChecksum, r.ref.ID)
+	}
+	return io.EOF
+}
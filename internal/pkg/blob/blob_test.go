@@ -0,0 +1,53 @@
+package blob
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpoolOpen(t *testing.T) {
+	dir := t.TempDir()
+	data := bytes.Repeat([]byte("wormhole\x00\xff"), 1000)
+	ref, err := Spool(dir, bytes.NewReader(data), 4096, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(data)), ref.Size)
+	assert.Equal(t, 3, ref.Chunks)
+
+	r := Open(dir, ref, 0)
+	got, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.NoError(t, r.Close())
+	assert.Equal(t, data, got)
+
+	Remove(dir, ref)
+	entries, _ := os.ReadDir(dir)
+	assert.Empty(t, entries)
+}
+
+func TestSpoolTooLarge(t *testing.T) {
+	dir := t.TempDir()
+	_, err := Spool(dir, bytes.NewReader(make([]byte, 10000)), 4096, 5000)
+	assert.ErrorIs(t, err, ErrTooLarge)
+	entries, _ := os.ReadDir(dir)
+	assert.Empty(t, entries)
+}
+
+func TestOpenChecksum(t *testing.T) {
+	dir := t.TempDir()
+	ref, err := Spool(dir, bytes.NewReader(make([]byte, 100)), 64, 0)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, chunkName(ref.ID, 1)), make([]byte, 35), 0o600))
+
+	_, err = io.ReadAll(Open(dir, ref, 0))
+	assert.ErrorIs(t, err, ErrChecksum)
+
+	// 缺失的分块在等待超时后报错
+	Remove(dir, ref)
+	_, err = io.ReadAll(Open(dir, ref, 0))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
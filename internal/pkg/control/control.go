@@ -0,0 +1,200 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/chengfeiZhou/Wormhole/pkg/logger"
+)
+
+const (
+	LaneIngress = "ingress" // 数据进入本进程的一侧
+	LaneEgress  = "egress"  // 数据离开本进程的一侧
+)
+
+var (
+	ErrNotSupported = errors.New("当前组件不支持该操作")
+	ErrUnknownLane  = errors.New("未知的lane, 可选: ingress, egress")
+)
+
+// Pausable 可以被暂停/恢复的组件
+type Pausable interface {
+	Pause()
+	Resume()
+	Paused() bool
+}
+
+// Reporter 可以上报运行状态的组件
+type Reporter interface {
+	Status() map[string]any
+}
+
+// Rotator 可以强制切换搬运文件的组件
+type Rotator interface {
+	Rotate() error
+}
+
+// Rescanner 可以立即重新扫描搬运目录的组件
+type Rescanner interface {
+	Rescan() error
+}
+
+// Switch 暂停开关, 零值可用(未暂停)
+// 组件通过内嵌Switch获得Pause/Resume/Paused方法
+// nolint
+type Switch struct {
+	mu      sync.Mutex
+	paused  bool
+	resumed chan struct{}
+}
+
+// Pause 暂停
+func (s *Switch) Pause() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.paused {
+		s.paused = true
+		s.resumed = make(chan struct{})
+	}
+}
+
+// Resume 恢复
+func (s *Switch) Resume() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.paused {
+		s.paused = false
+		close(s.resumed)
+	}
+}
+
+// Paused 是否处于暂停状态
+func (s *Switch) Paused() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paused
+}
+
+// Resumed 暂停时返回一个在恢复时被关闭的channel; 未暂停时返回nil
+// 用于在select中等待恢复:
+//
+//	in, resumed := msgChan, sw.Resumed()
+//	if resumed != nil { in = nil }
+func (s *Switch) Resumed() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.paused {
+		return nil
+	}
+	return s.resumed
+}
+
+// Wait 阻塞直到开关恢复或ctx结束
+func (s *Switch) Wait(ctx context.Context) error {
+	resumed := s.Resumed()
+	if resumed == nil {
+		return nil
+	}
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Sequence 组件处理消息的序号计数
+type Sequence struct {
+	n atomic.Uint64
+}
+
+// Next 序号加一并返回新的序号
+func (s *Sequence) Next() uint64 {
+	return s.n.Add(1)
+}
+
+// Last 返回最后一个序号
+func (s *Sequence) Last() uint64 {
+	return s.n.Load()
+}
+
+// ErrorCounter 按AppError错误码统计错误数量
+// 通过 logger.WithHooks(log, counter.Hook) 挂载到logger上
+type ErrorCounter struct {
+	counts sync.Map // code => *atomic.Uint64
+}
+
+// Hook 实现logger.Hook, 只统计Error及以上级别
+func (ec *ErrorCounter) Hook(lv logger.Level, err logger.AppError) {
+	if lv < logger.ErrorLevel {
+		return
+	}
+	v, _ := ec.counts.LoadOrStore(err.Code(), new(atomic.Uint64))
+	v.(*atomic.Uint64).Add(1)
+}
+
+// Snapshot 返回 错误码 => 数量 的快照
+func (ec *ErrorCounter) Snapshot() map[int]uint64 {
+	res := make(map[int]uint64)
+	ec.counts.Range(func(k, v any) bool {
+		res[k.(int)] = v.(*atomic.Uint64).Load()
+		return true
+	})
+	return res
+}
+
+// StatusOf 汇总组件c的状态: 名称, 是否暂停以及组件自身上报的状态
+func StatusOf(name string, c any) map[string]any {
+	st := map[string]any{"name": name}
+	if p, ok := c.(Pausable); ok {
+		st["paused"] = p.Paused()
+	}
+	if r, ok := c.(Reporter); ok {
+		for k, v := range r.Status() {
+			st[k] = v
+		}
+	}
+	return st
+}
+
+// Pause 暂停组件c
+func Pause(c any) error {
+	p, ok := c.(Pausable)
+	if !ok {
+		return ErrNotSupported
+	}
+	p.Pause()
+	return nil
+}
+
+// Resume 恢复组件c
+func Resume(c any) error {
+	p, ok := c.(Pausable)
+	if !ok {
+		return ErrNotSupported
+	}
+	p.Resume()
+	return nil
+}
+
+// Rotate 在components中找到第一个Rotator并执行文件切换
+func Rotate(components ...any) error {
+	for _, c := range components {
+		if r, ok := c.(Rotator); ok {
+			return r.Rotate()
+		}
+	}
+	return ErrNotSupported
+}
+
+// Rescan 在components中找到第一个Rescanner并执行重新扫描
+func Rescan(components ...any) error {
+	for _, c := range components {
+		if r, ok := c.(Rescanner); ok {
+			return r.Rescan()
+		}
+	}
+	return ErrNotSupported
+}
@@ -0,0 +1,204 @@
+package credential
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultStrip 默认删除的入站凭证请求头
+var defaultStrip = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+// Basic HTTP基本认证
+// nolint
+type Basic struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// OAuth 通过客户端凭证模式(client credentials)从本地令牌服务获取访问令牌, 令牌过期前缓存复用
+// nolint
+type OAuth struct {
+	TokenURL     string            `json:"tokenURL"`
+	ClientID     string            `json:"clientID"`
+	ClientSecret string            `json:"clientSecret"`
+	Scopes       []string          `json:"scopes"`
+	Params       map[string]string `json:"params"`  // 额外的请求参数, 如: audience
+	Timeout      int               `json:"timeout"` // 获取令牌的超时时间(s), 默认10
+
+	mu     sync.Mutex
+	token  string // Authorization请求头的值
+	expiry time.Time
+	client *http.Client
+	now    func() time.Time
+}
+
+// Credential 转发目标的凭证, basic与oauth只能设置一个
+// nolint
+type Credential struct {
+	Headers map[string]string `json:"headers"` // 固定的请求头, 如: X-Api-Key
+	Basic   *Basic            `json:"basic"`
+	OAuth   *OAuth            `json:"oauth"`
+}
+
+// Store 凭证替换规则: 删除入站凭证后注入路由对应的凭证
+// nolint
+type Store struct {
+	Strip   []string               `json:"strip"`   // 删除的入站凭证请求头, 为空时删除Authorization, Proxy-Authorization, Cookie
+	Routes  map[string]*Credential `json:"routes"`  // 路由 => 凭证
+	Default *Credential            `json:"default"` // 没有路由或路由没有配置凭证时使用, 为空不注入
+}
+
+// Load 从本地JSON文件加载凭证
+func Load(file string) (*Store, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	s := new(Store)
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("解析凭证文件%s: %w", file, err)
+	}
+	if len(s.Strip) == 0 {
+		s.Strip = defaultStrip
+	}
+	for name, c := range s.Routes {
+		if err := c.init(); err != nil {
+			return nil, fmt.Errorf("路由%s的凭证: %w", name, err)
+		}
+	}
+	if s.Default != nil {
+		if err := s.Default.init(); err != nil {
+			return nil, fmt.Errorf("默认凭证: %w", err)
+		}
+	}
+	return s, nil
+}
+
+func (c *Credential) init() error {
+	if c.Basic != nil && c.OAuth != nil {
+		return errors.New("basic与oauth只能设置一个")
+	}
+	if o := c.OAuth; o != nil {
+		if o.TokenURL == "" || o.ClientID == "" {
+			return errors.New("oauth需要设置tokenURL和clientID")
+		}
+		if o.Timeout <= 0 {
+			o.Timeout = 10
+		}
+		o.client = &http.Client{Timeout: time.Duration(o.Timeout) * time.Second}
+		o.now = time.Now
+	}
+	return nil
+}
+
+// lookup 返回路由对应的凭证
+func (s *Store) lookup(route string) *Credential {
+	if c, ok := s.Routes[route]; ok && route != "" {
+		return c
+	}
+	return s.Default
+}
+
+// Apply 删除请求中的入站凭证并注入路由对应的凭证; nil的Store不做任何处理
+// 获取令牌失败时返回错误, 请求不应再转发
+func (s *Store) Apply(ctx context.Context, req *http.Request, route string) error {
+	if s == nil {
+		return nil
+	}
+	for _, key := range s.Strip {
+		req.Header.Del(key)
+	}
+	c := s.lookup(route)
+	if c == nil {
+		return nil
+	}
+	for key, value := range c.Headers {
+		req.Header.Set(key, value)
+	}
+	switch {
+	case c.Basic != nil:
+		req.SetBasicAuth(c.Basic.Username, c.Basic.Password)
+	case c.OAuth != nil:
+		token, err := c.OAuth.Token(ctx)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", token)
+	}
+	return nil
+}
+
+// Invalidate 目标拒绝了令牌(401)时调用, 下一次请求重新获取路由对应的令牌
+func (s *Store) Invalidate(route string) {
+	if s == nil {
+		return
+	}
+	if c := s.lookup(route); c != nil && c.OAuth != nil {
+		c.OAuth.mu.Lock()
+		c.OAuth.token = ""
+		c.OAuth.mu.Unlock()
+	}
+}
+
+// Token 返回Authorization请求头的值(如: Bearer xxx), 缓存的令牌在过期前30s重新获取
+func (o *OAuth) Token(ctx context.Context) (string, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.token != "" && o.now().Before(o.expiry) {
+		return o.token, nil
+	}
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(o.Scopes) > 0 {
+		form.Set("scope", strings.Join(o.Scopes, " "))
+	}
+	for key, value := range o.Params {
+		form.Set(key, value)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// RFC 6749 2.3.1: 客户端ID和密钥先做表单编码
+	req.SetBasicAuth(url.QueryEscape(o.ClientID), url.QueryEscape(o.ClientSecret))
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("获取令牌: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("获取令牌: 令牌服务响应%s", resp.Status)
+	}
+	var tr struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&tr); err != nil {
+		return "", fmt.Errorf("解析令牌: %w", err)
+	}
+	if tr.AccessToken == "" {
+		return "", errors.New("令牌服务没有返回access_token")
+	}
+	tokenType := tr.TokenType
+	if tokenType == "" || strings.EqualFold(tokenType, "bearer") {
+		tokenType = "Bearer"
+	}
+	// 没有返回有效期时缓存60s
+	ttl := 60 * time.Second
+	if tr.ExpiresIn > 0 {
+		ttl = max(time.Duration(tr.ExpiresIn)*time.Second-30*time.Second, 0)
+	}
+	o.token = tokenType + " " + tr.AccessToken
+	o.expiry = o.now().Add(ttl)
+	return o.token, nil
+}
@@ -0,0 +1,93 @@
+package credential
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newRequest(t *testing.T) *http.Request {
+	req, err := http.NewRequest(http.MethodGet, "http://billing:9000/api", http.NoBody)
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer outer.jwt.token")
+	req.Header.Set("Cookie", "session=outer")
+	req.Header.Set("X-Keep", "1")
+	return req
+}
+
+func TestApply(t *testing.T) {
+	var fetched atomic.Int32
+	tokenSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != "wormhole" || secret != "s3cret" || r.FormValue("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		n := fetched.Add(1)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token": fmt.Sprintf("inner-%d-%s", n, r.FormValue("scope")),
+			"token_type":   "bearer", "expires_in": 3600,
+		})
+	}))
+	defer tokenSrv.Close()
+
+	file := filepath.Join(t.TempDir(), "credentials.json")
+	assert.NoError(t, os.WriteFile(file, []byte(`{
+		"routes": {
+			"billing": {"headers": {"X-Api-Key": "k1"}, "basic": {"username": "svc", "password": "pw"}},
+			"crm": {"oauth": {"tokenURL": "`+tokenSrv.URL+`", "clientID": "wormhole", "clientSecret": "s3cret", "scopes": ["read", "write"]}},
+			"bad": {"oauth": {"tokenURL": "`+tokenSrv.URL+`", "clientID": "other"}}
+		}
+	}`), 0o600))
+	s, err := Load(file)
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	req := newRequest(t)
+	assert.NoError(t, s.Apply(ctx, req, "billing"))
+	user, pass, _ := req.BasicAuth()
+	assert.Equal(t, []string{"svc", "pw"}, []string{user, pass})
+	assert.Equal(t, "k1", req.Header.Get("X-Api-Key"))
+	assert.Empty(t, req.Header.Get("Cookie"))
+	assert.Equal(t, "1", req.Header.Get("X-Keep"))
+
+	// 没有配置凭证的路由只删除入站凭证
+	req = newRequest(t)
+	assert.NoError(t, s.Apply(ctx, req, "report"))
+	assert.Empty(t, req.Header.Get("Authorization"))
+
+	// 令牌缓存复用, Invalidate后重新获取
+	for i := 0; i < 2; i++ {
+		req = newRequest(t)
+		assert.NoError(t, s.Apply(ctx, req, "crm"))
+		assert.Equal(t, "Bearer inner-1-read write", req.Header.Get("Authorization"))
+	}
+	s.Invalidate("crm")
+	req = newRequest(t)
+	assert.NoError(t, s.Apply(ctx, req, "crm"))
+	assert.Equal(t, "Bearer inner-2-read write", req.Header.Get("Authorization"))
+	// 令牌过期前重新获取
+	s.Routes["crm"].OAuth.now = func() time.Time { return time.Now().Add(time.Hour) }
+	assert.NoError(t, s.Apply(ctx, newRequest(t), "crm"))
+	assert.Equal(t, int32(3), fetched.Load())
+
+	assert.Error(t, s.Apply(ctx, newRequest(t), "bad"))
+
+	var nilStore *Store
+	req = newRequest(t)
+	assert.NoError(t, nilStore.Apply(ctx, req, "crm"))
+	assert.NotEmpty(t, req.Header.Get("Authorization"))
+
+	assert.NoError(t, os.WriteFile(file, []byte(`{"default": {"basic": {}, "oauth": {}}}`), 0o600))
+	_, err = Load(file)
+	assert.Error(t, err)
+}
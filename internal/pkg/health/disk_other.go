@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd
+
+package health
+
+// freeSpace 当前平台不支持获取剩余空间, 返回-1表示未知
+func freeSpace(path string) (int64, error) {
+	return -1, nil
+}
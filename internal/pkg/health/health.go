@@ -0,0 +1,206 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	checkTimeout = 3 * time.Second
+)
+
+// Check 组件注册的检查函数, 返回nil表示检查通过
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	check     Check
+	component string
+	name      string
+	readiness bool // 仅用于就绪检查
+}
+
+// Result 单项检查的结果
+// nolint
+type Result struct {
+	Component string `json:"component"`
+	Name      string `json:"name"`
+	OK        bool   `json:"ok"`
+	Error     string `json:"error,omitempty"`
+	Duration  string `json:"duration"`
+}
+
+// Report 检查报告
+type Report struct {
+	Status string   `json:"status"` // ok / fail
+	Checks []Result `json:"checks"`
+}
+
+// Registry 健康检查注册表
+// 存活检查(Liveness)同时参与/healthz和/readyz, 就绪检查(Readiness)只参与/readyz
+type Registry struct {
+	mu     sync.RWMutex
+	checks []namedCheck
+}
+
+// NewRegistry 创建健康检查注册表
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Liveness 注册存活检查
+func (r *Registry) Liveness(component, name string, c Check) {
+	r.register(namedCheck{component: component, name: name, check: c})
+}
+
+// Readiness 注册就绪检查
+func (r *Registry) Readiness(component, name string, c Check) {
+	r.register(namedCheck{component: component, name: name, check: c, readiness: true})
+}
+
+func (r *Registry) register(nc namedCheck) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks = append(r.checks, nc)
+}
+
+// Run 并发执行检查, readiness为false时只执行存活检查
+func (r *Registry) Run(ctx context.Context, readiness bool) *Report {
+	r.mu.RLock()
+	checks := make([]namedCheck, 0, len(r.checks))
+	for _, c := range r.checks {
+		if readiness || !c.readiness {
+			checks = append(checks, c)
+		}
+	}
+	r.mu.RUnlock()
+
+	rep := &Report{Status: "ok", Checks: make([]Result, len(checks))}
+	var wg sync.WaitGroup
+	for i := range checks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cctx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+			start := time.Now()
+			err := checks[i].check(cctx)
+			res := Result{
+				Component: checks[i].component,
+				Name:      checks[i].name,
+				OK:        err == nil,
+				Duration:  time.Since(start).String(),
+			}
+			if err != nil {
+				res.Error = err.Error()
+			}
+			rep.Checks[i] = res
+		}(i)
+	}
+	wg.Wait()
+	for _, res := range rep.Checks {
+		if !res.OK {
+			rep.Status = "fail"
+			break
+		}
+	}
+	return rep
+}
+
+// LivenessHandler /healthz
+func (r *Registry) LivenessHandler() http.Handler {
+	return r.handler(false)
+}
+
+// ReadinessHandler /readyz
+func (r *Registry) ReadinessHandler() http.Handler {
+	return r.handler(true)
+}
+
+func (r *Registry) handler(readiness bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rep := r.Run(req.Context(), readiness)
+		code := http.StatusOK
+		if rep.Status != "ok" {
+			code = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(rep)
+	})
+}
+
+// Dial 检查addrs中至少有一个地址可以建立tcp连接
+func Dial(addrs ...string) Check {
+	return func(ctx context.Context) error {
+		var errs []error
+		d := net.Dialer{}
+		for _, addr := range addrs {
+			conn, err := d.DialContext(ctx, "tcp", addr)
+			if err == nil {
+				_ = conn.Close()
+				return nil
+			}
+			errs = append(errs, err)
+		}
+		if len(errs) == 0 {
+			return errors.New("没有配置地址")
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// DirExists 检查目录存在
+func DirExists(dir string) Check {
+	return func(ctx context.Context) error {
+		fi, err := os.Stat(dir)
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			return fmt.Errorf("不是目录: %s", dir)
+		}
+		return nil
+	}
+}
+
+// WritableDir 检查目录可写, 并且剩余空间不小于minFree(byte)
+func WritableDir(dir string, minFree int64) Check {
+	return func(ctx context.Context) error {
+		f, err := os.CreateTemp(dir, ".healthz_*")
+		if err != nil {
+			return fmt.Errorf("目录不可写: %w", err)
+		}
+		name := f.Name()
+		_ = f.Close()
+		_ = os.Remove(name)
+		free, err := freeSpace(dir)
+		if err != nil {
+			return fmt.Errorf("获取剩余空间: %w", err)
+		}
+		if free >= 0 && free < minFree {
+			return fmt.Errorf("剩余空间不足: %d < %d", free, minFree)
+		}
+		return nil
+	}
+}
+
+// Fresh 检查last返回的时间距今不超过maxAge
+func Fresh(what string, last func() time.Time, maxAge time.Duration) Check {
+	return func(ctx context.Context) error {
+		t := last()
+		if t.IsZero() {
+			return fmt.Errorf("尚未收到%s", what)
+		}
+		if age := time.Since(t); age > maxAge {
+			return fmt.Errorf("%s已过期: %s前", what, age.Truncate(time.Second))
+		}
+		return nil
+	}
+}
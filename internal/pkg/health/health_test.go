@@ -0,0 +1,59 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistryRun(t *testing.T) {
+	r := NewRegistry()
+	r.Liveness("file", "ok", func(ctx context.Context) error { return nil })
+	r.Readiness("http", "target", func(ctx context.Context) error { return errors.New("unreachable") })
+
+	live := r.Run(context.Background(), false)
+	assert.Equal(t, "ok", live.Status)
+	assert.Len(t, live.Checks, 1)
+
+	ready := r.Run(context.Background(), true)
+	assert.Equal(t, "fail", ready.Status)
+	assert.Len(t, ready.Checks, 2)
+	assert.Equal(t, "http", ready.Checks[1].Component)
+	assert.Equal(t, "unreachable", ready.Checks[1].Error)
+}
+
+func TestFresh(t *testing.T) {
+	tests := []struct {
+		name    string
+		last    time.Time
+		wantErr bool
+	}{
+		{name: "never", last: time.Time{}, wantErr: true},
+		{name: "fresh", last: time.Now(), wantErr: false},
+		{name: "stale", last: time.Now().Add(-time.Hour), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Fresh("心跳", func() time.Time { return tt.last }, time.Minute)(context.Background())
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
+
+func TestDirExists(t *testing.T) {
+	assert.NoError(t, DirExists(os.TempDir())(context.Background()))
+	assert.Error(t, DirExists("/non/exists/dir")(context.Background()))
+	f, err := os.CreateTemp(t.TempDir(), "file")
+	assert.NoError(t, err)
+	_ = f.Close()
+	assert.Error(t, DirExists(f.Name())(context.Background()))
+}
+
+func TestWritableDir(t *testing.T) {
+	assert.NoError(t, WritableDir(os.TempDir(), 0)(context.Background()))
+	assert.Error(t, WritableDir("/non/exists/dir", 0)(context.Background()))
+}
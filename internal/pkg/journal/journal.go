@@ -0,0 +1,253 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	types "github.com/chengfeiZhou/Wormhole/pkg/structs"
+)
+
+const BodyBase64 = "base64" // 响应体不是UTF-8文本时以base64记录
+
+var ErrNotFound = errors.New("报文ID没有响应记录或已过期")
+
+// Entry 一次转发的目标响应
+// nolint
+type Entry struct {
+	ID           string      `json:"id"`
+	Route        string      `json:"route,omitempty"`
+	Method       string      `json:"method"`
+	URL          string      `json:"url"` // 转发请求的地址
+	TraceID      string      `json:"traceId,omitempty"`
+	Status       int         `json:"status"` // 0表示没有收到响应
+	Header       http.Header `json:"header,omitempty"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"bodyEncoding,omitempty"` // 为空时Body为原文, base64: Body为base64编码
+	BodySize     int64       `json:"bodySize"`               // 响应体的完整大小(byte)
+	Truncated    bool        `json:"truncated,omitempty"`    // Body只保留了前bodyLimit字节
+	Error        string      `json:"error,omitempty"`        // 请求失败的原因
+	At           int64       `json:"at"`                     // 发出请求的时间(ms)
+	Duration     int64       `json:"duration"`               // 请求耗时(ms)
+}
+
+// ReadBody 读取完整的响应体(以便连接复用), 只保留前limit字节; limit < 0 时全部保留
+func (e *Entry) ReadBody(r io.Reader, limit int64) error {
+	var (
+		buf []byte
+		err error
+	)
+	if limit < 0 {
+		buf, err = io.ReadAll(r)
+		e.BodySize = int64(len(buf))
+	} else {
+		buf, err = io.ReadAll(io.LimitReader(r, limit))
+		e.BodySize = int64(len(buf))
+		if err == nil {
+			var rest int64
+			rest, err = io.Copy(io.Discard, r)
+			e.BodySize += rest
+		}
+	}
+	e.Truncated = int64(len(buf)) < e.BodySize
+	if utf8.Valid(buf) {
+		e.Body, e.BodyEncoding = string(buf), ""
+	} else {
+		e.Body, e.BodyEncoding = base64.StdEncoding.EncodeToString(buf), BodyBase64
+	}
+	return err
+}
+
+// Journal 在内存中记录最近size条转发的目标响应, 超出后淘汰最早的记录; 可以同时追加写入文件(JSON lines)
+// nil 的Journal可以直接调用, 不做任何记录
+// nolint
+type Journal struct {
+	bodyLimit int64
+	mu        sync.Mutex
+	entries   map[string]*Entry
+	order     []string // 按记录顺序排列的ID, 环形使用
+	next      int      // order中下一个写入的位置
+	file      *os.File
+	w         *bufio.Writer
+}
+
+// New 创建Journal, size <= 0 时返回nil(不记录)
+// bodyLimit: 每条记录保留的响应体大小上限(byte); file不为空时每条记录追加写入该文件
+func New(size int, bodyLimit int64, file string) (*Journal, error) {
+	if size <= 0 {
+		return nil, nil
+	}
+	j := &Journal{
+		bodyLimit: max(bodyLimit, 0),
+		entries:   make(map[string]*Entry, size),
+		order:     make([]string, size),
+	}
+	if file != "" {
+		f, err := os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		j.file, j.w = f, bufio.NewWriter(f)
+	}
+	return j, nil
+}
+
+// BodyLimit 每条记录保留的响应体大小上限, nil的Journal返回-1(不限制)
+func (j *Journal) BodyLimit() int64 {
+	if j == nil {
+		return -1
+	}
+	return j.bodyLimit
+}
+
+// Add 记录一条响应, 同一个ID的记录被替换; 写入文件失败时返回错误, 内存中的记录不受影响
+func (j *Journal) Add(e *Entry) error {
+	if j == nil || e.ID == "" {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, ok := j.entries[e.ID]; !ok {
+		if old := j.order[j.next]; old != "" {
+			delete(j.entries, old)
+		}
+		j.order[j.next] = e.ID
+		j.next = (j.next + 1) % len(j.order)
+	}
+	j.entries[e.ID] = e
+	if j.w == nil {
+		return nil
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, _ = j.w.Write(append(b, '\n'))
+	return j.w.Flush()
+}
+
+// Lookup 查询报文的响应记录
+func (j *Journal) Lookup(id string) (Entry, error) {
+	if j == nil {
+		return Entry{}, ErrNotFound
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	e, ok := j.entries[id]
+	if !ok {
+		return Entry{}, ErrNotFound
+	}
+	return *e, nil
+}
+
+// Filter 导出记录的过滤条件, 零值不限制
+// nolint
+type Filter struct {
+	Route  string
+	Status string // 响应状态码, 如: 503, 5xx; failed: 没有收到响应
+	Since  int64  // 请求时间不早于(ms)
+}
+
+func (f *Filter) match(e *Entry) bool {
+	if f.Route != "" && f.Route != e.Route {
+		return false
+	}
+	if f.Since > 0 && e.At < f.Since {
+		return false
+	}
+	switch {
+	case f.Status == "":
+		return true
+	case f.Status == "failed":
+		return e.Status == 0
+	case len(f.Status) == 3 && strings.HasSuffix(f.Status, "xx"):
+		return e.Status/100 == int(f.Status[0]-'0')
+	default:
+		return strconv.Itoa(e.Status) == f.Status
+	}
+}
+
+// Entries 按记录顺序返回满足条件的记录
+func (j *Journal) Entries(f Filter) []Entry {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	list := make([]Entry, 0, len(j.entries))
+	for i := range j.order {
+		id := j.order[(j.next+i)%len(j.order)]
+		if e, ok := j.entries[id]; ok && f.match(e) {
+			list = append(list, *e)
+		}
+	}
+	return list
+}
+
+// Close 关闭记录文件
+func (j *Journal) Close() error {
+	if j == nil || j.file == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_ = j.w.Flush()
+	return j.file.Close()
+}
+
+// Handler 查询报文响应的接口, 请求路径的最后一段为报文ID
+func (j *Journal) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rd := &types.HttpRespData{Code: 0, Message: "ok"}
+		code := http.StatusOK
+		e, err := j.Lookup(path.Base(req.URL.Path))
+		if err != nil {
+			code, rd.Code, rd.Message = http.StatusNotFound, -1, err.Error()
+		} else {
+			rd.Data = map[string]any{"response": e}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(rd)
+	})
+}
+
+// ExportHandler 导出响应记录的接口
+// 查询参数: route, status(如: 503, 5xx, failed), since(ms); format=ndjson时按JSON lines下载
+func (j *Journal) ExportHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		q := req.URL.Query()
+		f := Filter{Route: q.Get("route"), Status: q.Get("status")}
+		if since := q.Get("since"); since != "" {
+			var err error
+			if f.Since, err = strconv.ParseInt(since, 10, 64); err != nil {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				_ = json.NewEncoder(w).Encode(&types.HttpRespData{Code: -1, Message: "since: " + err.Error()})
+				return
+			}
+		}
+		list := j.Entries(f)
+		if q.Get("format") == "ndjson" {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.Header().Set("Content-Disposition", `attachment; filename="responses.ndjson"`)
+			enc := json.NewEncoder(w)
+			for i := range list {
+				_ = enc.Encode(&list[i])
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(&types.HttpRespData{Code: 0, Message: "ok",
+			Data: map[string]any{"total": len(list), "responses": list}})
+	})
+}
@@ -0,0 +1,98 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournal(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "responses.jsonl")
+	j, err := New(2, 4, file)
+	assert.NoError(t, err)
+
+	a := &Entry{ID: "a", Route: "billing", Status: http.StatusOK, At: 100}
+	assert.NoError(t, a.ReadBody(strings.NewReader("hello world"), j.BodyLimit()))
+	assert.Equal(t, "hell", a.Body)
+	assert.Equal(t, int64(11), a.BodySize)
+	assert.True(t, a.Truncated)
+	assert.NoError(t, j.Add(a))
+
+	b := &Entry{ID: "b", Status: http.StatusServiceUnavailable, At: 200}
+	assert.NoError(t, b.ReadBody(strings.NewReader("\xff\xfe"), j.BodyLimit()))
+	assert.Equal(t, BodyBase64, b.BodyEncoding)
+	assert.False(t, b.Truncated)
+	assert.NoError(t, j.Add(b))
+	assert.NoError(t, j.Add(&Entry{ID: "c", Error: "connection refused", At: 300}))
+
+	// 超出容量淘汰最早的记录
+	_, err = j.Lookup("a")
+	assert.ErrorIs(t, err, ErrNotFound)
+	e, err := j.Lookup("b")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, e.Status)
+
+	assert.Len(t, j.Entries(Filter{}), 2)
+	assert.Equal(t, "b", j.Entries(Filter{Status: "5xx"})[0].ID)
+	assert.Equal(t, "c", j.Entries(Filter{Status: "failed"})[0].ID)
+	assert.Equal(t, "c", j.Entries(Filter{Since: 250})[0].ID)
+	assert.Empty(t, j.Entries(Filter{Status: "200"}))
+	assert.NoError(t, j.Close())
+
+	// 文件中保留所有记录
+	f, err := os.Open(file)
+	assert.NoError(t, err)
+	defer f.Close()
+	var ids []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e Entry
+		assert.NoError(t, json.Unmarshal(sc.Bytes(), &e))
+		ids = append(ids, e.ID)
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, ids)
+
+	var nilJournal *Journal
+	assert.NoError(t, nilJournal.Add(a))
+	assert.Equal(t, int64(-1), nilJournal.BodyLimit())
+	_, err = nilJournal.Lookup("a")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestHandler(t *testing.T) {
+	j, err := New(10, 1024, "")
+	assert.NoError(t, err)
+	assert.NoError(t, j.Add(&Entry{ID: "abc", Route: "billing", Status: http.StatusBadGateway, Body: "bad"}))
+	assert.NoError(t, j.Add(&Entry{ID: "def", Status: http.StatusOK}))
+
+	w := httptest.NewRecorder()
+	j.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/responses/abc", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var rd struct {
+		Data struct {
+			Response Entry `json:"response"`
+		} `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &rd))
+	assert.Equal(t, "bad", rd.Data.Response.Body)
+
+	w = httptest.NewRecorder()
+	j.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/responses/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	j.ExportHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/responses?route=billing&format=ndjson", nil))
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	assert.Equal(t, 1, strings.Count(w.Body.String(), "\n"))
+
+	w = httptest.NewRecorder()
+	j.ExportHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/responses?since=x", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,181 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/chengfeiZhou/Wormhole/pkg/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	namespace = "wormhole"
+
+	DirectionIn  = "in"  // 组件接收到的报文
+	DirectionOut = "out" // 组件发出的报文
+
+	FileWritten = "written" // 星门写入的搬运文件
+	FileRead    = "read"    // 次元读取的搬运文件
+)
+
+var (
+	messages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_total",
+		Help:      "按模块, lane和方向统计的报文数量",
+	}, []string{"module", "lane", "direction"})
+
+	messageBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "message_bytes_total",
+		Help:      "按模块, lane和方向统计的报文字节数",
+	}, []string{"module", "lane", "direction"})
+
+	transferFiles = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transfer_files_total",
+		Help:      "写入/读取的搬运文件数量",
+	}, []string{"op"})
+
+	transferFileSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "transfer_file_size_bytes",
+		Help:      "写入/读取的搬运文件大小",
+		Buckets:   prometheus.ExponentialBuckets(1<<10, 4, 10), // 1KB ~ 256GB
+	}, []string{"op"})
+
+	latency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "end_to_end_latency_seconds",
+		Help:      "报文从星门接收到次元发出的耗时",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 16), // 10ms ~ 5min
+	}, []string{"module"})
+
+	httpEgress = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_egress_responses_total",
+		Help:      "次元http转发的响应状态码, 请求失败时code为error",
+	}, []string{"code"})
+
+	egressQueued = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "egress_queued",
+		Help:      "次元转发工作池中按目标排队的请求数",
+	}, []string{"module", "target"})
+
+	egressInFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "egress_in_flight",
+		Help:      "次元转发工作池中按目标执行中的请求数",
+	}, []string{"module", "target"})
+
+	kafkaErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "kafka_errors_total",
+		Help:      "kafka生产/消费错误数",
+	}, []string{"op"})
+
+	appErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "errors_total",
+		Help:      "按logger.AppError错误码统计的错误数",
+	}, []string{"code", "level"})
+)
+
+// Handler 返回暴露指标的http.Handler
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// RegisterChannel 注册搬运通道的占用量和容量
+func RegisterChannel(length func() int, capacity int) {
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "channel_occupancy",
+		Help:      "app.msg 搬运通道中待处理的报文数量",
+	}, func() float64 {
+		return float64(length())
+	}))
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "channel_capacity",
+		Help:      "app.msg 搬运通道的容量",
+	}, func() float64 {
+		return float64(capacity)
+	}))
+}
+
+// MessageIn 记录组件接收到一条报文
+func MessageIn(module, lane string, size int) {
+	messages.WithLabelValues(module, lane, DirectionIn).Inc()
+	messageBytes.WithLabelValues(module, lane, DirectionIn).Add(float64(size))
+}
+
+// MessageOut 记录组件发出一条报文
+func MessageOut(module, lane string, size int) {
+	messages.WithLabelValues(module, lane, DirectionOut).Inc()
+	messageBytes.WithLabelValues(module, lane, DirectionOut).Add(float64(size))
+}
+
+// TransferFile 记录一个被写入/读取的搬运文件
+func TransferFile(op string, size int64) {
+	transferFiles.WithLabelValues(op).Inc()
+	transferFileSize.WithLabelValues(op).Observe(float64(size))
+}
+
+// ObserveLatency 根据星门接收时间(ms)记录端到端耗时, 没有星门时间时忽略
+func ObserveLatency(module string, stargateTime int64) {
+	if stargateTime <= 0 {
+		return
+	}
+	latency.WithLabelValues(module).Observe(time.Since(time.UnixMilli(stargateTime)).Seconds())
+}
+
+// HTTPEgress 记录http转发的响应状态码, err不为空时记为error
+func HTTPEgress(code int, err error) {
+	if err != nil {
+		httpEgress.WithLabelValues("error").Inc()
+		return
+	}
+	httpEgress.WithLabelValues(strconv.Itoa(code)).Inc()
+}
+
+// EgressQueued 调整目标排队中的请求数
+func EgressQueued(module, target string, delta float64) {
+	egressQueued.WithLabelValues(module, target).Add(delta)
+}
+
+// EgressInFlight 调整目标执行中的请求数
+func EgressInFlight(module, target string, delta float64) {
+	egressInFlight.WithLabelValues(module, target).Add(delta)
+}
+
+// Hook 实现logger.Hook, 按错误码统计错误数, 并单独统计kafka生产/消费错误
+func Hook(lv logger.Level, err logger.AppError) {
+	appErrors.WithLabelValues(strconv.Itoa(err.Code()), levelName(lv)).Inc()
+	if lv < logger.ErrorLevel {
+		return
+	}
+	switch err {
+	case logger.ErrorKafkaConsumer:
+		kafkaErrors.WithLabelValues("consume").Inc()
+	case logger.ErrorKafkaProducer, logger.ErrorKafkaProducerSend:
+		kafkaErrors.WithLabelValues("produce").Inc()
+	}
+}
+
+func levelName(lv logger.Level) string {
+	switch lv {
+	case logger.WarnLevel:
+		return "warn"
+	case logger.ErrorLevel:
+		return "error"
+	case logger.FatalLevel:
+		return "fatal"
+	default:
+		return "info"
+	}
+}
@@ -0,0 +1,204 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/structs"
+)
+
+// 全局检查项对应的规则名称
+const (
+	RuleMaxHeaderBytes   = "maxHeaderBytes"
+	RuleForbiddenHeaders = "forbiddenHeaders"
+	RuleCleanPath        = "cleanPath" // 路径中包含.和..等未清理的部分
+	RuleDefault          = "default"   // 没有规则允许该请求
+)
+
+var ErrDenied = errors.New("请求被策略拒绝")
+
+// Denial 被拒绝的原因, Rule为匹配到的规则名称
+type Denial struct {
+	Rule   string
+	Reason string
+}
+
+func (d *Denial) Error() string {
+	return fmt.Sprintf("%s: %s", d.Rule, d.Reason)
+}
+
+// Unwrap errors.Is(err, ErrDenied)
+func (d *Denial) Unwrap() error {
+	return ErrDenied
+}
+
+// Rule 允许的请求, 字段为空表示不限制
+// nolint
+type Rule struct {
+	Name         string   `json:"name"`
+	Path         string   `json:"path"`         // 路径模式(path.Match), 以/**结尾时匹配该路径及其下所有路径
+	Methods      []string `json:"methods"`      // 允许的请求方法
+	ContentTypes []string `json:"contentTypes"` // 允许的Content-Type(不含参数), 支持type/*
+}
+
+func (r *Rule) matchPath(p string) bool {
+	if prefix, ok := strings.CutSuffix(r.Path, "/**"); ok {
+		return p == prefix || strings.HasPrefix(p, prefix+"/")
+	}
+	ok, _ := path.Match(r.Path, p)
+	return ok
+}
+
+func (r *Rule) matchMethod(m string) bool {
+	if len(r.Methods) == 0 {
+		return true
+	}
+	for _, method := range r.Methods {
+		if strings.EqualFold(method, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkContentType 有请求体或带有Content-Type的请求, Content-Type必须在允许的列表中
+func (r *Rule) checkContentType(header http.Header, bodySize int64) error {
+	if len(r.ContentTypes) == 0 {
+		return nil
+	}
+	ct := header.Get("Content-Type")
+	if ct == "" {
+		if bodySize == 0 {
+			return nil
+		}
+		return &Denial{Rule: r.Name, Reason: "缺少Content-Type"}
+	}
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return &Denial{Rule: r.Name, Reason: fmt.Sprintf("无法解析的Content-Type: %s", ct)}
+	}
+	for _, allowed := range r.ContentTypes {
+		if allowed == mt {
+			return nil
+		}
+		if major, ok := strings.CutSuffix(allowed, "/*"); ok && strings.HasPrefix(mt, major+"/") {
+			return nil
+		}
+	}
+	return &Denial{Rule: r.Name, Reason: fmt.Sprintf("不允许的Content-Type: %s", mt)}
+}
+
+// Policy 请求策略: 先做全局的请求头检查, 再按顺序匹配规则, 没有规则允许的请求被拒绝
+// nolint
+type Policy struct {
+	MaxHeaderBytes   int      `json:"maxHeaderBytes"`   // 请求头总大小(名称+值), 0不限制
+	ForbiddenHeaders []string `json:"forbiddenHeaders"` // 禁止的请求头, 支持前缀匹配(如: X-Debug-*)
+	Rules            []*Rule  `json:"rules"`
+}
+
+// Load 从JSON文件加载策略
+func Load(file string) (*Policy, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	p := new(Policy)
+	if err := json.Unmarshal(b, p); err != nil {
+		return nil, fmt.Errorf("解析策略%s: %w", file, err)
+	}
+	for i, r := range p.Rules {
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rules[%d]", i)
+		}
+		if r.Path == "" {
+			r.Path = "/**"
+		}
+		if _, err := path.Match(r.Path, "/"); err != nil {
+			return nil, fmt.Errorf("规则%s的路径模式: %w", r.Name, err)
+		}
+	}
+	return p, nil
+}
+
+// Check 检查请求是否被允许, 拒绝时返回*Denial
+func (p *Policy) Check(msg *structs.HTTPMessage) error {
+	bodySize := int64(len(msg.Body))
+	if msg.BodyRef != nil {
+		bodySize = msg.BodyRef.Size
+	}
+	return p.check(msg, bodySize)
+}
+
+// CheckRequest 读取请求体之前检查请求, 请求体大小取Content-Length, 长度未知时视为有请求体
+func (p *Policy) CheckRequest(msg *structs.HTTPMessage) error {
+	return p.check(msg, msg.ContentLength)
+}
+
+func (p *Policy) check(msg *structs.HTTPMessage, bodySize int64) error {
+	// 规则按路径匹配, 目标服务会解析.和.., 只接受已经清理的路径
+	if !cleaned(msg.Path) {
+		return &Denial{Rule: RuleCleanPath, Reason: fmt.Sprintf("路径没有清理: %s", msg.Path)}
+	}
+	if err := p.checkHeader(msg.Header); err != nil {
+		return err
+	}
+	var methodRule *Rule // 路径匹配但方法不匹配的规则
+	for _, r := range p.Rules {
+		if !r.matchPath(msg.Path) {
+			continue
+		}
+		if !r.matchMethod(msg.Method) {
+			methodRule = r
+			continue
+		}
+		return r.checkContentType(msg.Header, bodySize)
+	}
+	if methodRule != nil {
+		return &Denial{Rule: methodRule.Name, Reason: fmt.Sprintf("不允许的请求方法: %s", msg.Method)}
+	}
+	return &Denial{Rule: RuleDefault, Reason: fmt.Sprintf("没有允许%s %s的规则", msg.Method, msg.Path)}
+}
+
+// cleaned 解码后的路径是否不含.和..以及连续的/(允许以/结尾)
+func cleaned(p string) bool {
+	c := path.Clean(p)
+	return p == c || p == c+"/"
+}
+
+func (p *Policy) checkHeader(header map[string][]string) error {
+	size := 0
+	for key, values := range header {
+		for _, v := range values {
+			size += len(key) + len(v)
+		}
+		if p.forbidden(key) {
+			return &Denial{Rule: RuleForbiddenHeaders, Reason: fmt.Sprintf("禁止的请求头: %s", key)}
+		}
+	}
+	if p.MaxHeaderBytes > 0 && size > p.MaxHeaderBytes {
+		return &Denial{Rule: RuleMaxHeaderBytes, Reason: fmt.Sprintf("请求头大小%d超出限制%d", size, p.MaxHeaderBytes)}
+	}
+	return nil
+}
+
+func (p *Policy) forbidden(key string) bool {
+	key = http.CanonicalHeaderKey(key)
+	for _, f := range p.ForbiddenHeaders {
+		if prefix, ok := strings.CutSuffix(f, "*"); ok {
+			if strings.HasPrefix(key, http.CanonicalHeaderKey(prefix)) {
+				return true
+			}
+			continue
+		}
+		if key == http.CanonicalHeaderKey(f) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package policy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/structs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheck(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policy.json")
+	assert.NoError(t, os.WriteFile(file, []byte(`{
+		"maxHeaderBytes": 64,
+		"forbiddenHeaders": ["X-Debug-*", "cookie"],
+		"rules": [
+			{"name": "orders-read", "path": "/billing/orders/*", "methods": ["GET"]},
+			{"name": "orders-write", "path": "/billing/orders", "methods": ["POST"], "contentTypes": ["application/json", "text/*"]},
+			{"name": "report", "path": "/report/**"}
+		]
+	}`), 0o600))
+	p, err := Load(file)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		method, path string
+		header       map[string][]string
+		body         string
+		rule         string // 为空表示允许
+	}{
+		{"GET", "/billing/orders/7", nil, "", ""},
+		{"DELETE", "/billing/orders/7", nil, "", "orders-read"},
+		{"POST", "/billing/orders", map[string][]string{"Content-Type": {"application/json; charset=utf-8"}}, "{}", ""},
+		{"POST", "/billing/orders", map[string][]string{"Content-Type": {"text/csv"}}, "a,b", ""},
+		{"POST", "/billing/orders", map[string][]string{"Content-Type": {"application/xml"}}, "<a/>", "orders-write"},
+		{"POST", "/billing/orders", nil, "{}", "orders-write"},
+		{"PUT", "/report", nil, "", ""},
+		{"GET", "/report/daily/2024", nil, "", ""},
+		{"GET", "/reports", nil, "", RuleDefault},
+		{"GET", "/report/x", map[string][]string{"X-Debug-Trace": {"1"}}, "", RuleForbiddenHeaders},
+		{"GET", "/report/x", map[string][]string{"Cookie": {"a=1"}}, "", RuleForbiddenHeaders},
+		{"GET", "/report/x", map[string][]string{"X-Long": {string(make([]byte, 64))}}, "", RuleMaxHeaderBytes},
+		{"GET", "/report/daily/", nil, "", ""},
+		// 路径穿越(%2e%2e解码后同样为..)
+		{"GET", "/report/../billing/orders/7", nil, "", RuleCleanPath},
+		{"DELETE", "/report/../admin", nil, "", RuleCleanPath},
+		{"GET", "/report/./x", nil, "", RuleCleanPath},
+		{"GET", "/report//x", nil, "", RuleCleanPath},
+	}
+	for _, tt := range tests {
+		msg := &structs.HTTPMessage{Method: tt.method, Path: tt.path, Header: tt.header, Body: []byte(tt.body)}
+		err := p.Check(msg)
+		// 读取请求体之前按Content-Length检查, 结果相同
+		head := &structs.HTTPMessage{Method: tt.method, Path: tt.path, Header: tt.header, ContentLength: int64(len(tt.body))}
+		assert.Equal(t, err, p.CheckRequest(head), tt.method+" "+tt.path)
+		if tt.rule == "" {
+			assert.NoError(t, err, tt.method+" "+tt.path)
+			continue
+		}
+		var d *Denial
+		assert.True(t, errors.As(err, &d), tt.method+" "+tt.path)
+		assert.Equal(t, tt.rule, d.Rule, tt.method+" "+tt.path)
+		assert.ErrorIs(t, err, ErrDenied)
+	}
+
+	// 长度未知(分块传输)时视为有请求体
+	chunked := &structs.HTTPMessage{Method: "POST", Path: "/billing/orders", ContentLength: -1}
+	assert.ErrorIs(t, p.CheckRequest(chunked), ErrDenied)
+}
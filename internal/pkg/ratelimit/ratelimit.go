@@ -0,0 +1,259 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	KeyIP        = "ip"        // 按调用方IP
+	KeyPrincipal = "principal" // 按认证的调用方, 未认证时按IP
+	KeyRoute     = "route"     // 按路由
+
+	HeaderLimit             = "X-RateLimit-Limit"
+	HeaderRemaining         = "X-RateLimit-Remaining"
+	HeaderQuotaMessagesLeft = "X-Quota-Remaining-Messages"
+	HeaderQuotaBytesLeft    = "X-Quota-Remaining-Bytes"
+)
+
+var (
+	ErrLimited = errors.New("超出速率限制")
+	ErrQuota   = errors.New("超出每日配额")
+)
+
+// Limit 单个调用方的限制, 字段为0表示不限制
+// nolint
+type Limit struct {
+	Rate          float64 `json:"rate"`          // 令牌桶每秒补充的令牌数(请求/s)
+	Burst         int     `json:"burst"`         // 令牌桶容量, 为0时取rate(至少为1)
+	DailyMessages int64   `json:"dailyMessages"` // 每日报文数
+	DailyBytes    int64   `json:"dailyBytes"`    // 每日请求体字节数
+}
+
+func (l Limit) burst() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return math.Max(1, math.Ceil(l.Rate))
+}
+
+// Config 限流配置
+// nolint
+type Config struct {
+	Key     string           `json:"key"`     // http接收模块的限流维度: ip, principal, route; kafka消费模块固定按topic
+	Default Limit            `json:"default"` // 没有单独配置的调用方使用的限制
+	Clients map[string]Limit `json:"clients"` // 调用方(IP, 认证名称, 路由或topic) => 限制
+}
+
+// LoadConfig 从JSON文件加载限流配置
+func LoadConfig(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	conf := &Config{Key: KeyIP}
+	if err := json.Unmarshal(b, conf); err != nil {
+		return nil, fmt.Errorf("解析限流配置%s: %w", path, err)
+	}
+	switch conf.Key {
+	case KeyIP, KeyPrincipal, KeyRoute:
+	default:
+		return nil, fmt.Errorf("限流维度可选: ip, principal, route; 当前: %s", conf.Key)
+	}
+	return conf, nil
+}
+
+// Result 一次限流检查的结果
+// nolint
+type Result struct {
+	Err          error         // nil: 通过; ErrLimited, ErrQuota: 拒绝
+	Limit        int           // 令牌桶容量, 0表示不限速
+	Remaining    int           // 剩余令牌
+	RetryAfter   time.Duration // 拒绝时建议的重试间隔
+	MessagesLeft int64         // 今日剩余报文数, -1表示不限制
+	BytesLeft    int64         // 今日剩余字节数, -1表示不限制
+}
+
+// SetHeaders 将限流结果写入响应头
+func (r *Result) SetHeaders(h http.Header) {
+	if r.Limit > 0 {
+		h.Set(HeaderLimit, strconv.Itoa(r.Limit))
+		h.Set(HeaderRemaining, strconv.Itoa(r.Remaining))
+	}
+	if r.MessagesLeft >= 0 {
+		h.Set(HeaderQuotaMessagesLeft, strconv.FormatInt(r.MessagesLeft, 10))
+	}
+	if r.BytesLeft >= 0 {
+		h.Set(HeaderQuotaBytesLeft, strconv.FormatInt(r.BytesLeft, 10))
+	}
+	if r.Err != nil {
+		h.Set("Retry-After", strconv.Itoa(int(math.Ceil(r.RetryAfter.Seconds()))))
+	}
+}
+
+// bucket 单个调用方的令牌桶和当日用量
+type bucket struct {
+	tokens   float64
+	last     time.Time
+	messages int64
+	bytes    int64
+}
+
+// Limiter 按调用方限流, 每日配额在本地时间0点重置
+// nil 的Limiter不做任何限制
+// nolint
+type Limiter struct {
+	conf    *Config
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	day     string // buckets所属的日期
+	now     func() time.Time
+}
+
+// New 创建Limiter, conf为空时返回nil
+func New(conf *Config) *Limiter {
+	if conf == nil {
+		return nil
+	}
+	return &Limiter{conf: conf, buckets: make(map[string]*bucket), now: time.Now}
+}
+
+// Key 返回限流维度
+func (l *Limiter) Key() string {
+	if l == nil {
+		return ""
+	}
+	return l.conf.Key
+}
+
+// Allow 检查调用方key是否可以再发送一条大小为size的报文, 通过时扣除令牌并计入当日用量
+func (l *Limiter) Allow(key string, size int64) Result {
+	if l == nil {
+		return Result{MessagesLeft: -1, BytesLeft: -1}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	b, lim := l.bucket(key, now)
+	if lim.Rate > 0 {
+		b.tokens = math.Min(lim.burst(), b.tokens+now.Sub(b.last).Seconds()*lim.Rate)
+		b.last = now
+	}
+	res := Result{MessagesLeft: -1, BytesLeft: -1}
+	if lim.Rate > 0 {
+		res.Limit = int(lim.burst())
+	}
+	switch {
+	case lim.DailyMessages > 0 && b.messages+1 > lim.DailyMessages,
+		lim.DailyBytes > 0 && b.bytes+size > lim.DailyBytes:
+		res.Err = ErrQuota
+		res.RetryAfter = untilTomorrow(now)
+	case lim.Rate > 0 && b.tokens < 1:
+		res.Err = ErrLimited
+		res.RetryAfter = time.Duration((1 - b.tokens) / lim.Rate * float64(time.Second))
+	default:
+		if lim.Rate > 0 {
+			b.tokens--
+		}
+		b.messages++
+		b.bytes += size
+	}
+	b.left(lim, &res)
+	return res
+}
+
+// Consume 计入调用方key已经通过Allow的报文在检查之后才确定的size字节(如: 分块传输的请求体)
+// 超出每日字节配额时返回ErrQuota, 不计入用量
+func (l *Limiter) Consume(key string, size int64) Result {
+	if l == nil {
+		return Result{MessagesLeft: -1, BytesLeft: -1}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	b, lim := l.bucket(key, now)
+	res := Result{MessagesLeft: -1, BytesLeft: -1}
+	if lim.Rate > 0 {
+		res.Limit = int(lim.burst())
+	}
+	if lim.DailyBytes > 0 && b.bytes+size > lim.DailyBytes {
+		res.Err = ErrQuota
+		res.RetryAfter = untilTomorrow(now)
+	} else {
+		b.bytes += size
+	}
+	b.left(lim, &res)
+	return res
+}
+
+// bucket 返回调用方key的令牌桶和限制, 跨天后重置所有调用方的用量
+func (l *Limiter) bucket(key string, now time.Time) (*bucket, Limit) {
+	if day := now.Format("20060102"); day != l.day {
+		l.day = day
+		l.buckets = make(map[string]*bucket)
+	}
+	lim := l.limit(key)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: lim.burst(), last: now}
+		l.buckets[key] = b
+	}
+	return b, lim
+}
+
+// limit 返回调用方key的限制
+func (l *Limiter) limit(key string) Limit {
+	if lim, ok := l.conf.Clients[key]; ok {
+		return lim
+	}
+	return l.conf.Default
+}
+
+// left 将剩余令牌和当日剩余配额写入res
+func (b *bucket) left(lim Limit, res *Result) {
+	res.Remaining = int(b.tokens)
+	if lim.DailyMessages > 0 {
+		res.MessagesLeft = lim.DailyMessages - b.messages
+	}
+	if lim.DailyBytes > 0 {
+		res.BytesLeft = max(0, lim.DailyBytes-b.bytes)
+	}
+}
+
+// Wait 阻塞直到调用方key可以发送大小为size的报文(用于不能拒绝的消费场景), ctx结束时返回ctx的错误
+// size超过每日字节配额时永远无法通过, 立即返回ErrQuota, 由调用方跳过该报文
+func (l *Limiter) Wait(ctx context.Context, key string, size int64) error {
+	if l == nil {
+		return nil
+	}
+	if lim := l.limit(key); lim.DailyBytes > 0 && size > lim.DailyBytes {
+		return fmt.Errorf("%w: 报文大小%d超过每日字节配额%d", ErrQuota, size, lim.DailyBytes)
+	}
+	for {
+		res := l.Allow(key, size)
+		if res.Err == nil {
+			return nil
+		}
+		t := time.NewTimer(res.RetryAfter)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// untilTomorrow 距离次日0点的时间
+func untilTomorrow(now time.Time) time.Duration {
+	y, m, d := now.Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, now.Location()).Sub(now)
+}
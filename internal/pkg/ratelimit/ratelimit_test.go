@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllow(t *testing.T) {
+	now := time.Date(2024, 5, 1, 23, 59, 58, 0, time.Local)
+	l := New(&Config{
+		Key:     KeyIP,
+		Default: Limit{Rate: 1, Burst: 2},
+		Clients: map[string]Limit{"10.0.0.1": {DailyMessages: 2, DailyBytes: 100}},
+	})
+	l.now = func() time.Time { return now }
+
+	assert.NoError(t, l.Allow("10.0.0.2", 0).Err)
+	assert.NoError(t, l.Allow("10.0.0.2", 0).Err)
+	res := l.Allow("10.0.0.2", 0)
+	assert.ErrorIs(t, res.Err, ErrLimited)
+	assert.Equal(t, time.Second, res.RetryAfter)
+	h := http.Header{}
+	res.SetHeaders(h)
+	assert.Equal(t, "2", h.Get(HeaderLimit))
+	assert.Equal(t, "1", h.Get("Retry-After"))
+
+	now = now.Add(time.Second)
+	assert.NoError(t, l.Allow("10.0.0.2", 0).Err)
+
+	// 配额
+	res = l.Allow("10.0.0.1", 60)
+	assert.NoError(t, res.Err)
+	assert.Equal(t, int64(1), res.MessagesLeft)
+	assert.Equal(t, int64(40), res.BytesLeft)
+	assert.ErrorIs(t, l.Allow("10.0.0.1", 60).Err, ErrQuota)
+	assert.NoError(t, l.Allow("10.0.0.1", 40).Err)
+	res = l.Allow("10.0.0.1", 0)
+	assert.ErrorIs(t, res.Err, ErrQuota)
+	assert.Equal(t, time.Second, res.RetryAfter)
+
+	// 跨天重置
+	now = now.Add(time.Second)
+	assert.NoError(t, l.Allow("10.0.0.1", 0).Err)
+
+	// 读取请求体后计入的字节数
+	res = l.Consume("10.0.0.1", 70)
+	assert.NoError(t, res.Err)
+	assert.Equal(t, int64(30), res.BytesLeft)
+	res = l.Consume("10.0.0.1", 40)
+	assert.ErrorIs(t, res.Err, ErrQuota)
+	assert.Equal(t, int64(30), res.BytesLeft)
+	var nilLimiter *Limiter
+	assert.NoError(t, nilLimiter.Consume("10.0.0.1", 1).Err)
+}
+
+func TestWait(t *testing.T) {
+	l := New(&Config{Default: Limit{Rate: 20, Burst: 1}})
+	start := time.Now()
+	assert.NoError(t, l.Wait(context.Background(), "topic", 0))
+	assert.NoError(t, l.Wait(context.Background(), "topic", 0))
+	assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, l.Wait(ctx, "topic", 0), context.Canceled)
+
+	// 超过每日字节配额的报文永远无法通过, 不等待
+	l = New(&Config{Default: Limit{DailyBytes: 10}, Clients: map[string]Limit{"big": {}}})
+	done := make(chan error, 1)
+	go func() {
+		done <- l.Wait(context.Background(), "topic", 11)
+	}()
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, ErrQuota)
+	case <-time.After(time.Second):
+		t.Fatal("Wait没有返回")
+	}
+	assert.NoError(t, l.Wait(context.Background(), "topic", 10))
+	assert.NoError(t, l.Wait(context.Background(), "big", 11))
+
+	var nilLimiter *Limiter
+	assert.NoError(t, nilLimiter.Allow("x", 1).Err)
+}
@@ -0,0 +1,169 @@
+package rawgrpc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// 通用接收服务, 定义见 api/proto/wormhole/v1/gate.proto
+const (
+	GateService      = "wormhole.v1.Gate"
+	MethodSend       = "/" + GateService + "/Send"
+	MethodSendStream = "/" + GateService + "/SendStream"
+)
+
+// Codec 不做编解码的gRPC编解码器, 消息为*[]byte(protobuf编码后的字节)
+// 名称为proto, 与标准的protobuf客户端/服务端兼容
+type Codec struct{}
+
+// Marshal 实现encoding.Codec
+func (Codec) Marshal(v any) ([]byte, error) {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return nil, fmt.Errorf("rawgrpc: 不支持的消息类型%T", v)
+	}
+	return *b, nil
+}
+
+// Unmarshal 实现encoding.Codec
+func (Codec) Unmarshal(data []byte, v any) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("rawgrpc: 不支持的消息类型%T", v)
+	}
+	*b = append((*b)[:0], data...)
+	return nil
+}
+
+// Name 实现encoding.Codec
+func (Codec) Name() string {
+	return "proto"
+}
+
+// SplitMethod /package.Service/Method => package.Service, Method
+func SplitMethod(fullMethod string) (service, method string) {
+	s := strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndex(s, "/"); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return s, ""
+}
+
+// Payload wormhole.v1.Payload
+// nolint
+type Payload struct {
+	Data     []byte
+	Metadata map[string]string
+}
+
+// Marshal Payload => protobuf
+func (p *Payload) Marshal() []byte {
+	var b []byte
+	if len(p.Data) > 0 {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, p.Data)
+	}
+	keys := make([]string, 0, len(p.Metadata))
+	for k := range p.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var entry []byte
+		entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+		entry = protowire.AppendString(entry, k)
+		entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+		entry = protowire.AppendString(entry, p.Metadata[k])
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+	return b
+}
+
+// Unmarshal protobuf => Payload, 未知字段被忽略
+func (p *Payload) Unmarshal(b []byte) error {
+	p.Data, p.Metadata = nil, nil
+	return eachField(b, func(num protowire.Number, v []byte) error {
+		switch num {
+		case 1:
+			p.Data = append([]byte(nil), v...)
+		case 2:
+			var key, value string
+			err := eachField(v, func(n protowire.Number, ev []byte) error {
+				switch n {
+				case 1:
+					key = string(ev)
+				case 2:
+					value = string(ev)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if p.Metadata == nil {
+				p.Metadata = make(map[string]string)
+			}
+			p.Metadata[key] = value
+		}
+		return nil
+	})
+}
+
+// SendReply wormhole.v1.SendReply
+// nolint
+type SendReply struct {
+	IDs []string
+}
+
+// Marshal SendReply => protobuf
+func (r *SendReply) Marshal() []byte {
+	var b []byte
+	for _, id := range r.IDs {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendString(b, id)
+	}
+	return b
+}
+
+// Unmarshal protobuf => SendReply
+func (r *SendReply) Unmarshal(b []byte) error {
+	r.IDs = nil
+	return eachField(b, func(num protowire.Number, v []byte) error {
+		if num == 1 {
+			r.IDs = append(r.IDs, string(v))
+		}
+		return nil
+	})
+}
+
+// eachField 遍历消息中的字段, 只有length-delimited字段会传给fn, 其他类型的字段被跳过
+func eachField(b []byte, fn func(protowire.Number, []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+			continue
+		}
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		if err := fn(num, v); err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package rawgrpc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestPayload(t *testing.T) {
+	p := &Payload{Data: []byte{0, 1, 0xff}, Metadata: map[string]string{"b": "2", "a": "1"}}
+	b := p.Marshal()
+
+	got := new(Payload)
+	assert.NoError(t, got.Unmarshal(b))
+	assert.Equal(t, p, got)
+
+	// 未知字段(包括非bytes类型)被忽略
+	b = protowire.AppendTag(b, 9, protowire.VarintType)
+	b = protowire.AppendVarint(b, 42)
+	assert.NoError(t, got.Unmarshal(b))
+	assert.Equal(t, p, got)
+
+	assert.Error(t, got.Unmarshal([]byte{0x0a, 0x05, 0x01}))
+}
+
+func TestSendReply(t *testing.T) {
+	r := &SendReply{IDs: []string{"a", "b"}}
+	got := new(SendReply)
+	assert.NoError(t, got.Unmarshal(r.Marshal()))
+	assert.Equal(t, r, got)
+}
+
+func TestSplitMethod(t *testing.T) {
+	s, m := SplitMethod(MethodSend)
+	assert.Equal(t, GateService, s)
+	assert.Equal(t, "Send", m)
+}
@@ -0,0 +1,201 @@
+package rewrite
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/route"
+)
+
+// hopByHop 逐跳请求头(RFC 9110 7.6.1), 只对一跳连接有效, 不应转发
+var hopByHop = []string{
+	"Connection", "Keep-Alive", "Proxy-Connection", "Proxy-Authenticate", "Proxy-Authorization",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// Headers 请求头操作, 按Remove, Set, Add的顺序执行
+// nolint
+type Headers struct {
+	Remove        []string          `json:"remove"`        // 删除的请求头, 支持前缀匹配(如: X-Debug-*)
+	RemoveCookies []string          `json:"removeCookies"` // 从Cookie中删除的cookie, 支持前缀匹配(如: _ga*)
+	Set           map[string]string `json:"set"`           // 替换(不存在时添加)
+	Add           map[string]string `json:"add"`           // 追加
+}
+
+// Path 路径重写: 转发路径匹配Match时替换为Replace, Replace中可以使用$1, ${name}引用捕获组
+// 匹配和替换都在编码后的路径上进行, 原始编码(如%2F)保持不变
+// nolint
+type Path struct {
+	Match   string `json:"match"`
+	Replace string `json:"replace"`
+	re      *regexp.Regexp
+}
+
+// Query 查询参数操作, 按Remove, Set的顺序执行; 修改后查询参数按名称排序
+// nolint
+type Query struct {
+	Remove []string          `json:"remove"`
+	Set    map[string]string `json:"set"`
+}
+
+// Rule 一条重写规则, 条件都满足时生效
+// nolint
+type Rule struct {
+	Name       string   `json:"name"`
+	Route      string   `json:"route"`      // 条件: 报文的路由, 为空不限制
+	PathPrefix string   `json:"pathPrefix"` // 条件: 转发路径前缀, 为空不限制
+	Headers    *Headers `json:"headers"`
+	Path       *Path    `json:"path"`
+	Query      *Query   `json:"query"`
+	Host       string   `json:"host"` // 转发请求的Host
+}
+
+// Rewriter 转发请求的重写规则
+// nolint
+type Rewriter struct {
+	KeepHopByHop bool    `json:"keepHopByHop"` // 保留逐跳请求头, 默认删除
+	Rules        []*Rule `json:"rules"`        // 按顺序执行所有生效的规则
+}
+
+// Load 从JSON文件加载重写规则
+func Load(file string) (*Rewriter, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	rw := new(Rewriter)
+	if err := json.Unmarshal(b, rw); err != nil {
+		return nil, fmt.Errorf("解析重写规则%s: %w", file, err)
+	}
+	for i, r := range rw.Rules {
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rules[%d]", i)
+		}
+		if r.Path != nil {
+			if r.Path.re, err = regexp.Compile(r.Path.Match); err != nil {
+				return nil, fmt.Errorf("规则%s的路径匹配: %w", r.Name, err)
+			}
+		}
+	}
+	return rw, nil
+}
+
+// Apply 重写转发请求, route为报文的路由; nil的Rewriter只删除逐跳请求头
+// 报文中记录的Host和Content-Length请求头总是被删除, 由转发请求决定
+func (rw *Rewriter) Apply(req *http.Request, route string) {
+	req.Header.Del("Host")
+	req.Header.Del("Content-Length")
+	if rw == nil || !rw.KeepHopByHop {
+		removeHopByHop(req.Header)
+	}
+	if rw == nil {
+		return
+	}
+	for _, r := range rw.Rules {
+		if r.match(req, route) {
+			r.apply(req)
+		}
+	}
+}
+
+func (r *Rule) match(req *http.Request, name string) bool {
+	if r.Route != "" && r.Route != name {
+		return false
+	}
+	// 与路由相同, 只在路径段的边界匹配
+	return r.PathPrefix == "" || route.HasPathPrefix(req.URL.Path, r.PathPrefix)
+}
+
+func (r *Rule) apply(req *http.Request) {
+	if h := r.Headers; h != nil {
+		for key := range req.Header {
+			if matchAny(h.Remove, key) {
+				req.Header.Del(key)
+			}
+		}
+		if len(h.RemoveCookies) > 0 {
+			removeCookies(req, h.RemoveCookies)
+		}
+		for key, value := range h.Set {
+			req.Header.Set(key, value)
+		}
+		for key, value := range h.Add {
+			req.Header.Add(key, value)
+		}
+	}
+	if p := r.Path; p != nil {
+		escaped := req.URL.EscapedPath()
+		if p.re.MatchString(escaped) {
+			escaped = p.re.ReplaceAllString(escaped, p.Replace)
+			if path, err := url.PathUnescape(escaped); err == nil {
+				req.URL.Path = path
+				req.URL.RawPath = ""
+				if req.URL.EscapedPath() != escaped {
+					req.URL.RawPath = escaped
+				}
+			}
+		}
+	}
+	if q := r.Query; q != nil {
+		values := req.URL.Query()
+		for _, key := range q.Remove {
+			values.Del(key)
+		}
+		for key, value := range q.Set {
+			values.Set(key, value)
+		}
+		req.URL.RawQuery = values.Encode()
+	}
+	if r.Host != "" {
+		req.Host = r.Host
+	}
+}
+
+// removeHopByHop 删除逐跳请求头以及Connection中列出的请求头
+func removeHopByHop(h http.Header) {
+	for _, v := range h.Values("Connection") {
+		for _, key := range strings.Split(v, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				h.Del(key)
+			}
+		}
+	}
+	for _, key := range hopByHop {
+		h.Del(key)
+	}
+}
+
+// removeCookies 从Cookie请求头中删除名称匹配的cookie
+func removeCookies(req *http.Request, names []string) {
+	cookies := req.Cookies()
+	if len(cookies) == 0 {
+		return
+	}
+	req.Header.Del("Cookie")
+	for _, c := range cookies {
+		if !matchAny(names, c.Name) {
+			req.AddCookie(c)
+		}
+	}
+}
+
+// matchAny name是否匹配patterns中的任意一个, *结尾为前缀匹配, 不区分大小写
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if len(name) >= len(prefix) && strings.EqualFold(name[:len(prefix)], prefix) {
+				return true
+			}
+			continue
+		}
+		if strings.EqualFold(p, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package rewrite
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newRequest(t *testing.T, target string) *http.Request {
+	req, err := http.NewRequest(http.MethodGet, target, http.NoBody)
+	assert.NoError(t, err)
+	req.Header.Set("Host", "gw.example.com")
+	req.Header.Set("Content-Length", "10")
+	req.Header.Set("Connection", "keep-alive, X-Hop")
+	req.Header.Set("X-Hop", "1")
+	req.Header.Set("Keep-Alive", "timeout=5")
+	req.Header.Set("X-Keep", "1")
+	return req
+}
+
+func TestHopByHop(t *testing.T) {
+	var rw *Rewriter
+	req := newRequest(t, "http://billing:9000/api/orders")
+	rw.Apply(req, "")
+	assert.Equal(t, http.Header{"X-Keep": {"1"}}, req.Header)
+
+	rw = &Rewriter{KeepHopByHop: true}
+	req = newRequest(t, "http://billing:9000/api/orders")
+	rw.Apply(req, "")
+	assert.Equal(t, "1", req.Header.Get("X-Hop"))
+	assert.Empty(t, req.Header.Get("Host"))
+}
+
+func TestRules(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "rewrite.json")
+	assert.NoError(t, os.WriteFile(file, []byte(`{
+		"rules": [
+			{"headers": {"remove": ["X-Debug-*"], "removeCookies": ["_ga*"], "set": {"X-Env": "inner"}}},
+			{"route": "billing", "pathPrefix": "/api/",
+			 "path": {"match": "^/api/v1/orders/([^/]+)$", "replace": "/orders/$1/detail"},
+			 "query": {"remove": ["token"], "set": {"src": "wormhole"}},
+			 "host": "billing.internal"},
+			{"route": "report", "headers": {"add": {"X-Env": "report"}}},
+			{"pathPrefix": "/billing", "headers": {"set": {"X-Billing": "1"}}}
+		]
+	}`), 0o600))
+	rw, err := Load(file)
+	assert.NoError(t, err)
+
+	req := newRequest(t, "http://10.0.0.1:9000/api/v1/orders/a%2Fb?token=x&id=7")
+	req.Header.Set("X-Debug-Trace", "1")
+	req.Header.Set("Cookie", "_ga=1; session=abc; _gat=2")
+	rw.Apply(req, "billing")
+	assert.Empty(t, req.Header.Get("X-Debug-Trace"))
+	assert.Equal(t, "session=abc", req.Header.Get("Cookie"))
+	assert.Equal(t, []string{"inner"}, req.Header.Values("X-Env"))
+	assert.Equal(t, "http://10.0.0.1:9000/orders/a%2Fb/detail?id=7&src=wormhole", req.URL.String())
+	assert.Equal(t, "billing.internal", req.Host)
+
+	req = newRequest(t, "http://10.0.0.2/api/v1/orders/1?token=x")
+	rw.Apply(req, "report")
+	assert.Equal(t, []string{"inner", "report"}, req.Header.Values("X-Env"))
+	assert.Equal(t, "/api/v1/orders/1", req.URL.Path)
+	assert.Equal(t, "token=x", req.URL.RawQuery)
+
+	// pathPrefix在路径段的边界匹配
+	for path, want := range map[string]string{"/billing": "1", "/billing/orders": "1", "/billingfoo": ""} {
+		req = newRequest(t, "http://10.0.0.3"+path)
+		rw.Apply(req, "")
+		assert.Equal(t, want, req.Header.Get("X-Billing"), path)
+	}
+
+	assert.NoError(t, os.WriteFile(file, []byte(`{"rules": [{"path": {"match": "("}}]}`), 0o600))
+	_, err = Load(file)
+	assert.Error(t, err)
+}
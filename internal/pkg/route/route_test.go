@@ -0,0 +1,124 @@
+package route
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "routes.json")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestTableMatch(t *testing.T) {
+	table, err := LoadTable(writeFile(t, `{
+		"routes": [
+			{"name": "billing-write", "methods": ["POST"], "pathPrefix": "/billing/"},
+			{"name": "billing", "pathPrefix": "/billing/"},
+			{"name": "report", "host": "*.report.local", "pathPrefix": "/"}
+		]
+	}`))
+	assert.NoError(t, err)
+	tests := []struct {
+		method, host, path string
+		want               string
+		wantErr            bool
+	}{
+		{method: "POST", host: "gw", path: "/billing/orders", want: "billing-write"},
+		{method: "GET", host: "gw", path: "/billing/orders", want: "billing"},
+		{method: "GET", host: "a.report.local:8080", path: "/x", want: "report"},
+		{method: "GET", host: "report.local", path: "/x", wantErr: true},
+		// 按路径段匹配
+		{method: "GET", host: "gw", path: "/billing", want: "billing"},
+		{method: "GET", host: "gw", path: "/billingfoo", wantErr: true},
+		// 按清理后的路径匹配
+		{method: "GET", host: "gw", path: "/billing/../admin", wantErr: true},
+		{method: "GET", host: "gw", path: "/billing/./orders", want: "billing"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "http://"+tt.host+tt.path, nil)
+		got, err := table.Match(r)
+		if tt.wantErr {
+			assert.ErrorIs(t, err, ErrNoRoute)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, got)
+	}
+
+	table.Default = "legacy"
+	got, err := table.Match(httptest.NewRequest("GET", "http://other/x", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, "legacy", got)
+}
+
+func TestTargetsResolve(t *testing.T) {
+	targets, err := LoadTargets(writeFile(t, `{
+		"routes": {
+			"billing": {"url": "http://billing.internal:9000/api", "stripPrefix": "/billing"},
+			"report": {"url": "https://report.internal"}
+		}
+	}`), nil)
+	assert.NoError(t, err)
+
+	tg, err := targets.Lookup("billing")
+	assert.NoError(t, err)
+	u := tg.Resolve(&url.URL{Path: "/billing/orders", RawQuery: "id=1"})
+	assert.Equal(t, "http://billing.internal:9000/api/orders?id=1", u.String())
+	assert.Equal(t, "billing.internal:9000", tg.Addr())
+	u = tg.Resolve(&url.URL{Path: "/billing/a/b%c", RawPath: "/billing/a%2Fb%25c", RawQuery: "q=100%25"})
+	assert.Equal(t, "http://billing.internal:9000/api/a%2Fb%25c?q=100%25", u.String())
+	// 只在路径段的边界去掉前缀
+	u = tg.Resolve(&url.URL{Path: "/billingfoo"})
+	assert.Equal(t, "http://billing.internal:9000/api/billingfoo", u.String())
+	u = tg.Resolve(&url.URL{Path: "/billing"})
+	assert.Equal(t, "http://billing.internal:9000/api", u.String())
+
+	tg, err = targets.Lookup("report")
+	assert.NoError(t, err)
+	u = tg.Resolve(&url.URL{Path: "/daily"})
+	assert.Equal(t, "https://report.internal/daily", u.String())
+	assert.Equal(t, "report.internal:443", tg.Addr())
+
+	_, err = targets.Lookup("unknown")
+	assert.ErrorIs(t, err, ErrNoRoute)
+
+	_, err = LoadTargets(writeFile(t, `{"routes": {"bad": {"url": "billing:9000"}}}`), nil)
+	assert.Error(t, err)
+}
+
+func TestTargetsUpstreams(t *testing.T) {
+	targets, err := LoadTargets(writeFile(t, `{
+		"routes": {
+			"billing": {
+				"upstreams": ["http://10.0.0.1:9000/api", "http://10.0.0.2:9000/api"],
+				"stripPrefix": "/billing", "balance": "hash", "hashHeader": "X-Tenant"
+			}
+		},
+		"default": {"url": "http://legacy:8080"}
+	}`), nil)
+	assert.NoError(t, err)
+	tg, err := targets.Lookup("billing")
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.1:9000,10.0.0.2:9000", tg.Addr())
+
+	header := http.Header{"X-Tenant": {"t1"}}
+	m := tg.Pick(header, "/billing/orders")
+	u := tg.ResolveOn(m, &url.URL{Path: "/billing/orders"})
+	assert.Equal(t, "http://"+m.Addr()+"/api/orders", u.String())
+	tg.Done(m, nil)
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, m, tg.Pick(header, "/billing/other"))
+	}
+	assert.Equal(t, "legacy:8080", targets.Default.Addr())
+
+	_, err = LoadTargets(writeFile(t, `{"routes": {"bad": {"url": "http://a", "upstreams": ["http://b"]}}}`), nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,114 @@
+package route
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+var ErrNoRoute = errors.New("没有匹配的路由")
+
+// Rule 星门的路由规则, 字段为空表示不限制
+// nolint
+type Rule struct {
+	Name       string   `json:"name"`
+	Methods    []string `json:"methods"`    // 如: ["GET", "POST"]
+	Host       string   `json:"host"`       // 如: api.example.com, *.example.com
+	PathPrefix string   `json:"pathPrefix"` // 按路径段匹配, 如: /billing 匹配 /billing 和 /billing/orders, 不匹配 /billingfoo
+}
+
+// match 请求是否符合规则
+func (rl *Rule) match(method, host, path string) bool {
+	if len(rl.Methods) > 0 {
+		ok := false
+		for _, m := range rl.Methods {
+			if strings.EqualFold(m, method) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if rl.Host != "" && !matchHost(rl.Host, host) {
+		return false
+	}
+	return HasPathPrefix(path, rl.PathPrefix)
+}
+
+// HasPathPrefix 路径p是否以prefix开头, 只在路径段的边界匹配; prefix末尾的/可以省略
+func HasPathPrefix(p, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return prefix == "" || p == prefix || strings.HasPrefix(p, prefix+"/")
+}
+
+// cleanPath 去掉路径中的.和..等, 按清理后的路径匹配
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	return path.Clean("/" + p)
+}
+
+// matchHost 支持精确匹配和 *.example.com 形式的通配
+func matchHost(pattern, host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+		return len(host) > len(suffix) && strings.HasSuffix(strings.ToLower(host), strings.ToLower(suffix))
+	}
+	return strings.EqualFold(pattern, host)
+}
+
+// Table 星门的路由表, 按顺序匹配, 第一个符合的规则生效
+// nolint
+type Table struct {
+	Default string `json:"default"` // 没有规则匹配时使用的路由, 为空时拒绝请求
+	Routes  []Rule `json:"routes"`
+}
+
+// LoadTable 从JSON文件加载路由表
+func LoadTable(path string) (*Table, error) {
+	t := new(Table)
+	if err := loadJSON(path, t); err != nil {
+		return nil, err
+	}
+	for i, rl := range t.Routes {
+		if rl.Name == "" {
+			return nil, fmt.Errorf("第%d条路由没有名称", i+1)
+		}
+	}
+	return t, nil
+}
+
+// Match 返回请求匹配到的路由名称
+func (t *Table) Match(r *http.Request) (string, error) {
+	p := cleanPath(r.URL.Path)
+	for i := range t.Routes {
+		if t.Routes[i].match(r.Method, r.Host, p) {
+			return t.Routes[i].Name, nil
+		}
+	}
+	if t.Default != "" {
+		return t.Default, nil
+	}
+	return "", ErrNoRoute
+}
+
+func loadJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("解析%s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package route
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/upstream"
+	"github.com/chengfeiZhou/Wormhole/pkg/certs"
+)
+
+// Target 次元的转发目标: 一个(url)或一组(upstreams)上游
+// nolint
+type Target struct {
+	URL         string                `json:"url"`         // 目标地址, 可以带路径前缀, 如: http://billing.internal:8080/api
+	Upstreams   []string              `json:"upstreams"`   // 多个目标地址, 与url二选一
+	StripPrefix string                `json:"stripPrefix"` // 转发前从请求路径中去掉的前缀, 如: /billing
+	Balance     string                `json:"balance"`     // 负载均衡方式: round_robin(默认), least_inflight, hash
+	HashHeader  string                `json:"hashHeader"`  // hash均衡时作为key的请求头, 为空时使用请求路径; 请求中没有该请求头时轮询
+	HealthCheck *upstream.HealthCheck `json:"healthCheck"` // 主动健康检查, 为空不检查
+	Outlier     *upstream.Outlier     `json:"outlier"`     // 被动异常摘除, 为空不摘除
+	TLS         *certs.ClientTLS      `json:"tls"`         // 连接https上游的TLS配置, 为空时使用全局配置
+	group       *upstream.Group
+}
+
+// TransportFunc 返回转发到目标使用的Transport, 上游组的主动健康检查使用同一个Transport
+type TransportFunc func(t *Target) (http.RoundTripper, error)
+
+// init 解析目标地址并创建上游组, transport为空时使用http.DefaultTransport
+func (t *Target) init(transport TransportFunc) error {
+	addrs := t.Upstreams
+	if len(addrs) == 0 {
+		addrs = []string{t.URL}
+	} else if t.URL != "" {
+		return fmt.Errorf("url与upstreams只能设置一个")
+	}
+	urls := make([]*url.URL, 0, len(addrs))
+	for _, addr := range addrs {
+		u, err := url.Parse(addr)
+		if err != nil {
+			return fmt.Errorf("目标地址: %w", err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("目标地址必须是http(s)://host[:port][/path]: %s", addr)
+		}
+		urls = append(urls, u)
+	}
+	var rt http.RoundTripper
+	if transport != nil {
+		var err error
+		if rt, err = transport(t); err != nil {
+			return err
+		}
+	}
+	g, err := upstream.NewGroup(urls, t.Balance, t.HealthCheck, t.Outlier, rt)
+	if err != nil {
+		return err
+	}
+	t.group = g
+	return nil
+}
+
+// Pick 为请求选择一个上游, 请求结束后必须调用Done
+func (t *Target) Pick(header http.Header, path string) *upstream.Member {
+	key := path
+	if t.HashHeader != "" {
+		key = header.Get(t.HashHeader)
+	}
+	return t.group.Pick(key)
+}
+
+// Done 上报请求结果, err不为空(包括5xx)时计入上游的连续出错次数
+func (t *Target) Done(m *upstream.Member, err error) {
+	t.group.Done(m, err)
+}
+
+// Group 返回目标的上游组
+func (t *Target) Group() *upstream.Group {
+	return t.group
+}
+
+// Resolve 根据原始请求的地址生成转发到第一个上游的地址
+func (t *Target) Resolve(ru *url.URL) *url.URL {
+	return t.ResolveOn(t.group.Members()[0], ru)
+}
+
+// ResolveOn 根据原始请求的地址生成转发到上游m的地址
+// 路径: 上游地址的路径 + 去掉StripPrefix后的请求路径, 原始请求路径中的编码(如%2F)保持不变
+func (t *Target) ResolveOn(m *upstream.Member, ru *url.URL) *url.URL {
+	base := m.URL
+	u := *base
+	u.Path = joinPath(base.Path, stripPrefix(ru.Path, t.StripPrefix))
+	u.RawPath = ""
+	if ru.RawPath != "" {
+		prefix := (&url.URL{Path: t.StripPrefix}).EscapedPath()
+		u.RawPath = joinPath(base.EscapedPath(), stripPrefix(ru.EscapedPath(), prefix))
+	}
+	u.RawQuery = ru.RawQuery
+	u.Fragment = ""
+	return &u
+}
+
+// stripPrefix 去掉路径p的前缀prefix, 只在路径段的边界去掉(/billing不会从/billingfoo中去掉)
+func stripPrefix(p, prefix string) string {
+	if prefix == "" || !HasPathPrefix(p, prefix) {
+		return p
+	}
+	return p[len(strings.TrimSuffix(prefix, "/")):]
+}
+
+// joinPath 拼接目标路径和请求路径
+func joinPath(base, p string) string {
+	if p != "" && !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	if p = strings.TrimSuffix(base, "/") + p; p == "" {
+		p = "/"
+	}
+	return p
+}
+
+// Addr 返回目标的 host:port(多个上游时以逗号分隔), 用于区分转发目标
+func (t *Target) Addr() string {
+	addrs := make([]string, 0, len(t.group.Members()))
+	for _, m := range t.group.Members() {
+		addrs = append(addrs, m.Addr())
+	}
+	return strings.Join(addrs, ",")
+}
+
+// Targets 次元的路由 => 转发目标
+// nolint
+type Targets struct {
+	Routes  map[string]*Target `json:"routes"`
+	Default *Target            `json:"default"` // 没有路由的报文的转发目标, 为空时转发到bind
+}
+
+// LoadTargets 从JSON文件加载转发目标, transport返回每个目标转发和主动健康检查使用的Transport
+func LoadTargets(path string, transport TransportFunc) (*Targets, error) {
+	t := new(Targets)
+	if err := loadJSON(path, t); err != nil {
+		return nil, err
+	}
+	for name, tg := range t.Routes {
+		if err := tg.init(transport); err != nil {
+			return nil, fmt.Errorf("路由%s: %w", name, err)
+		}
+	}
+	if t.Default != nil {
+		if err := t.Default.init(transport); err != nil {
+			return nil, fmt.Errorf("默认目标: %w", err)
+		}
+	}
+	return t, nil
+}
+
+// Run 执行所有目标的主动健康检查, ctx结束时返回
+func (t *Targets) Run(ctx context.Context) {
+	done := make(chan struct{})
+	n := 0
+	for _, tg := range t.All() {
+		n++
+		go func(g *upstream.Group) {
+			g.Run(ctx)
+			done <- struct{}{}
+		}(tg.group)
+	}
+	for ; n > 0; n-- {
+		<-done
+	}
+}
+
+// All 返回所有目标(包括默认目标)
+func (t *Targets) All() []*Target {
+	all := make([]*Target, 0, len(t.Routes)+1)
+	for _, tg := range t.Routes {
+		all = append(all, tg)
+	}
+	if t.Default != nil {
+		all = append(all, t.Default)
+	}
+	return all
+}
+
+// Lookup 返回路由对应的转发目标
+func (t *Targets) Lookup(name string) (*Target, error) {
+	tg, ok := t.Routes[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoRoute, name)
+	}
+	return tg, nil
+}
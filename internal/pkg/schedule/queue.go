@@ -0,0 +1,225 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const queueExt = ".msg"
+
+// 读取失败的报文的重试间隔, 每次失败加倍
+const (
+	retryMin = time.Second
+	retryMax = time.Minute
+)
+
+// item 延迟队列中的一条报文, name: <到期时间ms>-<入队序号>.msg
+type item struct {
+	name  string
+	due   int64
+	seq   int64
+	fails int // 连续读取失败的次数
+}
+
+// Queue 持久化的延迟队列: 每条报文保存为dir下的一个文件, 按到期时间和入队顺序释放
+// 重启后从目录中恢复未释放的报文
+// nolint
+type Queue struct {
+	dir   string
+	mu    sync.Mutex
+	items []item // 按(due, seq)排序
+	seq   int64  // 最后使用的入队序号
+	wake  chan struct{}
+}
+
+// OpenQueue 打开(或创建)延迟队列目录并加载其中的报文
+func OpenQueue(dir string) (*Queue, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	q := &Queue{dir: dir, wake: make(chan struct{}, 1)}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() {
+			continue
+		}
+		if !strings.HasSuffix(name, queueExt) {
+			// 写入未完成的临时文件
+			_ = os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		it, ok := parseItem(name)
+		if !ok {
+			continue
+		}
+		q.items = append(q.items, it)
+		q.seq = max(q.seq, it.seq)
+	}
+	sort.Slice(q.items, func(i, j int) bool { return q.items[i].less(q.items[j]) })
+	return q, nil
+}
+
+func parseItem(name string) (item, bool) {
+	d, s, ok := strings.Cut(strings.TrimSuffix(name, queueExt), "-")
+	due, err1 := strconv.ParseInt(d, 10, 64)
+	seq, err2 := strconv.ParseInt(s, 10, 64)
+	if !ok || err1 != nil || err2 != nil {
+		return item{}, false
+	}
+	return item{name: name, due: due, seq: seq}, true
+}
+
+func (it item) less(o item) bool {
+	if it.due != o.due {
+		return it.due < o.due
+	}
+	return it.seq < o.seq
+}
+
+// Push 保存报文, 到期后由Run释放
+func (q *Queue) Push(due time.Time, data []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.seq++
+	it := item{due: due.UnixMilli(), seq: q.seq}
+	it.name = fmt.Sprintf("%013d-%012d%s", it.due, it.seq, queueExt)
+	tmp := filepath.Join(q.dir, it.name+".tmp")
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(q.dir, it.name)); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	q.insert(it)
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// insert 按(due, seq)插入索引
+func (q *Queue) insert(it item) {
+	i := sort.Search(len(q.items), func(i int) bool { return it.less(q.items[i]) })
+	q.items = append(q.items, item{})
+	copy(q.items[i+1:], q.items[i:])
+	q.items[i] = it
+}
+
+// Len 队列中的报文数
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// Next 最早到期的报文的到期时间, 队列为空时返回false
+func (q *Queue) Next() (time.Time, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) == 0 {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(q.items[0].due), true
+}
+
+// Run 按顺序释放到期的报文, ctx结束时返回
+// release返回后报文从队列中删除; release返回错误时(如ctx结束)报文保留并返回, 重启后重新释放
+// 读取或删除报文文件失败时调用failed; 读取失败的报文保留在队列中, 退避后重试; 文件已不存在的报文从队列中删除
+func (q *Queue) Run(ctx context.Context, release func(context.Context, []byte) error, failed func(name string, err error)) {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		q.mu.Lock()
+		var (
+			head item
+			wait = time.Hour
+		)
+		if len(q.items) > 0 {
+			head = q.items[0]
+			wait = time.Until(time.UnixMilli(head.due))
+		}
+		q.mu.Unlock()
+		if head.name != "" && wait <= 0 {
+			path := filepath.Join(q.dir, head.name)
+			data, err := os.ReadFile(path)
+			switch {
+			case err == nil:
+				if release(ctx, data) != nil {
+					return
+				}
+				// 删除失败的报文在重启后会再次释放
+				if err = os.Remove(path); err != nil {
+					failed(head.name, err)
+				}
+				q.remove(head.name)
+			case errors.Is(err, fs.ErrNotExist):
+				failed(head.name, err)
+				q.remove(head.name)
+			default:
+				failed(head.name, err)
+				q.retry(head.name)
+			}
+			continue
+		}
+		timer.Reset(wait)
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-timer.C:
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+	}
+}
+
+// retry 读取失败的报文推迟到退避之后重试, 文件名中的到期时间不变
+func (q *Queue) retry(name string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, it := range q.items {
+		if it.name != name {
+			continue
+		}
+		q.items = append(q.items[:i], q.items[i+1:]...)
+		it.fails++
+		backoff := retryMin
+		for n := 1; n < it.fails && backoff < retryMax; n++ {
+			backoff *= 2
+		}
+		it.due = time.Now().Add(min(backoff, retryMax)).UnixMilli()
+		q.insert(it)
+		return
+	}
+}
+
+// remove 从索引中删除报文, 释放期间可能有更早到期的报文入队, 按名称查找
+func (q *Queue) remove(name string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, it := range q.items {
+		if it.name == name {
+			q.items = append(q.items[:i], q.items[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package schedule
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Window 投递时间窗口
+// nolint
+type Window struct {
+	Days  []string `json:"days"`  // 星期: mon, tue, ..., sun, 支持范围(如: mon-fri); 为空不限制
+	Start string   `json:"start"` // 开始时间HH:MM
+	End   string   `json:"end"`   // 结束时间HH:MM(不包含), 不晚于start时跨过零点
+	days  [7]bool
+	start int // 分钟
+	end   int // 分钟, 跨过零点时大于24h
+}
+
+func (w *Window) init() error {
+	var err error
+	if w.start, err = parseClock(w.Start); err != nil {
+		return err
+	}
+	if w.end, err = parseClock(w.End); err != nil {
+		return err
+	}
+	if w.end <= w.start {
+		w.end += 24 * 60
+	}
+	if len(w.Days) == 0 {
+		w.days = [7]bool{true, true, true, true, true, true, true}
+		return nil
+	}
+	for _, d := range w.Days {
+		from, to, _ := strings.Cut(strings.ToLower(d), "-")
+		if to == "" {
+			to = from
+		}
+		f, ok1 := weekdays[from]
+		t, ok2 := weekdays[to]
+		if !ok1 || !ok2 {
+			return fmt.Errorf("星期格式错误: %s", d)
+		}
+		for i := f; ; i = (i + 1) % 7 {
+			w.days[i] = true
+			if i == t {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// parseClock 解析HH:MM, 返回分钟数; 支持24:00
+func parseClock(s string) (int, error) {
+	h, m, ok := strings.Cut(s, ":")
+	hour, err1 := strconv.Atoi(h)
+	minute, err2 := strconv.Atoi(m)
+	if !ok || err1 != nil || err2 != nil || hour < 0 || minute < 0 || minute > 59 || hour*60+minute > 24*60 {
+		return 0, fmt.Errorf("时间格式错误(HH:MM): %s", s)
+	}
+	return hour*60 + minute, nil
+}
+
+// Plan 路由的投递计划
+// nolint
+type Plan struct {
+	Timezone string    `json:"timezone"` // 投递窗口使用的时区(IANA, 如: Asia/Shanghai), 默认本地时区
+	Windows  []*Window `json:"windows"`  // 投递窗口, 满足任意一个即可投递; 为空不限制
+	loc      *time.Location
+}
+
+func (p *Plan) init() error {
+	p.loc = time.Local
+	if p.Timezone != "" {
+		loc, err := time.LoadLocation(p.Timezone)
+		if err != nil {
+			return err
+		}
+		p.loc = loc
+	}
+	for i, w := range p.Windows {
+		if err := w.init(); err != nil {
+			return fmt.Errorf("windows[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// next 返回不早于t且在投递窗口内的最早时间
+func (p *Plan) next(t time.Time) time.Time {
+	if len(p.Windows) == 0 {
+		return t
+	}
+	lt := t.In(p.loc)
+	var best time.Time
+	// 从前一天开始, 包括跨过零点的窗口
+	for offset := -1; offset <= 7; offset++ {
+		day := time.Date(lt.Year(), lt.Month(), lt.Day()+offset, 0, 0, 0, 0, p.loc)
+		for _, w := range p.Windows {
+			if !w.days[day.Weekday()] {
+				continue
+			}
+			start := day.Add(time.Duration(w.start) * time.Minute)
+			end := day.Add(time.Duration(w.end) * time.Minute)
+			if !t.Before(start) && t.Before(end) {
+				return t
+			}
+			if start.After(t) && (best.IsZero() || start.Before(best)) {
+				best = start
+			}
+		}
+	}
+	if best.IsZero() {
+		// 没有任何一天满足窗口(配置错误), 不再延迟
+		return t
+	}
+	return best
+}
+
+// Schedule 路由 => 投递计划
+// nolint
+type Schedule struct {
+	Routes  map[string]*Plan `json:"routes"`
+	Default *Plan            `json:"default"` // 没有路由或路由没有配置计划时使用, 为空不限制
+}
+
+// Load 从JSON文件加载投递计划
+func Load(file string) (*Schedule, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	s := new(Schedule)
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("解析投递计划%s: %w", file, err)
+	}
+	for name, p := range s.Routes {
+		if err := p.init(); err != nil {
+			return nil, fmt.Errorf("路由%s的投递计划: %w", name, err)
+		}
+	}
+	if s.Default != nil {
+		if err := s.Default.init(); err != nil {
+			return nil, fmt.Errorf("默认投递计划: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// Due 返回报文可以投递的最早时间: 不早于deliverAfter且在路由的投递窗口内
+// nil的Schedule只考虑deliverAfter
+func (s *Schedule) Due(route string, deliverAfter time.Time) time.Time {
+	if s == nil {
+		return deliverAfter
+	}
+	p, ok := s.Routes[route]
+	if !ok || route == "" {
+		p = s.Default
+	}
+	if p == nil {
+		return deliverAfter
+	}
+	return p.next(deliverAfter)
+}
@@ -0,0 +1,158 @@
+package schedule
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDue(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "schedule.json")
+	assert.NoError(t, os.WriteFile(file, []byte(`{
+		"routes": {
+			"billing": {"timezone": "Asia/Shanghai", "windows": [{"days": ["mon-fri"], "start": "09:00", "end": "18:00"}]},
+			"batch": {"timezone": "UTC", "windows": [{"start": "22:00", "end": "02:00"}]}
+		}
+	}`), 0o600))
+	s, err := Load(file)
+	assert.NoError(t, err)
+	cst, _ := time.LoadLocation("Asia/Shanghai")
+
+	// 周三 10:00 在窗口内
+	wed := time.Date(2026, 10, 14, 10, 0, 0, 0, cst)
+	assert.Equal(t, wed, s.Due("billing", wed))
+	// 周五 19:00 => 下周一 09:00
+	fri := time.Date(2026, 10, 16, 19, 0, 0, 0, cst)
+	assert.Equal(t, time.Date(2026, 10, 19, 9, 0, 0, 0, cst), s.Due("billing", fri))
+	// 跨过零点的窗口
+	at := time.Date(2026, 10, 14, 1, 0, 0, 0, time.UTC)
+	assert.Equal(t, at, s.Due("batch", at))
+	at = time.Date(2026, 10, 14, 3, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2026, 10, 14, 22, 0, 0, 0, time.UTC), s.Due("batch", at))
+	// 没有计划的路由不限制
+	assert.Equal(t, fri, s.Due("report", fri))
+	var nilSchedule *Schedule
+	assert.Equal(t, fri, nilSchedule.Due("billing", fri))
+
+	assert.NoError(t, os.WriteFile(file, []byte(`{"default": {"windows": [{"days": ["mon-xyz"], "start": "09:00", "end": "18:00"}]}}`), 0o600))
+	_, err = Load(file)
+	assert.Error(t, err)
+	assert.NoError(t, os.WriteFile(file, []byte(`{"default": {"windows": [{"start": "9", "end": "18:00"}]}}`), 0o600))
+	_, err = Load(file)
+	assert.Error(t, err)
+}
+
+func TestQueue(t *testing.T) {
+	dir := t.TempDir()
+	q, err := OpenQueue(dir)
+	assert.NoError(t, err)
+	now := time.Now()
+	assert.NoError(t, q.Push(now.Add(time.Hour), []byte("later")))
+	assert.NoError(t, q.Push(now.Add(-time.Second), []byte("b")))
+	assert.NoError(t, q.Push(now.Add(-2*time.Second), []byte("a")))
+	assert.NoError(t, q.Push(now.Add(-time.Second), []byte("c")))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "x.msg.tmp"), []byte("partial"), 0o600))
+
+	// 重新打开后恢复, 删除未完成的临时文件
+	q, err = OpenQueue(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, q.Len())
+	_, err = os.Stat(filepath.Join(dir, "x.msg.tmp"))
+	assert.True(t, os.IsNotExist(err))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	released := make(chan string, 4)
+	done := make(chan struct{})
+	go func() {
+		q.Run(ctx, func(_ context.Context, data []byte) error {
+			released <- string(data)
+			return nil
+		}, func(name string, err error) {
+			t.Errorf("%s: %v", name, err)
+		})
+		close(done)
+	}()
+	// 按到期时间和入队顺序释放
+	for _, want := range []string{"a", "b", "c"} {
+		select {
+		case got := <-released:
+			assert.Equal(t, want, got)
+		case <-time.After(time.Second):
+			t.Fatal("到期的报文没有释放")
+		}
+	}
+	// 新入队的到期报文唤醒Run
+	assert.NoError(t, q.Push(now, []byte("d")))
+	select {
+	case got := <-released:
+		assert.Equal(t, "d", got)
+	case <-time.After(time.Second):
+		t.Fatal("新入队的报文没有释放")
+	}
+	cancel()
+	<-done
+	assert.Equal(t, 1, q.Len())
+	next, ok := q.Next()
+	assert.True(t, ok)
+	assert.Equal(t, now.Add(time.Hour).UnixMilli(), next.UnixMilli())
+	entries, _ := os.ReadDir(dir)
+	assert.Len(t, entries, 1)
+}
+
+func TestQueueReadError(t *testing.T) {
+	dir := t.TempDir()
+	q, err := OpenQueue(dir)
+	assert.NoError(t, err)
+	now := time.Now()
+	assert.NoError(t, q.Push(now.Add(-2*time.Second), []byte("a")))
+	assert.NoError(t, q.Push(now.Add(-time.Second), []byte("b")))
+	assert.NoError(t, q.Push(now.Add(-time.Second), []byte("gone")))
+	q.mu.Lock()
+	a, gone := q.items[0].name, q.items[2].name
+	q.mu.Unlock()
+	// a无法读取, gone已被删除
+	assert.NoError(t, os.Remove(filepath.Join(dir, a)))
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, a), 0o755))
+	assert.NoError(t, os.Remove(filepath.Join(dir, gone)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	released := make(chan string, 4)
+	failed := make(chan string, 4)
+	done := make(chan struct{})
+	go func() {
+		q.Run(ctx, func(_ context.Context, data []byte) error {
+			released <- string(data)
+			return nil
+		}, func(name string, err error) {
+			failed <- name
+		})
+		close(done)
+	}()
+	next := func(ch <-chan string) string {
+		select {
+		case s := <-ch:
+			return s
+		case <-time.After(2 * time.Second):
+			t.Fatal("超时")
+			return ""
+		}
+	}
+
+	// 读取失败的报文保留在队列中, 不阻塞之后的报文
+	assert.Equal(t, a, next(failed))
+	assert.Equal(t, "b", next(released))
+	assert.Equal(t, gone, next(failed))
+	assert.Equal(t, 1, q.Len())
+
+	// 退避后重试
+	assert.NoError(t, os.Remove(filepath.Join(dir, a)))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, a), []byte("a"), 0o600))
+	assert.Equal(t, "a", next(released))
+	cancel()
+	<-done
+	assert.Zero(t, q.Len())
+}
@@ -0,0 +1,42 @@
+package structs
+
+import "encoding/json"
+
+const (
+	GRPCKindPayload = "payload" // 通用接收服务(wormhole.v1.Gate)的报文
+	GRPCKindCall    = "call"    // 捕获的一元调用
+)
+
+// GRPCMessage gRPC报文结构体
+// nolint
+type GRPCMessage struct {
+	Meta
+	Kind       string              `json:"kind"`                 // payload, call
+	Method     string              `json:"method"`               // /package.Service/Method
+	Metadata   map[string][]string `json:"metadata"`             // 调用方的gRPC metadata
+	Data       []byte              `json:"data"`                 // payload: Payload.data; call: 请求的protobuf编码
+	Attributes map[string]string   `json:"attributes,omitempty"` // payload: Payload.metadata
+
+	RemoteAddr     string          `json:"remoteAddr"`
+	ClientIdentity *ClientIdentity `json:"clientIdentity,omitempty"` // 通过mTLS校验的客户端身份
+	Principal      *Principal      `json:"principal,omitempty"`      // 通过星门认证的调用方
+}
+
+// Unmarshal []byte => 报文结构
+func (msg *GRPCMessage) Unmarshal(b []byte) error {
+	return json.Unmarshal(b, msg)
+}
+
+// Marshal 报文结构 => []byte
+func (msg *GRPCMessage) Marshal() ([]byte, error) {
+	return json.Marshal(msg)
+}
+
+// TransGRPCMessage []byte => GRPCMessage
+func TransGRPCMessage(line []byte) (Message, error) {
+	data := new(GRPCMessage)
+	if err := data.Unmarshal(line); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
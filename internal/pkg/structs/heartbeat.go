@@ -0,0 +1,41 @@
+package structs
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
+// heartbeatPrefix 心跳记录在搬运文件中的行首, 用于和报文区分
+var heartbeatPrefix = []byte(`{"wormholeHeartbeat":`)
+
+// Heartbeat 星门定时写入搬运文件的心跳记录, 次元据此判断对端是否存活
+// nolint
+type Heartbeat struct {
+	Time int64  `json:"wormholeHeartbeat"` // 星门发出心跳的时间(ms), 必须是第一个字段
+	Name string `json:"name"`              // 星门服务名称
+}
+
+// NewHeartbeat 创建一条当前时间的心跳记录
+func NewHeartbeat(name string) *Heartbeat {
+	return &Heartbeat{Time: time.Now().UnixMilli(), Name: name}
+}
+
+// Marshal 心跳 => []byte
+func (hb *Heartbeat) Marshal() ([]byte, error) {
+	return json.Marshal(hb)
+}
+
+// IsHeartbeat 判断搬运文件中的一行是否为心跳记录
+func IsHeartbeat(line []byte) bool {
+	return bytes.HasPrefix(line, heartbeatPrefix)
+}
+
+// ParseHeartbeat []byte => 心跳
+func ParseHeartbeat(line []byte) (*Heartbeat, error) {
+	hb := new(Heartbeat)
+	if err := json.Unmarshal(line, hb); err != nil {
+		return nil, err
+	}
+	return hb, nil
+}
@@ -3,6 +3,7 @@ package structs
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -10,13 +11,39 @@ import (
 	"strings"
 )
 
+// HTTPMessageVersion 当前HTTP报文格式的版本
+// 1: url中以%s代替host, body为字符串(没有v字段)
+// 2: 结构化的url字段, body为字节(JSON中为base64)
+const HTTPMessageVersion = 2
+
+var (
+	ErrBodyTooLarge   = errors.New("请求体超出限制")
+	ErrUnknownVersion = errors.New("未知的报文版本")
+)
+
+// BodyRef 落盘的请求体: 请求体被分块写入搬运目录, 搬运记录中只保留引用
+// nolint
+type BodyRef struct {
+	ID     string `json:"id"`
+	Size   int64  `json:"size"`
+	Chunks int    `json:"chunks"`
+	SHA256 string `json:"sha256"` // 完整请求体的sha256(16进制)
+}
+
 // HTTPMessage 请求报文结构体
 // nolint
 type HTTPMessage struct {
-	Method string              `json:"method"`
-	URL    string              `json:"url"` // 被去除了HOST的 scheme://userinfo@/{host}/path?query#fragment
-	Header map[string][]string `json:"header"`
-	Body   string              `json:"body"`
+	Meta
+	Version  int                 `json:"v"`
+	Method   string              `json:"method"`
+	Scheme   string              `json:"scheme"`             // 原始请求的协议: http, https
+	Host     string              `json:"host"`               // 原始请求的Host
+	Path     string              `json:"path"`               // 解码后的路径
+	RawPath  string              `json:"rawPath,omitempty"`  // 原始的编码路径, 仅在与Path的默认编码不同时设置(同url.URL)
+	RawQuery string              `json:"rawQuery,omitempty"` // 原始的查询参数, 不含?
+	Fragment string              `json:"fragment,omitempty"`
+	Header   map[string][]string `json:"header"`
+	Body     []byte              `json:"body"`
 
 	RemoteAddr       string              `json:"remoteAddr"`
 	Proto            string              `json:"proto"`         // "HTTP/1.0"
@@ -25,9 +52,38 @@ type HTTPMessage struct {
 	Form             map[string][]string `json:"form"`
 	PostForm         map[string][]string `json:"postForm"`
 	Trailer          map[string][]string `json:"trailer"`
+	ClientIdentity   *ClientIdentity     `json:"clientIdentity,omitempty"` // 通过mTLS校验的客户端身份
+	Principal        *Principal          `json:"principal,omitempty"`      // 通过星门认证的调用方
+	BodyRef          *BodyRef            `json:"bodyRef,omitempty"`        // 落盘的请求体, 不为空时Body为空
 	// MultipartForm    *multipart.Form     `json:"multipartForm"` // TODO: 文件解析会有内容的问题
 }
 
+// httpMessageV1 版本1的报文, 与版本2只有url和body不同
+// nolint
+type httpMessageV1 struct {
+	*HTTPMessage
+	URL  string `json:"url"` // 被去除了HOST的 scheme://userinfo@/{host}/path?query#fragment
+	Body string `json:"body"`
+}
+
+// upgrade 版本1 => 版本2
+func (v1 *httpMessageV1) upgrade() error {
+	msg := v1.HTTPMessage
+	// %s 是被去掉的host, 合法的url编码中不会出现%s, 第一个就是占位符
+	u, err := url.Parse(strings.Replace(v1.URL, "%s", "", 1))
+	if err != nil {
+		return err
+	}
+	msg.Version = HTTPMessageVersion
+	msg.Scheme = u.Scheme
+	msg.Path = u.Path
+	msg.RawPath = u.RawPath
+	msg.RawQuery = u.RawQuery
+	msg.Fragment = u.Fragment
+	msg.Body = []byte(v1.Body)
+	return nil
+}
+
 // Unmarshal 是一个HTTPMessage类型的方法，用于将JSON格式的字节数组解析到HTTPMessage结构体中
 //
 // 参数：
@@ -38,7 +94,24 @@ type HTTPMessage struct {
 //
 //	error：如果解析成功，返回nil；否则返回错误信息
 func (msg *HTTPMessage) Unmarshal(b []byte) error {
-	return json.Unmarshal(b, msg)
+	var probe struct {
+		Version int `json:"v"`
+	}
+	if err := json.Unmarshal(b, &probe); err != nil {
+		return err
+	}
+	switch probe.Version {
+	case 0, 1:
+		v1 := &httpMessageV1{HTTPMessage: msg}
+		if err := json.Unmarshal(b, v1); err != nil {
+			return err
+		}
+		return v1.upgrade()
+	case HTTPMessageVersion:
+		return json.Unmarshal(b, msg)
+	default:
+		return fmt.Errorf("%w: %d", ErrUnknownVersion, probe.Version)
+	}
 }
 
 // Marshal 函数将HTTPMessage结构体对象序列化为JSON格式的字节切片
@@ -50,6 +123,7 @@ func (msg *HTTPMessage) Unmarshal(b []byte) error {
 //   - []byte: 序列化后的JSON格式字节切片
 //   - error: 如果序列化过程中发生错误，则返回非零的错误码；否则返回nil
 func (msg *HTTPMessage) Marshal() ([]byte, error) {
+	msg.Version = HTTPMessageVersion
 	return json.Marshal(msg)
 }
 
@@ -83,15 +157,22 @@ func TransHTTPMessage(line []byte) (Message, error) {
 //	error - 如果在创建请求过程中发生错误，则返回非零的错误码
 //
 // 该函数根据给定的HTTPMessage结构体中的信息，创建一个HTTP请求。
-// 使用给定的主机名（host）与HTTPMessage中的URL拼接成完整的URL，
+// 使用给定的主机名（host）替换HTTPMessage中原始请求的host，
 // 使用HTTPMessage中的Method字段作为请求方法，
 // 使用HTTPMessage中的Body字段作为请求体，
 // 使用HTTPMessage中的Header字段作为请求头。
 // 如果在创建请求过程中发生错误，则返回nil的请求对象和非零的错误码。
 func (msg *HTTPMessage) MakeRequest(host string) (*http.Request, error) {
-	body := bytes.NewReader([]byte(msg.Body))
-	_url := fmt.Sprintf("http://"+msg.URL, host)
-	req, err := http.NewRequest(msg.Method, _url, body)
+	u := msg.URL()
+	u.Scheme = "http"
+	u.Host = host
+	u.Fragment = ""
+	return msg.MakeRequestTo(u)
+}
+
+// MakeRequestTo 使用完整的目标地址创建HTTP请求, 请求方法, 请求体和请求头与MakeRequest相同
+func (msg *HTTPMessage) MakeRequestTo(u *url.URL) (*http.Request, error) {
+	req, err := http.NewRequest(msg.Method, u.String(), bytes.NewReader(msg.Body))
 	if err != nil {
 		return nil, err
 	}
@@ -103,39 +184,87 @@ func (msg *HTTPMessage) MakeRequest(host string) (*http.Request, error) {
 	return req, nil
 }
 
+// URL 返回原始请求的地址
+func (msg *HTTPMessage) URL() *url.URL {
+	return &url.URL{
+		Scheme:   msg.Scheme,
+		Host:     msg.Host,
+		Path:     msg.Path,
+		RawPath:  msg.RawPath,
+		RawQuery: msg.RawQuery,
+		Fragment: msg.Fragment,
+	}
+}
+
 // ParseRequest 将请求中的报文解析成结构
 // ParseRequest 是一个函数，它解析传入的HTTP请求r，并返回一个HTTPMessage指针和一个错误。
 // 如果解析过程中出现错误，将返回nil的HTTPMessage指针和错误对象。
 // HTTPMessage是一个自定义结构体，用于封装HTTP请求的相关信息。
 func ParseRequest(r *http.Request) (*HTTPMessage, error) {
-	body, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+	msg, _, err := ParseRequestLimit(r, -1)
+	return msg, err
+}
+
+// ParseRequestLimit 与ParseRequest相同, 但最多读取limit字节的请求体(limit < 0 不限制)
+// 请求体超出limit时返回ErrBodyTooLarge, 此时报文的Body为空,
+// rest为完整的请求体(包含已读取的部分), 由调用方决定拒绝还是落盘
+func ParseRequestLimit(r *http.Request, limit int64) (*HTTPMessage, io.Reader, error) {
+	body, rest, err := ReadBodyLimit(r, limit)
+	if err != nil && !errors.Is(err, ErrBodyTooLarge) {
+		return nil, nil, err
+	}
+	message := NewRequestMessage(r)
+	message.Body = body
+	return message, rest, err
+}
+
+// ReadBodyLimit 最多读取limit字节的请求体(limit < 0 不限制)
+// 请求体超出limit时返回ErrBodyTooLarge, rest为完整的请求体(包含已读取的部分)
+func ReadBodyLimit(r *http.Request, limit int64) ([]byte, io.Reader, error) {
+	var (
+		body []byte
+		err  error
+	)
+	if limit < 0 {
+		body, err = io.ReadAll(r.Body)
+	} else {
+		body, err = io.ReadAll(io.LimitReader(r.Body, limit+1))
+	}
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	defer r.Body.Close()
-	message := &HTTPMessage{
+	if limit >= 0 && int64(len(body)) > limit {
+		return nil, io.MultiReader(bytes.NewReader(body), r.Body), ErrBodyTooLarge
+	}
+	return body, nil, nil
+}
+
+// NewRequestMessage 只解析请求行和请求头, 不读取请求体
+// 报文的Header与请求共用, Trailer在读取完请求体后才有值
+func NewRequestMessage(r *http.Request) *HTTPMessage {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return &HTTPMessage{
+		Version:          HTTPMessageVersion,
 		Method:           r.Method,
-		URL:              FilterHost(r.URL),
+		Scheme:           scheme,
+		Host:             r.Host,
+		Path:             r.URL.Path,
+		RawPath:          r.URL.RawPath,
+		RawQuery:         r.URL.RawQuery,
+		Fragment:         r.URL.Fragment,
 		Proto:            r.Proto,
 		Header:           r.Header,
-		Body:             string(body),
 		ContentLength:    r.ContentLength,
 		TransferEncoding: r.TransferEncoding,
 		Form:             r.Form,
 		PostForm:         r.PostForm,
 		// MultipartForm:    r.MultipartForm,
-		Trailer:    r.Trailer,
-		RemoteAddr: r.RemoteAddr,
+		Trailer:        r.Trailer,
+		RemoteAddr:     r.RemoteAddr,
+		ClientIdentity: VerifiedClientIdentity(r.TLS),
 	}
-	return message, nil
-}
-
-// FilterHost 过滤掉URL中host并以%s填充
-// scheme://userinfo@/host/path?query#fragment ==> scheme://userinfo@/%s/path?query#fragment
-// FilterHost 函数接收一个 *url.URL 类型的参数 u，返回一个 string 类型的值
-// 该函数将 u.String() 返回的 URL 字符串中的 Host 部分替换为 "%s"
-// 替换操作只执行一次
-func FilterHost(u *url.URL) string {
-	uri := u.String()
-	return strings.Replace(uri, u.Host, "%s", 1)
 }
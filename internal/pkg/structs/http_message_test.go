@@ -1,7 +1,11 @@
 package structs
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -12,4 +16,57 @@ func TestTransHTTPMessage(t *testing.T) {
 	res, err := TransHTTPMessage([]byte(data))
 	assert.NoError(t, err)
 	fmt.Printf("%+v\n", res)
+	msg := res.(*HTTPMessage)
+	assert.Equal(t, HTTPMessageVersion, msg.Version)
+	assert.Equal(t, "/api/v1/tasks", msg.Path)
+	assert.Equal(t, "10.11.12.35:32810", msg.RemoteAddr)
+	assert.True(t, bytes.HasPrefix(msg.Body, []byte("eyJ0YXNrdHlwZSI6Ii")))
+}
+
+func TestHTTPMessageV1URL(t *testing.T) {
+	data := `{"method":"GET","url":"http://user@%s/a%2Fb%25c?q=100%25&x=%E4%B8%AD#top","body":"{\"k\":1}"}`
+	res, err := TransHTTPMessage([]byte(data))
+	assert.NoError(t, err)
+	msg := res.(*HTTPMessage)
+	assert.Equal(t, "/a/b%c", msg.Path)
+	assert.Equal(t, "q=100%25&x=%E4%B8%AD", msg.RawQuery)
+	assert.Equal(t, "top", msg.Fragment)
+	assert.Equal(t, []byte(`{"k":1}`), msg.Body)
+
+	req, err := msg.MakeRequest("127.0.0.1:8081")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://127.0.0.1:8081/a%2Fb%25c?q=100%25&x=%E4%B8%AD", req.URL.String())
+}
+
+func TestHTTPMessageRoundTrip(t *testing.T) {
+	body := []byte{0x00, 0xff, 0xfe, '"', '\\', 0x80, 'x'}
+	r := httptest.NewRequest(http.MethodPost, "http://api.example.com/files/a%2Fb?name=50%25%20off", bytes.NewReader(body))
+	msg, err := ParseRequest(r)
+	assert.NoError(t, err)
+	b, err := msg.Marshal()
+	assert.NoError(t, err)
+
+	res, err := TransHTTPMessage(b)
+	assert.NoError(t, err)
+	got := res.(*HTTPMessage)
+	assert.Equal(t, body, got.Body)
+	assert.Equal(t, "api.example.com", got.Host)
+	assert.Equal(t, "http://api.example.com/files/a%2Fb?name=50%25%20off", got.URL().String())
+
+	req, err := got.MakeRequest("127.0.0.1:8081")
+	assert.NoError(t, err)
+	assert.Equal(t, "/files/a%2Fb?name=50%25%20off", req.URL.RequestURI())
+	sent, _ := io.ReadAll(req.Body)
+	assert.Equal(t, body, sent)
+
+	_, err = TransHTTPMessage([]byte(`{"v":99}`))
+	assert.ErrorIs(t, err, ErrUnknownVersion)
+}
+
+func TestPeekID(t *testing.T) {
+	msg := &HTTPMessage{Meta: Meta{ID: "0a1b2c"}, Method: http.MethodGet}
+	b, err := msg.Marshal()
+	assert.NoError(t, err)
+	assert.Equal(t, "0a1b2c", PeekID(b))
+	assert.Equal(t, "", PeekID([]byte(`{"method":"GET"}`)))
 }
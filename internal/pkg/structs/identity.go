@@ -0,0 +1,56 @@
+package structs
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+)
+
+// ClientIdentity 通过mTLS校验的客户端身份, 供次元侧的策略使用
+// nolint
+type ClientIdentity struct {
+	Subject     string   `json:"subject"`
+	CommonName  string   `json:"commonName"`
+	Issuer      string   `json:"issuer"`
+	Serial      string   `json:"serial"`
+	Fingerprint string   `json:"fingerprint"` // 证书DER的sha256
+	DNSNames    []string `json:"dnsNames,omitempty"`
+	URIs        []string `json:"uris,omitempty"` // 如: SPIFFE ID
+	Emails      []string `json:"emails,omitempty"`
+}
+
+// NewClientIdentity 从客户端证书中提取身份
+func NewClientIdentity(cert *x509.Certificate) *ClientIdentity {
+	sum := sha256.Sum256(cert.Raw)
+	id := &ClientIdentity{
+		Subject:     cert.Subject.String(),
+		CommonName:  cert.Subject.CommonName,
+		Issuer:      cert.Issuer.String(),
+		Serial:      cert.SerialNumber.String(),
+		Fingerprint: hex.EncodeToString(sum[:]),
+		DNSNames:    cert.DNSNames,
+		Emails:      cert.EmailAddresses,
+	}
+	for _, u := range cert.URIs {
+		id.URIs = append(id.URIs, u.String())
+	}
+	return id
+}
+
+// VerifiedClientIdentity 返回TLS连接中已校验通过的客户端身份
+// 未使用TLS, 客户端未提供证书或证书未经校验时返回nil
+func VerifiedClientIdentity(cs *tls.ConnectionState) *ClientIdentity {
+	if cs == nil || len(cs.VerifiedChains) == 0 || len(cs.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return NewClientIdentity(cs.VerifiedChains[0][0])
+}
+
+// Principal 通过星门认证的调用方
+// nolint
+type Principal struct {
+	Method  string         `json:"method"`  // 认证方式: apikey, hmac, jwt
+	Subject string         `json:"subject"` // 调用方标识: api key名称, hmac key id, jwt sub
+	Claims  map[string]any `json:"claims,omitempty"`
+}
@@ -3,15 +3,55 @@ package structs
 import (
 	"encoding/base64"
 	"encoding/json"
+	"unicode/utf8"
+)
+
+// kafka来源消息头, 次元开启kafkaProvenance时写入
+const (
+	HeaderSourceCluster   = "X-Wormhole-Source-Cluster"
+	HeaderSourceTopic     = "X-Wormhole-Source-Topic"
+	HeaderSourcePartition = "X-Wormhole-Source-Partition"
+	HeaderSourceOffset    = "X-Wormhole-Source-Offset"
 )
 
 // nolint
 type KafkaMessage struct {
-	Topic     string `json:"topic"`
-	Key       string `json:"key"`
-	Value     []byte `json:"-"`
-	ValueB64  string `json:"value"`
-	Timestamp int64  `json:"timestamp"`
+	Meta
+	Cluster   string        `json:"cluster,omitempty"` // 源集群
+	Topic     string        `json:"topic"`
+	Partition *int32        `json:"partition,omitempty"` // 源分区, 旧版本的搬运记录为空
+	Offset    *int64        `json:"offset,omitempty"`    // 源offset, 旧版本的搬运记录为空
+	Key       string        `json:"key"`
+	KeyB64    string        `json:"keyB64,omitempty"` // 不是UTF-8的key
+	Value     []byte        `json:"-"`
+	ValueB64  string        `json:"value"`
+	Headers   []KafkaHeader `json:"headers,omitempty"`
+	Timestamp int64         `json:"timestamp"` // 源消息的时间(ms)
+}
+
+// KafkaHeader kafka消息头, value为base64
+type KafkaHeader struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// SetKey 设置key, 不是UTF-8的key保存为base64
+func (msg *KafkaMessage) SetKey(key []byte) {
+	if utf8.Valid(key) {
+		msg.Key, msg.KeyB64 = string(key), ""
+		return
+	}
+	msg.Key, msg.KeyB64 = "", base64.StdEncoding.EncodeToString(key)
+}
+
+// KeyBytes 返回原始的key
+func (msg *KafkaMessage) KeyBytes() []byte {
+	if msg.KeyB64 != "" {
+		if b, err := base64.StdEncoding.DecodeString(msg.KeyB64); err == nil {
+			return b
+		}
+	}
+	return []byte(msg.Key)
 }
 
 // Unmarshal []]byte => 报文结构
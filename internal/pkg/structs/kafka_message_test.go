@@ -0,0 +1,44 @@
+package structs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKafkaMessageRoundTrip(t *testing.T) {
+	partition, offset := int32(3), int64(42)
+	msg := &KafkaMessage{
+		Cluster:   "outer",
+		Topic:     "orders",
+		Partition: &partition,
+		Offset:    &offset,
+		Value:     []byte{0x00, 0xff, 'v'},
+		Headers:   []KafkaHeader{{Key: "bin", Value: []byte{0x01, 0xfe}}, {Key: "empty"}},
+		Timestamp: 1792281600000,
+	}
+	msg.SetKey([]byte{0xc3, 0x28})
+	assert.Empty(t, msg.Key)
+	b, err := msg.Marshal()
+	assert.NoError(t, err)
+
+	res, err := TransKafkaMessage(b)
+	assert.NoError(t, err)
+	got := res.(*KafkaMessage)
+	assert.Equal(t, []byte{0xc3, 0x28}, got.KeyBytes())
+	assert.Equal(t, msg.Value, got.Value)
+	assert.Equal(t, msg.Headers[0], got.Headers[0])
+	assert.Equal(t, "empty", got.Headers[1].Key)
+	assert.Equal(t, []any{"outer", "orders", int32(3), int64(42), int64(1792281600000)},
+		[]any{got.Cluster, got.Topic, *got.Partition, *got.Offset, got.Timestamp})
+
+	// 旧版本的搬运记录
+	res, err = TransKafkaMessage([]byte(`{"topic":"orders","key":"k1","value":"dg==","timestamp":1}`))
+	assert.NoError(t, err)
+	got = res.(*KafkaMessage)
+	assert.Equal(t, []byte("k1"), got.KeyBytes())
+	assert.Nil(t, got.Headers)
+	// 源分区和offset未知, 不能当作0
+	assert.Nil(t, got.Partition)
+	assert.Nil(t, got.Offset)
+}
@@ -1,7 +1,60 @@
 package structs
 
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// HeaderDeliverAfter 报文的最早投递时间(unix秒或RFC3339), HTTP请求头或kafka消息头
+const HeaderDeliverAfter = "X-Wormhole-Deliver-After"
+
 type Message interface {
 	Unmarshal(b []byte) error
 	Marshal() ([]byte, error)
+	GetMeta() *Meta
 }
 type TransMessage func([]byte) (Message, error)
+
+// Meta 搬运记录的公共元数据, 内嵌在各类报文结构中
+// nolint
+type Meta struct {
+	ID           string `json:"id,omitempty"`           // 星门分配的报文ID, 必须是第一个字段(见PeekID)
+	StargateTime int64  `json:"stargateTime,omitempty"` // 星门接收报文的时间(ms)
+	TraceParent  string `json:"traceparent,omitempty"`  // W3C traceparent, 用于在次元延续链路
+	Route        string `json:"route,omitempty"`        // 星门匹配到的路由名称
+	DeliverAfter int64  `json:"deliverAfter,omitempty"` // 最早投递时间(ms), 次元在此之前不转发
+}
+
+// GetMeta 返回报文的公共元数据
+func (m *Meta) GetMeta() *Meta {
+	return m
+}
+
+// idPrefix 带有报文ID的记录在搬运文件中的行首
+var idPrefix = []byte(`{"id":"`)
+
+// PeekID 不解析整条记录, 从行首读取报文ID; 没有ID时返回空
+func PeekID(line []byte) string {
+	if !bytes.HasPrefix(line, idPrefix) {
+		return ""
+	}
+	rest := line[len(idPrefix):]
+	if i := bytes.IndexByte(rest, '"'); i > 0 {
+		return string(rest[:i])
+	}
+	return ""
+}
+
+// ParseDeliverAfter 解析最早投递时间: unix秒或RFC3339, 返回ms
+func ParseDeliverAfter(v string) (int64, error) {
+	if sec, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return sec * 1000, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return 0, fmt.Errorf("%s格式错误(unix秒或RFC3339): %s", HeaderDeliverAfter, v)
+	}
+	return t.UnixMilli(), nil
+}
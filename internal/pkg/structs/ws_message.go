@@ -0,0 +1,50 @@
+package structs
+
+import "encoding/json"
+
+const (
+	WSFrameText   = "text"
+	WSFrameBinary = "binary"
+)
+
+// WSConn WebSocket连接的元数据, 随连接上的每一帧一起搬运
+// nolint
+type WSConn struct {
+	ID             string          `json:"id"`                       // 星门分配的连接ID
+	Path           string          `json:"path"`                     // 握手请求的路径
+	RawQuery       string          `json:"rawQuery,omitempty"`       // 握手请求的查询参数
+	Subprotocol    string          `json:"subprotocol,omitempty"`    // 协商的子协议
+	RemoteAddr     string          `json:"remoteAddr"`               // 调用方地址
+	ConnectedAt    int64           `json:"connectedAt"`              // 连接建立时间(ms)
+	ClientIdentity *ClientIdentity `json:"clientIdentity,omitempty"` // 通过mTLS校验的客户端身份
+	Principal      *Principal      `json:"principal,omitempty"`      // 通过星门认证的调用方
+}
+
+// WSMessage WebSocket帧报文结构体, 每一帧(text/binary)为一条报文
+// nolint
+type WSMessage struct {
+	Meta
+	Conn *WSConn `json:"conn"`
+	Seq  uint64  `json:"seq"`  // 帧在连接中的序号(从1开始)
+	Type string  `json:"type"` // text, binary
+	Data []byte  `json:"data"`
+}
+
+// Unmarshal []byte => 报文结构
+func (msg *WSMessage) Unmarshal(b []byte) error {
+	return json.Unmarshal(b, msg)
+}
+
+// Marshal 报文结构 => []byte
+func (msg *WSMessage) Marshal() ([]byte, error) {
+	return json.Marshal(msg)
+}
+
+// TransWSMessage []byte => WSMessage
+func TransWSMessage(line []byte) (Message, error) {
+	data := new(WSMessage)
+	if err := data.Unmarshal(line); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
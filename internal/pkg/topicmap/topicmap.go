@@ -0,0 +1,192 @@
+package topicmap
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/structs"
+	"github.com/chengfeiZhou/Wormhole/pkg/amqp/kafka"
+)
+
+// HeaderMatch 按消息头匹配
+// nolint
+type HeaderMatch struct {
+	Name  string `json:"name"`  // 消息头名称, 不区分大小写
+	Value string `json:"value"` // 消息头的值(正则), 为空时只要求消息头存在
+	re    *regexp.Regexp
+}
+
+func (h *HeaderMatch) match(hs []structs.KafkaHeader) bool {
+	for _, kv := range hs {
+		if strings.EqualFold(kv.Key, h.Name) && (h.re == nil || h.re.Match(kv.Value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Rule 映射规则, 条件都满足时生效; 源topic的条件(topic, prefix, suffix, regex)最多设置一个, 都不设置时匹配任意topic
+// nolint
+type Rule struct {
+	Name        string       `json:"name"`
+	Topic       string       `json:"topic"`       // 源topic完全匹配, to为目标topic
+	Prefix      string       `json:"prefix"`      // 源topic前缀, to替换该前缀
+	Suffix      string       `json:"suffix"`      // 源topic后缀, to替换该后缀
+	Regex       string       `json:"regex"`       // 源topic正则(完整匹配), to中可以引用分组($1, ${name})
+	Key         string       `json:"key"`         // key正则
+	Header      *HeaderMatch `json:"header"`      // 消息头
+	To          string       `json:"to"`          // 目标topic, 为空时使用源topic
+	Drop        bool         `json:"drop"`        // 丢弃匹配的消息
+	Partitioner string       `json:"partitioner"` // 分区策略: hash, source, roundrobin, random; 为空时使用映射表的partitioner
+	re          *regexp.Regexp
+	keyRe       *regexp.Regexp
+}
+
+func (r *Rule) init() error {
+	n := 0
+	for _, v := range []string{r.Topic, r.Prefix, r.Suffix, r.Regex} {
+		if v != "" {
+			n++
+		}
+	}
+	if n > 1 {
+		return fmt.Errorf("topic, prefix, suffix, regex最多设置一个")
+	}
+	if err := kafka.ValidPartitioner(r.Partitioner); err != nil {
+		return err
+	}
+	var err error
+	if r.Regex != "" {
+		if r.re, err = regexp.Compile("^(?:" + r.Regex + ")$"); err != nil {
+			return fmt.Errorf("regex: %w", err)
+		}
+	}
+	if r.Key != "" {
+		if r.keyRe, err = regexp.Compile(r.Key); err != nil {
+			return fmt.Errorf("key: %w", err)
+		}
+	}
+	if r.Header != nil {
+		if r.Header.Name == "" {
+			return fmt.Errorf("header没有名称")
+		}
+		if r.Header.Value != "" {
+			if r.Header.re, err = regexp.Compile(r.Header.Value); err != nil {
+				return fmt.Errorf("header: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// apply 消息符合规则时返回目标topic
+func (r *Rule) apply(m *structs.KafkaMessage) (string, bool) {
+	if r.keyRe != nil && !r.keyRe.Match(m.KeyBytes()) {
+		return "", false
+	}
+	if r.Header != nil && !r.Header.match(m.Headers) {
+		return "", false
+	}
+	topic := m.Topic
+	switch {
+	case r.Topic != "":
+		if topic != r.Topic {
+			return "", false
+		}
+	case r.Prefix != "":
+		rest, ok := strings.CutPrefix(topic, r.Prefix)
+		if !ok {
+			return "", false
+		}
+		if r.To != "" {
+			return r.To + rest, true
+		}
+	case r.Suffix != "":
+		rest, ok := strings.CutSuffix(topic, r.Suffix)
+		if !ok {
+			return "", false
+		}
+		if r.To != "" {
+			return rest + r.To, true
+		}
+	case r.re != nil:
+		idx := r.re.FindStringSubmatchIndex(topic)
+		if idx == nil {
+			return "", false
+		}
+		if r.To != "" {
+			return string(r.re.ExpandString(nil, r.To, topic, idx)), true
+		}
+	}
+	if r.To != "" {
+		return r.To, true
+	}
+	return topic, true
+}
+
+// Table 次元生产消息的topic映射表, 按顺序匹配, 第一个符合的规则生效
+// nolint
+type Table struct {
+	Rules       []*Rule `json:"rules"`
+	Default     string  `json:"default"`     // 没有规则匹配时的目标topic, 为空时使用源topic
+	Drop        bool    `json:"drop"`        // 丢弃没有规则匹配的消息
+	Partitioner string  `json:"partitioner"` // 没有规则匹配或规则没有设置时的分区策略, 为空时使用次元的kafkaPartitioner
+}
+
+// Result 映射结果
+type Result struct {
+	Topic       string // 目标topic
+	Drop        bool   // 丢弃消息
+	Rule        string // 命中的规则名称, 没有命中时为空
+	Partitioner string // 分区策略, 为空时使用生产者的默认策略
+}
+
+// Load 从JSON文件加载topic映射表
+func Load(file string) (*Table, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	t := new(Table)
+	if err := json.Unmarshal(b, t); err != nil {
+		return nil, fmt.Errorf("解析topic映射%s: %w", file, err)
+	}
+	if t.Default != "" && t.Drop {
+		return nil, fmt.Errorf("topic映射的default与drop不能同时设置")
+	}
+	if err := kafka.ValidPartitioner(t.Partitioner); err != nil {
+		return nil, fmt.Errorf("topic映射: %w", err)
+	}
+	for i, r := range t.Rules {
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("#%d", i+1)
+		}
+		if err := r.init(); err != nil {
+			return nil, fmt.Errorf("topic映射规则%s: %w", r.Name, err)
+		}
+	}
+	return t, nil
+}
+
+// Resolve 返回消息的目标topic; nil的Table使用源topic
+func (t *Table) Resolve(m *structs.KafkaMessage) Result {
+	if t == nil {
+		return Result{Topic: m.Topic}
+	}
+	for _, r := range t.Rules {
+		if topic, ok := r.apply(m); ok {
+			res := Result{Topic: topic, Drop: r.Drop, Rule: r.Name, Partitioner: r.Partitioner}
+			if res.Partitioner == "" {
+				res.Partitioner = t.Partitioner
+			}
+			return res
+		}
+	}
+	if t.Default != "" {
+		return Result{Topic: t.Default, Drop: t.Drop, Partitioner: t.Partitioner}
+	}
+	return Result{Topic: m.Topic, Drop: t.Drop, Partitioner: t.Partitioner}
+}
@@ -0,0 +1,75 @@
+package topicmap
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/structs"
+	"github.com/stretchr/testify/assert"
+)
+
+func load(t *testing.T, content string) (*Table, error) {
+	file := filepath.Join(t.TempDir(), "topics.json")
+	assert.NoError(t, os.WriteFile(file, []byte(content), 0o600))
+	return Load(file)
+}
+
+func TestResolve(t *testing.T) {
+	tb, err := load(t, `{
+		"rules": [
+			{"name": "debug", "topic": "debug", "drop": true},
+			{"name": "vip", "key": "^vip-", "to": "inner.vip"},
+			{"name": "tenant", "header": {"name": "X-Tenant", "value": "^a$"}, "to": "inner.tenant-a"},
+			{"topic": "orders", "to": "inner.orders"},
+			{"prefix": "ext.", "to": "inner."},
+			{"suffix": ".v1", "to": ".v2"},
+			{"regex": "(?P<domain>\\w+)\\.events\\.(\\w+)", "to": "inner.${domain}-$2"},
+			{"prefix": "audit."}
+		],
+		"default": "inner.misc"
+	}`)
+	assert.NoError(t, err)
+	resolve := func(topic, key string, hs ...structs.KafkaHeader) Result {
+		return tb.Resolve(&structs.KafkaMessage{Topic: topic, Key: key, Headers: hs})
+	}
+	assert.Equal(t, Result{Topic: "debug", Drop: true, Rule: "debug"}, resolve("debug", "vip-1"))
+	assert.Equal(t, Result{Topic: "inner.vip", Rule: "vip"}, resolve("orders", "vip-1"))
+	assert.Equal(t, Result{Topic: "inner.tenant-a", Rule: "tenant"},
+		resolve("orders", "", structs.KafkaHeader{Key: "x-tenant", Value: []byte("a")}))
+	assert.Equal(t, Result{Topic: "inner.orders", Rule: "#4"},
+		resolve("orders", "", structs.KafkaHeader{Key: "X-Tenant", Value: []byte("ab")}))
+	assert.Equal(t, "inner.payments", resolve("ext.payments", "").Topic)
+	assert.Equal(t, "users.v2", resolve("users.v1", "").Topic)
+	assert.Equal(t, "inner.billing-created", resolve("billing.events.created", "").Topic)
+	// regex完整匹配
+	assert.Equal(t, Result{Topic: "inner.misc"}, resolve("billing.events.created.dlq", ""))
+	// 没有to时使用源topic
+	assert.Equal(t, Result{Topic: "audit.login", Rule: "#8"}, resolve("audit.login", ""))
+
+	tb, err = load(t, `{"rules": [{"prefix": "ext."}], "drop": true}`)
+	assert.NoError(t, err)
+	assert.Equal(t, Result{Topic: "other", Drop: true}, resolve("other", ""))
+
+	// 分区策略: 规则优先, 其次映射表
+	tb, err = load(t, `{"rules": [{"prefix": "ext.", "partitioner": "source"}, {"topic": "logs"}], "partitioner": "roundrobin"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, "source", resolve("ext.orders", "").Partitioner)
+	assert.Equal(t, "roundrobin", resolve("logs", "").Partitioner)
+	assert.Equal(t, "roundrobin", resolve("other", "").Partitioner)
+
+	var nilTable *Table
+	assert.Equal(t, Result{Topic: "orders"}, nilTable.Resolve(&structs.KafkaMessage{Topic: "orders"}))
+
+	for _, bad := range []string{
+		`{"rules": [{"topic": "a", "prefix": "b"}]}`,
+		`{"rules": [{"regex": "("}]}`,
+		`{"rules": [{"header": {"value": "a"}}]}`,
+		`{"default": "x", "drop": true}`,
+		`{"rules": [{"topic": "a", "partitioner": "sticky"}]}`,
+		`{"partitioner": "sticky"}`,
+	} {
+		_, err = load(t, bad)
+		assert.Error(t, err, bad)
+	}
+}
@@ -0,0 +1,169 @@
+package tracking
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+
+	types "github.com/chengfeiZhou/Wormhole/pkg/structs"
+)
+
+const (
+	HeaderID = "X-Wormhole-Id" // 返回给调用方的报文ID
+
+	StateQueued    = "queued"    // 已接收, 在搬运队列中
+	StateWritten   = "written"   // 已写入搬运文件缓存
+	StatePublished = "published" // 搬运文件已移动到搬运目录, 等待摆渡
+	StateFailed    = "failed"    // 写入或移动搬运文件失败
+)
+
+var ErrNotFound = errors.New("报文ID不存在或已过期")
+
+// NewID 生成报文ID
+func NewID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Record 报文的搬运状态
+// nolint
+type Record struct {
+	ID         string `json:"id"`
+	State      string `json:"state"`
+	File       string `json:"file,omitempty"` // 报文所在的搬运文件
+	Error      string `json:"error,omitempty"`
+	AcceptedAt int64  `json:"acceptedAt"` // ms
+	UpdatedAt  int64  `json:"updatedAt"`  // ms
+}
+
+// Tracker 在内存中记录最近size条报文的搬运状态, 超出后淘汰最早的记录
+// nil 的Tracker可以直接调用, 不做任何记录
+// nolint
+type Tracker struct {
+	mu      sync.Mutex
+	records map[string]*Record
+	order   []string            // 按接收顺序排列的ID, 环形使用
+	next    int                 // order中下一个写入的位置
+	pending map[string][]string // 搬运文件缓存 => 已写入但未移动的报文ID
+}
+
+// NewTracker 创建Tracker, size <= 0 时返回nil(不记录)
+func NewTracker(size int) *Tracker {
+	if size <= 0 {
+		return nil
+	}
+	return &Tracker{
+		records: make(map[string]*Record, size),
+		order:   make([]string, size),
+		pending: make(map[string][]string),
+	}
+}
+
+// Queued 记录报文进入搬运队列
+func (t *Tracker) Queued(id string) {
+	if t == nil || id == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if old := t.order[t.next]; old != "" {
+		delete(t.records, old)
+	}
+	t.order[t.next] = id
+	t.next = (t.next + 1) % len(t.order)
+	now := time.Now().UnixMilli()
+	t.records[id] = &Record{ID: id, State: StateQueued, AcceptedAt: now, UpdatedAt: now}
+}
+
+// Written 记录报文写入了搬运文件缓存file
+func (t *Tracker) Written(id, file string) {
+	if t == nil || id == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pending[file] = append(t.pending[file], id)
+	t.update(id, StateWritten, file, nil)
+}
+
+// Failed 记录报文写入失败
+func (t *Tracker) Failed(id string, err error) {
+	if t == nil || id == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.update(id, StateFailed, "", err)
+}
+
+// Published 搬运文件缓存file移动到搬运目录(target)后调用, 更新其中所有报文的状态
+// err不为空时报文状态为failed
+func (t *Tracker) Published(file, target string, err error) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state := StatePublished
+	if err != nil {
+		state = StateFailed
+	}
+	for _, id := range t.pending[file] {
+		t.update(id, state, target, err)
+	}
+	delete(t.pending, file)
+}
+
+// Lookup 查询报文的搬运状态
+func (t *Tracker) Lookup(id string) (Record, error) {
+	if t == nil {
+		return Record{}, ErrNotFound
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r, ok := t.records[id]
+	if !ok {
+		return Record{}, ErrNotFound
+	}
+	return *r, nil
+}
+
+// update 更新已记录的报文状态, 已淘汰的报文忽略
+func (t *Tracker) update(id, state, file string, err error) {
+	r, ok := t.records[id]
+	if !ok {
+		return
+	}
+	r.State = state
+	if file != "" {
+		r.File = file
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	r.UpdatedAt = time.Now().UnixMilli()
+}
+
+// Handler 查询报文状态的接口, 请求路径的最后一段为报文ID
+func (t *Tracker) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rd := &types.HttpRespData{Code: 0, Message: "ok"}
+		code := http.StatusOK
+		r, err := t.Lookup(path.Base(req.URL.Path))
+		if err != nil {
+			code, rd.Code, rd.Message = http.StatusNotFound, -1, err.Error()
+		} else {
+			rd.Data = map[string]any{"id": r.ID, "state": r.State, "file": r.File, "error": r.Error,
+				"acceptedAt": r.AcceptedAt, "updatedAt": r.UpdatedAt}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(rd)
+	})
+}
@@ -0,0 +1,60 @@
+package tracking
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTracker(t *testing.T) {
+	tr := NewTracker(2)
+	tr.Queued("a")
+	tr.Queued("b")
+	tr.Written("a", "/tmp/message_1.hole")
+	tr.Written("b", "/tmp/message_1.hole")
+	r, err := tr.Lookup("a")
+	assert.NoError(t, err)
+	assert.Equal(t, StateWritten, r.State)
+
+	tr.Published("/tmp/message_1.hole", "/data/message_1.hole", nil)
+	r, _ = tr.Lookup("b")
+	assert.Equal(t, StatePublished, r.State)
+	assert.Equal(t, "/data/message_1.hole", r.File)
+
+	// 超出容量淘汰最早的记录
+	tr.Queued("c")
+	_, err = tr.Lookup("a")
+	assert.ErrorIs(t, err, ErrNotFound)
+	tr.Failed("c", errors.New("disk full"))
+	r, _ = tr.Lookup("c")
+	assert.Equal(t, StateFailed, r.State)
+	assert.Equal(t, "disk full", r.Error)
+
+	var nilTracker *Tracker
+	nilTracker.Queued("x")
+	_, err = nilTracker.Lookup("x")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestHandler(t *testing.T) {
+	tr := NewTracker(10)
+	tr.Queued("abc")
+	h := tr.Handler()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_wormhole/messages/abc", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var rd struct {
+		Data Record `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &rd))
+	assert.Equal(t, StateQueued, rd.Data.State)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_wormhole/messages/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
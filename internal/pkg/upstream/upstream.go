@@ -0,0 +1,351 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 负载均衡方式
+const (
+	BalanceRoundRobin    = "round_robin"    // 轮询
+	BalanceLeastInflight = "least_inflight" // 执行中请求最少
+	BalanceHash          = "hash"           // 按key一致性哈希(rendezvous), 同一个key在上游不变时总是选到同一个上游
+)
+
+var ErrNoHealthy = errors.New("没有可用的上游")
+
+// HealthCheck 主动健康检查: 定时GET上游地址+Path, 2xx/3xx为成功
+// nolint
+type HealthCheck struct {
+	Path      string `json:"path"`      // 检查路径, 如: /healthz
+	Interval  int    `json:"interval"`  // 检查间隔(s), 默认10
+	Timeout   int    `json:"timeout"`   // 单次检查超时(s), 默认2
+	Healthy   int    `json:"healthy"`   // 连续成功多少次后恢复, 默认2
+	Unhealthy int    `json:"unhealthy"` // 连续失败多少次后摘除, 默认3
+}
+
+func (h *HealthCheck) setDefaults() {
+	if h.Interval <= 0 {
+		h.Interval = 10
+	}
+	if h.Timeout <= 0 {
+		h.Timeout = 2
+	}
+	if h.Healthy <= 0 {
+		h.Healthy = 2
+	}
+	if h.Unhealthy <= 0 {
+		h.Unhealthy = 3
+	}
+}
+
+// Outlier 被动异常摘除: 上游连续出错(请求失败或5xx)后暂时不再选择
+// nolint
+type Outlier struct {
+	ConsecutiveErrors int `json:"consecutiveErrors"` // 连续出错多少次后摘除, 默认5
+	EjectTime         int `json:"ejectTime"`         // 摘除时间(s), 默认30
+	MaxEjectPercent   int `json:"maxEjectPercent"`   // 同时被摘除的上游比例上限(%), 默认50
+}
+
+func (o *Outlier) setDefaults() {
+	if o.ConsecutiveErrors <= 0 {
+		o.ConsecutiveErrors = 5
+	}
+	if o.EjectTime <= 0 {
+		o.EjectTime = 30
+	}
+	if o.MaxEjectPercent <= 0 {
+		o.MaxEjectPercent = 50
+	}
+}
+
+// Member 一个上游
+type Member struct {
+	URL      *url.URL
+	inflight atomic.Int64
+	down     atomic.Bool // 主动健康检查失败
+	mu       sync.Mutex
+	errors   int       // 连续出错次数(被动)
+	ejected  time.Time // 摘除到期时间
+	checks   int       // 主动检查连续成功(>0)或失败(<0)的次数
+}
+
+// Addr 返回上游的 host:port
+func (m *Member) Addr() string {
+	if m.URL.Port() != "" {
+		return m.URL.Host
+	}
+	port := "80"
+	if m.URL.Scheme == "https" {
+		port = "443"
+	}
+	return net.JoinHostPort(m.URL.Hostname(), port)
+}
+
+func (m *Member) available(now time.Time) bool {
+	if m.down.Load() {
+		return false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return !now.Before(m.ejected)
+}
+
+// MemberStatus 上游的状态, 用于管理接口
+// nolint
+type MemberStatus struct {
+	URL      string    `json:"url"`
+	Healthy  bool      `json:"healthy"`
+	Ejected  time.Time `json:"ejectedUntil,omitempty"`
+	InFlight int64     `json:"inFlight"`
+}
+
+// Group 一组上游
+// nolint
+type Group struct {
+	members []*Member
+	balance string
+	check   *HealthCheck // 为空时不做主动检查
+	outlier *Outlier     // 为空时不做被动摘除
+	rr      atomic.Uint64
+	client  *http.Client
+	now     func() time.Time
+}
+
+// NewGroup 创建上游组, check/outlier为空时不启用对应的检查
+// transport为主动检查使用的Transport, 应与转发请求相同(CA, 客户端证书, SNI); 为空时使用http.DefaultTransport
+func NewGroup(urls []*url.URL, balance string, check *HealthCheck, outlier *Outlier,
+	transport http.RoundTripper) (*Group, error) {
+	if len(urls) == 0 {
+		return nil, errors.New("没有配置上游")
+	}
+	switch balance {
+	case "":
+		balance = BalanceRoundRobin
+	case BalanceRoundRobin, BalanceLeastInflight, BalanceHash:
+	default:
+		return nil, fmt.Errorf("负载均衡方式可选: %s, %s, %s; 当前: %s",
+			BalanceRoundRobin, BalanceLeastInflight, BalanceHash, balance)
+	}
+	g := &Group{balance: balance, check: check, outlier: outlier, now: time.Now}
+	for _, u := range urls {
+		g.members = append(g.members, &Member{URL: u})
+	}
+	if check != nil {
+		check.setDefaults()
+		g.client = &http.Client{
+			Transport: transport,
+			Timeout:   time.Duration(check.Timeout) * time.Second,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+	}
+	if outlier != nil {
+		outlier.setDefaults()
+	}
+	return g, nil
+}
+
+// Members 返回所有上游
+func (g *Group) Members() []*Member {
+	return g.members
+}
+
+// Pick 选择一个上游, key用于hash均衡(为空时轮询)
+// 所有上游都不可用时在全部上游中选择, 避免健康检查误判导致全部失败
+// 选中的上游在请求结束后必须调用Done
+func (g *Group) Pick(key string) *Member {
+	now := g.now()
+	candidates := make([]*Member, 0, len(g.members))
+	for _, m := range g.members {
+		if m.available(now) {
+			candidates = append(candidates, m)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = g.members
+	}
+	var m *Member
+	switch {
+	case g.balance == BalanceHash && key != "":
+		m = rendezvous(candidates, key)
+	case g.balance == BalanceLeastInflight:
+		start := int(g.rr.Add(1) % uint64(len(candidates)))
+		for i := range candidates {
+			c := candidates[(start+i)%len(candidates)]
+			if m == nil || c.inflight.Load() < m.inflight.Load() {
+				m = c
+			}
+		}
+	default:
+		m = candidates[int((g.rr.Add(1)-1)%uint64(len(candidates)))]
+	}
+	m.inflight.Add(1)
+	return m
+}
+
+// Done 上报请求结果, err不为空(包括5xx)时计入连续出错次数
+func (g *Group) Done(m *Member, err error) {
+	m.inflight.Add(-1)
+	if g.outlier == nil {
+		return
+	}
+	m.mu.Lock()
+	if err == nil {
+		m.errors = 0
+		m.mu.Unlock()
+		return
+	}
+	m.errors++
+	eject := m.errors >= g.outlier.ConsecutiveErrors
+	m.mu.Unlock()
+	if !eject {
+		return
+	}
+	now := g.now()
+	// 同时被摘除的上游不超过MaxEjectPercent
+	ejected := 0
+	for _, o := range g.members {
+		if o != m && !o.available(now) {
+			ejected++
+		}
+	}
+	if (ejected+1)*100 > g.outlier.MaxEjectPercent*len(g.members) {
+		return
+	}
+	m.mu.Lock()
+	m.errors = 0
+	m.ejected = now.Add(time.Duration(g.outlier.EjectTime) * time.Second)
+	m.mu.Unlock()
+}
+
+// Ready 就绪检查: 至少有一个上游可用
+func (g *Group) Ready(ctx context.Context) error {
+	now := g.now()
+	for _, m := range g.members {
+		if m.available(now) {
+			return nil
+		}
+	}
+	return ErrNoHealthy
+}
+
+// Status 返回每个上游的状态
+func (g *Group) Status() []MemberStatus {
+	now := g.now()
+	st := make([]MemberStatus, 0, len(g.members))
+	for _, m := range g.members {
+		m.mu.Lock()
+		ejected := m.ejected
+		m.mu.Unlock()
+		if !ejected.After(now) {
+			ejected = time.Time{}
+		}
+		st = append(st, MemberStatus{URL: m.URL.String(), Healthy: !m.down.Load(), Ejected: ejected,
+			InFlight: m.inflight.Load()})
+	}
+	return st
+}
+
+// Run 执行主动健康检查, ctx结束时返回; 没有配置主动检查时直接返回
+func (g *Group) Run(ctx context.Context) {
+	if g.check == nil {
+		return
+	}
+	t := time.NewTicker(time.Duration(g.check.Interval) * time.Second)
+	defer t.Stop()
+	for {
+		g.probeAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (g *Group) probeAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, m := range g.members {
+		wg.Add(1)
+		go func(m *Member) {
+			defer wg.Done()
+			g.record(m, g.probe(ctx, m))
+		}(m)
+	}
+	wg.Wait()
+}
+
+// probe 检查一个上游
+func (g *Group) probe(ctx context.Context, m *Member) error {
+	u := *m.URL
+	u.Path = g.check.Path
+	u.RawPath, u.RawQuery = "", ""
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), http.NoBody)
+	if err != nil {
+		return err
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("健康检查响应: %s", resp.Status)
+	}
+	return nil
+}
+
+// record 记录主动检查结果, 连续成功/失败达到阈值后切换状态
+func (g *Group) record(m *Member, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err == nil {
+		m.checks = max(m.checks, 0) + 1
+		if m.checks >= g.check.Healthy {
+			m.down.Store(false)
+		}
+		return
+	}
+	m.checks = min(m.checks, 0) - 1
+	if -m.checks >= g.check.Unhealthy {
+		m.down.Store(true)
+	}
+}
+
+// rendezvous 最高随机权重哈希: 上游增减时只有相关的key会改变选择
+func rendezvous(members []*Member, key string) *Member {
+	var (
+		best  *Member
+		score uint64
+	)
+	for _, m := range members {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(m.URL.String()))
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(key))
+		if s := mix(h.Sum64()); best == nil || s > score {
+			best, score = m, s
+		}
+	}
+	return best
+}
+
+// mix splitmix64的最后一步, 打散fnv结果中相近输入的相关性
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,112 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newGroup(t *testing.T, balance string, check *HealthCheck, outlier *Outlier, addrs ...string) *Group {
+	urls := make([]*url.URL, 0, len(addrs))
+	for _, addr := range addrs {
+		u, err := url.Parse(addr)
+		assert.NoError(t, err)
+		urls = append(urls, u)
+	}
+	g, err := NewGroup(urls, balance, check, outlier, nil)
+	assert.NoError(t, err)
+	return g
+}
+
+func TestBalance(t *testing.T) {
+	g := newGroup(t, "", nil, nil, "http://a", "http://b", "http://c")
+	var got []string
+	for i := 0; i < 4; i++ {
+		m := g.Pick("")
+		got = append(got, m.URL.Host)
+		g.Done(m, nil)
+	}
+	assert.Equal(t, []string{"a", "b", "c", "a"}, got)
+
+	g = newGroup(t, BalanceLeastInflight, nil, nil, "http://a", "http://b")
+	m1, m2 := g.Pick(""), g.Pick("")
+	assert.NotEqual(t, m1, m2)
+	g.Done(m1, nil)
+	assert.Equal(t, m1, g.Pick(""))
+
+	g = newGroup(t, BalanceHash, nil, nil, "http://a", "http://b", "http://c")
+	picked := make(map[string]string)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("tenant-%d", i)
+		picked[key] = g.Pick(key).URL.Host
+		assert.Equal(t, picked[key], g.Pick(key).URL.Host)
+	}
+	// 去掉一个上游后, 只有原来选中该上游的key会改变
+	g2 := newGroup(t, BalanceHash, nil, nil, "http://a", "http://b")
+	for key, host := range picked {
+		if host != "c" {
+			assert.Equal(t, host, g2.Pick(key).URL.Host)
+		}
+	}
+
+	_, err := NewGroup([]*url.URL{{Host: "a"}}, "random", nil, nil, nil)
+	assert.Error(t, err)
+}
+
+func TestOutlier(t *testing.T) {
+	now := time.Unix(1000, 0)
+	g := newGroup(t, "", nil, &Outlier{ConsecutiveErrors: 2, EjectTime: 10}, "http://a", "http://b")
+	g.now = func() time.Time { return now }
+	a := g.Members()[0]
+	errBad := errors.New("bad")
+	g.Done(g.Pick(""), errBad) // a
+	g.Done(g.Pick(""), nil)    // b
+	assert.True(t, a.available(now))
+	g.Done(g.Pick(""), errBad) // a: 连续第二次出错
+	assert.False(t, a.available(now))
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, "b", g.Pick("").URL.Host)
+	}
+	// b再出错也不会被摘除(同时摘除的上游不超过50%)
+	b := g.Members()[1]
+	g.Done(b, errBad)
+	g.Done(b, errBad)
+	assert.True(t, b.available(now))
+	assert.NoError(t, g.Ready(context.Background()))
+
+	now = now.Add(10 * time.Second)
+	assert.True(t, a.available(now))
+}
+
+func TestHealthCheck(t *testing.T) {
+	var healthy atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" || !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	g := newGroup(t, "", &HealthCheck{Path: "/healthz", Healthy: 1, Unhealthy: 2}, nil, srv.URL+"/api")
+	m := g.Members()[0]
+	ctx := context.Background()
+
+	g.probeAll(ctx)
+	assert.NoError(t, g.Ready(ctx))
+	g.probeAll(ctx)
+	assert.ErrorIs(t, g.Ready(ctx), ErrNoHealthy)
+	assert.False(t, g.Status()[0].Healthy)
+	// 没有可用的上游时仍然在全部上游中选择
+	assert.Equal(t, m, g.Pick(""))
+
+	healthy.Store(true)
+	g.probeAll(ctx)
+	assert.NoError(t, g.Ready(ctx))
+}
@@ -0,0 +1,172 @@
+package workpool
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/chengfeiZhou/Wormhole/internal/pkg/metrics"
+)
+
+var ErrQueueFull = errors.New("目标的队列已满")
+
+// Stats 单个目标的队列状态
+// nolint
+type Stats struct {
+	Queued   int64 `json:"queued"`   // 排队中的任务
+	InFlight int64 `json:"inFlight"` // 执行中的任务
+}
+
+// queue 单个目标的任务队列
+type queue struct {
+	jobs     chan func()
+	queued   atomic.Int64
+	inFlight atomic.Int64
+}
+
+// Pool 有界的工作池
+// 每个目标一个队列和perTarget个worker, 所有目标共享workers个执行名额;
+// 某个目标变慢时只会占满自己的队列和名额, 不会阻塞其他目标已经排队的任务.
+// 队列满时Submit阻塞调用方, 单个调用方分发所有目标时会因此暂停分发其他目标; 需要隔离时使用TrySubmit
+// nolint
+type Pool struct {
+	ctx       context.Context
+	name      string // 指标中的module
+	perTarget int
+	queueSize int
+	slots     chan struct{} // 全局执行名额
+	mu        sync.Mutex
+	queues    map[string]*queue
+	wg        sync.WaitGroup
+}
+
+// New 创建工作池, ctx结束后worker退出, 未执行的任务被丢弃
+// workers: 全局并发上限; perTarget: 每个目标的并发上限, <=0或大于workers时取workers; queueSize: 每个目标的队列长度
+func New(ctx context.Context, name string, workers, perTarget, queueSize int) *Pool {
+	if workers <= 0 {
+		workers = 1
+	}
+	if perTarget <= 0 || perTarget > workers {
+		perTarget = workers
+	}
+	return &Pool{
+		ctx:       ctx,
+		name:      name,
+		perTarget: perTarget,
+		queueSize: max(queueSize, 0),
+		slots:     make(chan struct{}, workers),
+		queues:    make(map[string]*queue),
+	}
+}
+
+// Submit 将任务加入目标的队列, 队列已满时阻塞, ctx或工作池结束时返回错误
+func (p *Pool) Submit(ctx context.Context, target string, job func()) error {
+	q := p.queue(target)
+	q.queued.Add(1)
+	metrics.EgressQueued(p.name, target, 1)
+	select {
+	case q.jobs <- job:
+		return nil
+	case <-ctx.Done():
+		err := ctx.Err()
+		p.dequeue(q, target)
+		return err
+	case <-p.ctx.Done():
+		p.dequeue(q, target)
+		return p.ctx.Err()
+	}
+}
+
+// TrySubmit 将任务加入目标的队列, 队列已满时立即返回ErrQueueFull, 不阻塞调用方
+func (p *Pool) TrySubmit(target string, job func()) error {
+	if err := p.ctx.Err(); err != nil {
+		return err
+	}
+	q := p.queue(target)
+	q.queued.Add(1)
+	metrics.EgressQueued(p.name, target, 1)
+	select {
+	case q.jobs <- job:
+		return nil
+	default:
+		p.dequeue(q, target)
+		return ErrQueueFull
+	}
+}
+
+// Stats 返回每个目标的队列状态
+func (p *Pool) Stats() map[string]Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	st := make(map[string]Stats, len(p.queues))
+	for target, q := range p.queues {
+		st[target] = Stats{Queued: q.queued.Load(), InFlight: q.inFlight.Load()}
+	}
+	return st
+}
+
+// Targets 返回出现过的目标
+func (p *Pool) Targets() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	targets := make([]string, 0, len(p.queues))
+	for target := range p.queues {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// Wait 等待所有worker退出(ctx结束后)
+func (p *Pool) Wait() {
+	p.wg.Wait()
+}
+
+// queue 返回目标的队列, 第一次出现时启动该目标的worker
+func (p *Pool) queue(target string) *queue {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if q, ok := p.queues[target]; ok {
+		return q
+	}
+	q := &queue{jobs: make(chan func(), p.queueSize)}
+	p.queues[target] = q
+	for i := 0; i < p.perTarget; i++ {
+		p.wg.Add(1)
+		go p.work(target, q)
+	}
+	return q
+}
+
+func (p *Pool) dequeue(q *queue, target string) {
+	q.queued.Add(-1)
+	metrics.EgressQueued(p.name, target, -1)
+}
+
+// work 从目标队列中取出任务, 获得全局名额后执行
+func (p *Pool) work(target string, q *queue) {
+	defer p.wg.Done()
+	for {
+		var job func()
+		select {
+		case job = <-q.jobs:
+		case <-p.ctx.Done():
+			return
+		}
+		select {
+		case p.slots <- struct{}{}:
+		case <-p.ctx.Done():
+			p.dequeue(q, target)
+			return
+		}
+		p.dequeue(q, target)
+		q.inFlight.Add(1)
+		metrics.EgressInFlight(p.name, target, 1)
+		job()
+		q.inFlight.Add(-1)
+		metrics.EgressInFlight(p.name, target, -1)
+		<-p.slots
+	}
+}
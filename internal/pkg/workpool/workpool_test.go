@@ -0,0 +1,115 @@
+package workpool
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// peak 记录同时执行的最大任务数
+type peak struct {
+	cur, max atomic.Int64
+}
+
+func (p *peak) enter() {
+	n := p.cur.Add(1)
+	for {
+		m := p.max.Load()
+		if n <= m || p.max.CompareAndSwap(m, n) {
+			return
+		}
+	}
+}
+
+func (p *peak) leave() {
+	p.cur.Add(-1)
+}
+
+func TestPoolLimits(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := New(ctx, "test", 3, 2, 10)
+	var (
+		all, a, b peak
+		wg        sync.WaitGroup
+	)
+	job := func(target *peak) func() {
+		return func() {
+			defer wg.Done()
+			all.enter()
+			target.enter()
+			time.Sleep(10 * time.Millisecond)
+			target.leave()
+			all.leave()
+		}
+	}
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		assert.NoError(t, p.Submit(ctx, "a", job(&a)))
+		assert.NoError(t, p.Submit(ctx, "b", job(&b)))
+	}
+	wg.Wait()
+	assert.Equal(t, int64(2), a.max.Load())
+	assert.Equal(t, int64(3), all.max.Load())
+	assert.Equal(t, []string{"a", "b"}, p.Targets())
+	assert.Zero(t, p.Stats()["a"].Queued)
+}
+
+func TestPoolSlowTarget(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := New(ctx, "test", 2, 1, 1)
+	block := make(chan struct{})
+	assert.NoError(t, p.Submit(ctx, "slow", func() { <-block }))
+	// 慢目标占满自己的名额后, 其他目标的任务仍然可以执行
+	done := make(chan struct{})
+	assert.NoError(t, p.Submit(ctx, "fast", func() { close(done) }))
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("fast目标被slow目标阻塞")
+	}
+	// slow的队列已满时Submit阻塞, 直到ctx结束
+	assert.NoError(t, p.Submit(ctx, "slow", func() {}))
+	sctx, scancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer scancel()
+	assert.ErrorIs(t, p.Submit(sctx, "slow", func() {}), context.DeadlineExceeded)
+	assert.Equal(t, int64(1), p.Stats()["slow"].Queued)
+
+	close(block)
+	cancel()
+	p.Wait()
+}
+
+func TestTrySubmit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := New(ctx, "test", 2, 1, 1)
+	block := make(chan struct{})
+	started := make(chan struct{})
+	assert.NoError(t, p.TrySubmit("slow", func() {
+		close(started)
+		<-block
+	}))
+	<-started
+	// slow的worker被占用, 队列中再放一个任务后已满
+	assert.NoError(t, p.TrySubmit("slow", func() {}))
+	assert.ErrorIs(t, p.TrySubmit("slow", func() {}), ErrQueueFull)
+	assert.Equal(t, Stats{Queued: 1, InFlight: 1}, p.Stats()["slow"])
+
+	// 其他目标不受影响
+	done := make(chan struct{})
+	assert.NoError(t, p.TrySubmit("fast", func() { close(done) }))
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("fast的任务没有执行")
+	}
+
+	close(block)
+	cancel()
+	p.Wait()
+	assert.ErrorIs(t, p.TrySubmit("fast", func() {}), context.Canceled)
+}
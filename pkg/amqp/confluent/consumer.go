@@ -2,6 +2,8 @@ package confluent
 
 import (
 	"context"
+	"fmt"
+	"slices"
 	"strings"
 	"time"
 
@@ -10,14 +12,25 @@ import (
 )
 
 const (
-	offsetCommitLimit = 100
+	offsetCommitLimit  = 100
+	pollTimeout        = 500   // ms
+	offsetQueryTimeout = 10000 // ms
 )
 
 type Data struct {
 	FaninTime time.Time
 	Topic     string
+	Partition int32
+	Offset    int64
 	Key       []byte
 	Value     []byte
+	Headers   []Header
+}
+
+// Header 消息头
+type Header struct {
+	Key   string
+	Value []byte
 }
 
 // ConsumerGroup 定义消费者组类
@@ -27,10 +40,41 @@ type ConsumerGroup struct {
 	consumer *kafka.Consumer
 	topics   []string
 	hf       HandleFunc
+	beginAt  time.Time // 不为零时, 没有提交offset的分区从该时间开始消费
 }
 
 type HandleFunc func(context.Context, *Data) error
 
+// ConsumerOffsetReset 没有提交offset时的起始位置: earliest, latest
+func ConsumerOffsetReset(reset string) OptionFunc {
+	return func(c *Config) error {
+		return c.conf.SetKey("auto.offset.reset", reset)
+	}
+}
+
+// ConsumerBeginAtTime 没有提交offset时从t之后的第一条消息开始消费
+func ConsumerBeginAtTime(t time.Time) OptionFunc {
+	return func(c *Config) error {
+		c.beginAt = t
+		return nil
+	}
+}
+
+// ConsumerTopicRegex 订阅名称匹配正则的所有topic, 每隔refresh刷新一次集群元数据
+func ConsumerTopicRegex(pattern string, refresh time.Duration) OptionFunc {
+	return func(c *Config) error {
+		if refresh <= 0 {
+			return fmt.Errorf("topic列表刷新间隔必须大于0: %s", refresh)
+		}
+		// librdkafka以"^"开头的topic作为正则订阅
+		if !strings.HasPrefix(pattern, "^") {
+			pattern = "^" + pattern
+		}
+		c.topicRegex = pattern
+		return c.conf.SetKey("topic.metadata.refresh.interval.ms", int(refresh.Milliseconds()))
+	}
+}
+
 // NewConsumerGroup 创建一个消费者实例
 // 默认从最旧的开始消费
 func NewConsumerGroup(addrs, topics []string, groupID string, handle HandleFunc, ops ...OptionFunc) (*ConsumerGroup, error) {
@@ -39,6 +83,7 @@ func NewConsumerGroup(addrs, topics []string, groupID string, handle HandleFunc,
 			"bootstrap.servers":         strings.Join(addrs, ","),
 			"group.id":                  groupID,
 			"auto.offset.reset":         "smallest",
+			"enable.auto.offset.store":  false, // 处理成功后再保存offset
 			"api.version.request":       "true",
 			"heartbeat.interval.ms":     5000,
 			"session.timeout.ms":        120000,
@@ -55,6 +100,18 @@ func NewConsumerGroup(addrs, topics []string, groupID string, handle HandleFunc,
 			return nil, err
 		}
 	}
+	subscription := make([]string, 0, len(topics)+1)
+	for _, t := range topics {
+		if t != "" {
+			subscription = append(subscription, t)
+		}
+	}
+	if conf.topicRegex != "" {
+		subscription = append(subscription, conf.topicRegex)
+	}
+	if len(subscription) == 0 {
+		return nil, fmt.Errorf("没有订阅的topic")
+	}
 	consumer, err := kafka.NewConsumer(conf.conf)
 	if err != nil {
 		return nil, err
@@ -62,14 +119,31 @@ func NewConsumerGroup(addrs, topics []string, groupID string, handle HandleFunc,
 	return &ConsumerGroup{
 		logger:   conf.logg,
 		consumer: consumer,
-		topics:   topics,
+		topics:   subscription,
 		hf:       handle,
+		beginAt:  conf.beginAt,
 	}, nil
 }
 
-// Run 执行消费动作
+// Topics 当前分配到分区的topic
+func (cg *ConsumerGroup) Topics() []string {
+	parts, err := cg.consumer.Assignment()
+	if err != nil {
+		return nil
+	}
+	topics := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p.Topic != nil {
+			topics = append(topics, *p.Topic)
+		}
+	}
+	slices.Sort(topics)
+	return slices.Compact(topics)
+}
+
+// Run 执行消费动作, ctx结束时返回
 func (cg *ConsumerGroup) Run(ctx context.Context) error {
-	if err := cg.consumer.SubscribeTopics(cg.topics, nil); err != nil {
+	if err := cg.consumer.SubscribeTopics(cg.topics, cg.rebalance); err != nil {
 		cg.logger.Error(logger.ErrorKafkaConsumer, "create Consumer Group", logger.ErrorField(err))
 		return err
 	}
@@ -77,10 +151,9 @@ func (cg *ConsumerGroup) Run(ctx context.Context) error {
 	cg.logger.Info("run kafka consumer", logger.MakeField("topics", cg.topics))
 	msgCount := 0
 	var err error
-	for {
-		ent := cg.consumer.Poll(2000)
+	for ctx.Err() == nil {
+		ent := cg.consumer.Poll(pollTimeout)
 		if ent == nil {
-			<-time.After(time.Second)
 			continue
 		}
 		switch e := ent.(type) {
@@ -88,13 +161,23 @@ func (cg *ConsumerGroup) Run(ctx context.Context) error {
 			err = cg.hf(ctx, &Data{
 				FaninTime: e.Timestamp,
 				Topic:     *e.TopicPartition.Topic,
+				Partition: e.TopicPartition.Partition,
+				Offset:    int64(e.TopicPartition.Offset),
 				Key:       e.Key,
 				Value:     e.Value,
+				Headers:   headers(e.Headers),
 			})
 			if err != nil {
+				if ctx.Err() != nil {
+					// 未处理完的消息不保存offset, 重启后再次消费
+					return nil
+				}
 				cg.logger.Error(logger.ErrorKafkaConsumer, "Kafka Consumer handle", logger.ErrorField(err))
 				continue
 			}
+			if _, err = cg.consumer.StoreMessage(e); err != nil {
+				cg.logger.Error(logger.ErrorKafkaConsumer, "consumer store offset", logger.ErrorField(err))
+			}
 
 			msgCount++
 			if msgCount%offsetCommitLimit == 0 {
@@ -107,14 +190,82 @@ func (cg *ConsumerGroup) Run(ctx context.Context) error {
 				// cg.logger.Info("consumer Commit", logger.MakeField("TopicPartition", offsets))
 				continue
 			}
-			cg.logger.Info("handle message", logger.MakeField("TopicPartition", e.TopicPartition))
+			cg.logger.Debugf("handle message: %s", e.TopicPartition)
 		case kafka.PartitionEOF:
 			cg.logger.Info("Reached", logger.MakeField("event", e))
 		case kafka.Error:
+			// 非致命错误(如broker连接断开)由librdkafka自动恢复
+			if !e.IsFatal() {
+				cg.logger.Warn(logger.ErrorKafkaConsumer, "Kafka Consumer data", logger.ErrorField(e))
+				continue
+			}
 			cg.logger.Error(logger.ErrorKafkaConsumer, "Kafka Consumer data", logger.ErrorField(e))
 			return e
 		default:
 			cg.logger.Debugf("Ignored event: %+v", e)
 		}
 	}
+	return nil
+}
+
+// rebalance 分配分区时, 没有提交offset的分区从beginAt之后的第一条消息开始消费
+func (cg *ConsumerGroup) rebalance(c *kafka.Consumer, ev kafka.Event) error {
+	switch e := ev.(type) {
+	case kafka.AssignedPartitions:
+		cg.logger.Info("consumer assigned", logger.MakeField("partitions", e.Partitions))
+		parts := e.Partitions
+		if !cg.beginAt.IsZero() {
+			parts = cg.seek(c, parts)
+		}
+		return c.Assign(parts)
+	case kafka.RevokedPartitions:
+		cg.logger.Info("consumer revoked", logger.MakeField("partitions", e.Partitions))
+		return c.Unassign()
+	}
+	return nil
+}
+
+// seek 查询已提交的offset, 没有提交的分区按时间查找起始offset; 查询失败时使用auto.offset.reset
+func (cg *ConsumerGroup) seek(c *kafka.Consumer, parts []kafka.TopicPartition) []kafka.TopicPartition {
+	committed, err := c.Committed(parts, offsetQueryTimeout)
+	if err != nil {
+		cg.logger.Error(logger.ErrorKafkaConsumer, "查询已提交的offset", logger.ErrorField(err))
+		return parts
+	}
+	var times []kafka.TopicPartition
+	for _, p := range committed {
+		if p.Offset < 0 {
+			p.Offset = kafka.Offset(cg.beginAt.UnixMilli())
+			times = append(times, p)
+		}
+	}
+	if len(times) == 0 {
+		return parts
+	}
+	offsets, err := c.OffsetsForTimes(times, offsetQueryTimeout)
+	if err != nil {
+		cg.logger.Error(logger.ErrorKafkaConsumer, "按时间查询offset", logger.ErrorField(err))
+		return parts
+	}
+	for _, o := range offsets {
+		for i := range parts {
+			// 没有更晚的消息时offset为kafka.OffsetEnd, 从最新开始
+			if *parts[i].Topic == *o.Topic && parts[i].Partition == o.Partition && o.Error == nil {
+				parts[i].Offset = o.Offset
+			}
+		}
+	}
+	return parts
+}
+
+// headers 转换消息头
+func headers(hs []kafka.Header) []Header {
+	if len(hs) == 0 {
+		return nil
+	}
+	list := make([]Header, 0, len(hs))
+	for _, h := range hs {
+		list = append(list, Header{Key: h.Key, Value: h.Value})
+	}
+	return list
 }
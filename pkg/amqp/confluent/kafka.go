@@ -1,6 +1,8 @@
 package confluent
 
 import (
+	"time"
+
 	"github.com/chengfeiZhou/Wormhole/pkg/logger"
 	"github.com/confluentinc/confluent-kafka-go/kafka"
 )
@@ -8,8 +10,10 @@ import (
 type OptionFunc func(*Config) error
 
 type Config struct {
-	conf *kafka.ConfigMap
-	logg logger.Logger
+	conf       *kafka.ConfigMap
+	logg       logger.Logger
+	beginAt    time.Time // 消费者没有提交offset时按时间开始消费
+	topicRegex string    // 消费者按正则订阅topic
 }
 
 // func WithVersion(v sarama.KafkaVersion) OptionFunc {
@@ -2,8 +2,11 @@ package kafka
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/IBM/sarama"
@@ -28,42 +31,98 @@ PS: 一旦触发rebalance，会话必须在Config中完成; 这意味着Consumer
 */
 
 // ConsumerGroup 定义消费者组类
+// nolint
 type ConsumerGroup struct {
 	logger   logger.Logger
+	client   sarama.Client
 	consumer sarama.ConsumerGroup
 	conf     *sarama.Config
 	options  consumerOption
+	pattern  *regexp.Regexp // 不为空时按正则订阅topic
+	refresh  time.Duration  // 正则订阅刷新topic列表的间隔
+	mu       sync.Mutex
+	topics   []string      // 当前订阅的topic
+	rejoin   func()        // 结束当前会话, 按新的topic列表重新加入消费者组
+	changed  chan struct{} // 订阅的topic变化
 }
 
 type Data struct {
 	FaninTime time.Time
 	Topic     string
+	Partition int32
+	Offset    int64
 	Key       []byte
 	Value     []byte
+	Headers   []Header
 }
 
 // String data to string
 func (d *Data) String() string {
-	return fmt.Sprintf("{ Topic: %s, Key: %s, Value: %s, FaninTime:%s }",
-		d.Topic, d.Key, d.Value, d.FaninTime.Format(times.TimeFormatMS))
+	return fmt.Sprintf("{ Topic: %s, Partition: %d, Offset: %d, Key: %s, Value: %s, FaninTime:%s }",
+		d.Topic, d.Partition, d.Offset, d.Key, d.Value, d.FaninTime.Format(times.TimeFormatMS))
 }
 
 // consumerOption 定义创建消费者所需要的参数
 // 并实现了 `ConsumerGroupHandler`
 type consumerOption struct {
 	logger   logger.Logger
+	client   sarama.Client
 	callback func(context.Context, *Data) error
 	groupID  string
 	topics   []string
 	addrs    []string
+	beginAt  time.Time // 不为零时, 没有提交offset的分区从该时间开始消费
 }
 
 // nolint
 func (co consumerOption) Setup(sess sarama.ConsumerGroupSession) error {
 	co.logger.Info("consumer setup", logger.MakeField("groupID", co.groupID), logger.MakeField("{topic: partition}", sess.Claims()))
+	if !co.beginAt.IsZero() {
+		co.seek(sess)
+	}
 	return nil
 }
 
+// seek 没有提交offset的分区从beginAt之后的第一条消息开始消费, 没有更晚的消息时从最新开始
+func (co consumerOption) seek(sess sarama.ConsumerGroupSession) {
+	coordinator, err := co.client.Coordinator(co.groupID)
+	if err != nil {
+		co.logger.Error(logger.ErrorKafkaConsumer, "查找消费者组的coordinator", logger.ErrorField(err))
+		return
+	}
+	req := &sarama.OffsetFetchRequest{Version: 1, ConsumerGroup: co.groupID}
+	for topic, partitions := range sess.Claims() {
+		for _, p := range partitions {
+			req.AddPartition(topic, p)
+		}
+	}
+	resp, err := coordinator.FetchOffset(req)
+	if err != nil {
+		co.logger.Error(logger.ErrorKafkaConsumer, "查询已提交的offset", logger.ErrorField(err))
+		return
+	}
+	for topic, partitions := range sess.Claims() {
+		for _, p := range partitions {
+			if block := resp.GetBlock(topic, p); block == nil || block.Err != sarama.ErrNoError || block.Offset >= 0 {
+				continue
+			}
+			offset, errO := co.client.GetOffset(topic, p, co.beginAt.UnixMilli())
+			if errO == nil && offset < 0 {
+				offset, errO = co.client.GetOffset(topic, p, sarama.OffsetNewest)
+			}
+			if errO != nil {
+				co.logger.Error(logger.ErrorKafkaConsumer, "按时间查询offset", logger.ErrorField(errO),
+					logger.MakeField("topic", topic), logger.MakeField("partition", p))
+				continue
+			}
+			// 没有提交过offset时MarkOffset决定会话的起始位置
+			sess.MarkOffset(topic, p, offset, "")
+			co.logger.Info("consumer begin at", logger.MakeField("topic", topic), logger.MakeField("partition", p),
+				logger.MakeField("offset", offset))
+		}
+	}
+}
+
 // nolint
 func (co consumerOption) Cleanup(sess sarama.ConsumerGroupSession) error {
 	co.logger.Info("consumer exiting", logger.MakeField("groupID", co.groupID))
@@ -76,42 +135,49 @@ func (co consumerOption) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sa
 	const (
 		offsetCommitLimit = 10
 	)
-	single := make(chan struct{}, 1)
 	offsetCacheNum := 0
 	for {
 		select {
-		case msg := <-claim.Messages():
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
 			// Mark: @zcf Callback崩了会影响到消费任务
 			// 所以, Callback一定要用好Context
 			data := &Data{
 				Key:       msg.Key,
 				Value:     msg.Value,
 				Topic:     msg.Topic,
+				Partition: msg.Partition,
+				Offset:    msg.Offset,
 				FaninTime: msg.Timestamp,
+				Headers:   headers(msg.Headers),
 			}
 			err := co.callback(sess.Context(), data)
 			retry := 0
-			for err != nil && retry < 5 {
+			for err != nil && retry < 5 && sess.Context().Err() == nil {
 				co.logger.Error(logger.ErrorKafkaConsumer, "callback handle", logger.MakeField("GroupID", co.groupID),
 					logger.MakeField("Topic", claim.Topic()), logger.ErrorField(err))
-				if err = co.callback(sess.Context(), data); err == nil {
-					break
+				select {
+				case <-time.After(time.Second):
+				case <-sess.Context().Done():
 				}
-				<-time.After(time.Second)
+				err = co.callback(sess.Context(), data)
 				retry++
 			}
+			if sess.Context().Err() != nil {
+				// 会话结束时未处理完的消息不提交, 重新加入后再次消费
+				return nil
+			}
 			sess.MarkMessage(msg, "")
 			offsetCacheNum++
 			if offsetCacheNum >= offsetCommitLimit {
-				single <- struct{}{}
+				sess.Commit()
+				offsetCacheNum = 0
+				co.logger.Debugf("consumer[%s] commit offset: %s:[%d] %d", co.groupID, claim.Topic(), claim.Partition(), msg.Offset+1)
 			}
-			co.logger.Infof("consumer[%s]: Topic: %s, Partition: %v, BrokerID: %s, Offset:%d, Accession: %s ago",
+			co.logger.Debugf("consumer[%s]: Topic: %s, Partition: %v, BrokerID: %s, Offset:%d, Accession: %s ago",
 				co.groupID, claim.Topic(), claim.Partition(), sess.MemberID(), msg.Offset, time.Since(msg.Timestamp).String())
-		case <-single:
-			sess.Commit()
-			offsetCacheNum = 0
-			co.logger.Error(logger.ErrorKafkaConsumer, "提交offset", logger.MakeField("groupID", co.groupID), logger.MakeField("next", claim.HighWaterMarkOffset()),
-				logger.MakeField("topic: [partition]", fmt.Sprintf("%s:[%d]", claim.Topic(), claim.Partition())))
 		case <-sess.Context().Done():
 			co.logger.Info("Consumer context closing", logger.MakeField("GroupID", co.groupID),
 				logger.MakeField("Topic", claim.Topic()), logger.MakeField("Partition", claim.Partition()),
@@ -122,6 +188,18 @@ func (co consumerOption) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sa
 	}
 }
 
+// headers 转换消息头
+func headers(hs []*sarama.RecordHeader) []Header {
+	if len(hs) == 0 {
+		return nil
+	}
+	list := make([]Header, 0, len(hs))
+	for _, h := range hs {
+		list = append(list, Header{Key: string(h.Key), Value: h.Value})
+	}
+	return list
+}
+
 type HandleFunc func(context.Context, *Data) error
 
 // Fetch 定义消费者拉取缓存的配置对象
@@ -136,6 +214,7 @@ func ConsumerWithFetch(f Fetch) OptionFunc {
 	}
 }
 
+// ConsumerBeginAt 没有提交offset时的起始位置: sarama.OffsetOldest, sarama.OffsetNewest
 func ConsumerBeginAt(at int64) OptionFunc {
 	return func(c *Config) error {
 		c.Config.Consumer.Offsets.Initial = at
@@ -143,6 +222,30 @@ func ConsumerBeginAt(at int64) OptionFunc {
 	}
 }
 
+// ConsumerBeginAtTime 没有提交offset时从t之后的第一条消息开始消费
+func ConsumerBeginAtTime(t time.Time) OptionFunc {
+	return func(c *Config) error {
+		c.beginAt = t
+		return nil
+	}
+}
+
+// ConsumerTopicRegex 订阅名称匹配正则的所有topic, 每隔refresh刷新一次topic列表, 变化时重新加入消费者组
+func ConsumerTopicRegex(pattern string, refresh time.Duration) OptionFunc {
+	return func(c *Config) error {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return err
+		}
+		if refresh <= 0 {
+			return fmt.Errorf("topic列表刷新间隔必须大于0: %s", refresh)
+		}
+		c.topicRegex = re
+		c.topicRefresh = refresh
+		return nil
+	}
+}
+
 // NewConsumerGroup 创建一个消费者实例
 // 默认从最旧的开始消费
 func NewConsumerGroup(addrs, topics []string, groupID string, handle HandleFunc, ops ...OptionFunc) (*ConsumerGroup, error) {
@@ -175,62 +278,169 @@ func NewConsumerGroup(addrs, topics []string, groupID string, handle HandleFunc,
 			return nil, err
 		}
 	}
-	cg, err := sarama.NewConsumerGroup(addrs, groupID, conf.Config)
+	if len(topics) == 0 && conf.topicRegex == nil {
+		return nil, fmt.Errorf("没有订阅的topic")
+	}
+	client, err := sarama.NewClient(addrs, conf.Config)
 	if err != nil {
 		return nil, err
 	}
+	cg, err := sarama.NewConsumerGroupFromClient(groupID, client)
+	if err != nil {
+		_ = client.Close()
+		return nil, err
+	}
 	consumer := &ConsumerGroup{
 		conf:     conf.Config,
 		logger:   conf.logger,
+		client:   client,
 		consumer: cg,
 		options: consumerOption{
 			logger:   conf.logger,
+			client:   client,
 			callback: handle,
 			groupID:  groupID,
 			topics:   topics,
 			addrs:    addrs,
+			beginAt:  conf.beginAt,
 		},
+		pattern: conf.topicRegex,
+		refresh: conf.topicRefresh,
+		topics:  MatchTopics(topics, nil, nil),
+		changed: make(chan struct{}, 1),
 	}
 	return consumer, nil
 }
 
+// MatchTopics 返回订阅的topic: topics与all中名称匹配re的topic的并集(排序, 去重)
+// 正则不匹配以"__"开头的内部topic
+func MatchTopics(topics, all []string, re *regexp.Regexp) []string {
+	list := make([]string, 0, len(topics))
+	for _, t := range topics {
+		if t != "" {
+			list = append(list, t)
+		}
+	}
+	if re != nil {
+		for _, t := range all {
+			if !strings.HasPrefix(t, "__") && re.MatchString(t) {
+				list = append(list, t)
+			}
+		}
+	}
+	slices.Sort(list)
+	return slices.Compact(list)
+}
+
+// Topics 当前订阅的topic
+func (cg *ConsumerGroup) Topics() []string {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	return slices.Clone(cg.topics)
+}
+
 // Run 执行消费动作
 func (cg *ConsumerGroup) Run(ctx context.Context) error {
 	cg.logger.Info("run kafka consumer", logger.MakeField("topics", cg.options.topics),
 		logger.MakeField("groupID", cg.options.groupID), logger.MakeField("addrs", cg.options.addrs))
 	defer cg.close()
-	for {
-		select {
-		case err := <-cg.consumer.Errors(): // Track errors
+	go func() {
+		// Errors在消费者组关闭后关闭
+		for err := range cg.consumer.Errors() {
 			cg.logger.Error(logger.ErrorKafkaConsumer, "Error channel", logger.MakeField("GroupId", cg.options.groupID),
 				logger.ErrorField(err))
-		case <-ctx.Done():
-			err := ctx.Err()
-			if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
-				// 正常退出
+		}
+	}()
+	if cg.pattern != nil {
+		if err := cg.refreshTopics(); err != nil {
+			cg.logger.Error(logger.ErrorKafkaConsumer, "刷新topic列表", logger.ErrorField(err))
+		}
+		go cg.watchTopics(ctx)
+	}
+	for {
+		sessCtx, cancel := context.WithCancel(ctx)
+		cg.mu.Lock()
+		topics := slices.Clone(cg.topics)
+		cg.rejoin = cancel
+		cg.mu.Unlock()
+		if len(topics) == 0 {
+			// 正则还没有匹配到topic
+			cancel()
+			select {
+			case <-ctx.Done():
 				return nil
+			case <-cg.changed:
+				continue
 			}
-			cg.logger.Error(logger.ErrorMethod, "上下文异常退出", logger.MakeField("GroupId", cg.options.groupID),
-				logger.ErrorField(err))
+		}
+		err := cg.consumer.Consume(sessCtx, topics, cg.options)
+		cancel()
+		if ctx.Err() != nil {
+			// 正常退出
+			return nil
+		}
+		if err != nil {
+			cg.logger.Error(logger.ErrorKafkaConsumer, "Error channel",
+				logger.MakeField("GroupId", cg.options.groupID), logger.ErrorField(err))
+			// TODO: 这个错误需要关注一下,暂时不知道这里报错会造成什么问题
 			return err
-		default:
-			if err := cg.consumer.Consume(ctx, cg.options.topics, cg.options); err != nil {
-				cg.logger.Error(logger.ErrorKafkaConsumer, "Error channel",
-					logger.MakeField("GroupId", cg.options.groupID), logger.ErrorField(err))
-				// TODO: 这个错误需要关注一下,暂时不知道这里报错会造成什么问题
-				return err
-			}
 		}
 	}
 }
 
+// watchTopics 定时刷新正则订阅的topic列表
+func (cg *ConsumerGroup) watchTopics(ctx context.Context) {
+	ticker := time.NewTicker(cg.refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := cg.refreshTopics(); err != nil {
+			cg.logger.Error(logger.ErrorKafkaConsumer, "刷新topic列表", logger.ErrorField(err))
+		}
+	}
+}
+
+// refreshTopics 从集群元数据中匹配topic, 变化时结束当前会话重新加入消费者组
+func (cg *ConsumerGroup) refreshTopics() error {
+	if err := cg.client.RefreshMetadata(); err != nil {
+		return err
+	}
+	all, err := cg.client.Topics()
+	if err != nil {
+		return err
+	}
+	topics := MatchTopics(cg.options.topics, all, cg.pattern)
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	if slices.Equal(topics, cg.topics) {
+		return nil
+	}
+	cg.logger.Info("订阅的topic变化", logger.MakeField("from", cg.topics), logger.MakeField("to", topics))
+	cg.topics = topics
+	if cg.rejoin != nil {
+		cg.rejoin()
+	}
+	select {
+	case cg.changed <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
 func (cg *ConsumerGroup) close() {
-	if cvt.IsNil(cg.consumer) {
+	if !cvt.IsNil(cg.consumer) {
 		if err := cg.consumer.Close(); err != nil {
 			cg.logger.Error(logger.ErrorKafkaConsumer, "Consumer stoped error",
 				logger.MakeField("GroupId", cg.options.groupID), logger.ErrorField(err))
-			return
 		}
 	}
+	// 从client创建的消费者组不会关闭client
+	if !cvt.IsNil(cg.client) {
+		_ = cg.client.Close()
+	}
 	cg.logger.Info("Consumer stoped", logger.MakeField("GroupId", cg.options.groupID))
 }
@@ -0,0 +1,120 @@
+package kafka
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchTopics(t *testing.T) {
+	all := []string{"orders.eu", "orders.us", "payments", "__consumer_offsets", "orders.eu"}
+	re := regexp.MustCompile(`^orders\.`)
+	assert.Equal(t, []string{"audit", "orders.eu", "orders.us"}, MatchTopics([]string{"orders.us", "audit", ""}, all, re))
+	assert.Equal(t, []string{"payments"}, MatchTopics([]string{"payments"}, all, nil))
+	assert.Empty(t, MatchTopics(nil, all, regexp.MustCompile(`^billing`)))
+}
+
+func TestConsumerBeginAtTime(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 0)
+	defer broker.Close()
+	at := time.Now().Add(-time.Hour)
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("orders", 0, broker.BrokerID()),
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).
+			SetOffset("orders", 0, sarama.OffsetOldest, 0).
+			SetOffset("orders", 0, sarama.OffsetNewest, 6).
+			SetOffset("orders", 0, at.UnixMilli(), 5),
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).
+			SetCoordinator(sarama.CoordinatorGroup, "g", broker),
+		"HeartbeatRequest": sarama.NewMockHeartbeatResponse(t),
+		"JoinGroupRequest": sarama.NewMockJoinGroupResponse(t).SetGroupProtocol(sarama.RangeBalanceStrategyName),
+		"SyncGroupRequest": sarama.NewMockSyncGroupResponse(t).SetMemberAssignment(
+			&sarama.ConsumerGroupMemberAssignment{Topics: map[string][]int32{"orders": {0}}}),
+		// 没有提交过offset
+		"OffsetFetchRequest": sarama.NewMockOffsetFetchResponse(t).
+			SetOffset("g", "orders", 0, -1, "", sarama.ErrNoError).SetError(sarama.ErrNoError),
+		"OffsetCommitRequest": sarama.NewMockOffsetCommitResponse(t),
+		"LeaveGroupRequest":   sarama.NewMockLeaveGroupResponse(t),
+		"FetchRequest": sarama.NewMockFetchResponse(t, 1).
+			SetMessage("orders", 0, 3, sarama.StringEncoder("old")).
+			SetMessage("orders", 0, 5, sarama.StringEncoder("new")),
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	got := make(chan *Data, 2)
+	cg, err := NewConsumerGroup([]string{broker.Addr()}, []string{"orders"}, "g",
+		func(_ context.Context, d *Data) error {
+			got <- d
+			return nil
+		}, WithVersion(sarama.V2_0_0_0), ConsumerBeginAtTime(at))
+	assert.NoError(t, err)
+	done := make(chan error)
+	go func() { done <- cg.Run(ctx) }()
+	select {
+	case d := <-got:
+		// 跳过beginAt之前的消息
+		assert.Equal(t, "new", string(d.Value))
+		assert.Equal(t, []any{int32(0), int64(5)}, []any{d.Partition, d.Offset})
+	case <-time.After(5 * time.Second):
+		t.Fatal("没有消费到消息")
+	}
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestConsumerTopicRegex(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 0)
+	defer broker.Close()
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("orders.eu", 0, broker.BrokerID()).
+			SetLeader("payments", 0, broker.BrokerID()),
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).
+			SetOffset("orders.eu", 0, sarama.OffsetOldest, 0).
+			SetOffset("orders.eu", 0, sarama.OffsetNewest, 1),
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).
+			SetCoordinator(sarama.CoordinatorGroup, "g", broker),
+		"HeartbeatRequest": sarama.NewMockHeartbeatResponse(t),
+		"JoinGroupRequest": sarama.NewMockJoinGroupResponse(t).SetGroupProtocol(sarama.RangeBalanceStrategyName),
+		"SyncGroupRequest": sarama.NewMockSyncGroupResponse(t).SetMemberAssignment(
+			&sarama.ConsumerGroupMemberAssignment{Topics: map[string][]int32{"orders.eu": {0}}}),
+		"OffsetFetchRequest": sarama.NewMockOffsetFetchResponse(t).
+			SetOffset("g", "orders.eu", 0, 0, "", sarama.ErrNoError).SetError(sarama.ErrNoError),
+		"OffsetCommitRequest": sarama.NewMockOffsetCommitResponse(t),
+		"LeaveGroupRequest":   sarama.NewMockLeaveGroupResponse(t),
+		"FetchRequest": sarama.NewMockFetchResponse(t, 1).
+			SetMessage("orders.eu", 0, 0, sarama.StringEncoder("eu")),
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	got := make(chan string, 1)
+	cg, err := NewConsumerGroup([]string{broker.Addr()}, nil, "g",
+		func(_ context.Context, d *Data) error {
+			got <- d.Topic
+			return nil
+		}, WithVersion(sarama.V2_0_0_0), ConsumerTopicRegex(`^orders\.`, time.Minute))
+	assert.NoError(t, err)
+	done := make(chan error)
+	go func() { done <- cg.Run(ctx) }()
+	select {
+	case topic := <-got:
+		assert.Equal(t, "orders.eu", topic)
+	case <-time.After(5 * time.Second):
+		t.Fatal("没有消费到消息")
+	}
+	assert.Equal(t, []string{"orders.eu"}, cg.Topics())
+	cancel()
+	assert.NoError(t, <-done)
+
+	_, err = NewConsumerGroup([]string{broker.Addr()}, nil, "g", nil)
+	assert.Error(t, err)
+}
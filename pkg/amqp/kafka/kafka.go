@@ -1,6 +1,9 @@
 package kafka
 
 import (
+	"regexp"
+	"time"
+
 	"github.com/IBM/sarama"
 	"github.com/chengfeiZhou/Wormhole/pkg/logger"
 )
@@ -13,8 +16,12 @@ type OptionFunc func(*Config) error
 
 type Config struct {
 	*sarama.Config
-	logger           logger.Logger
-	producerMsgBatch int // 生产者缓冲队列长度
+	logger              logger.Logger
+	producerMsgBatch    int            // 生产者缓冲队列长度
+	producerPartitioner string         // 生产者默认的分区策略
+	beginAt             time.Time      // 消费者没有提交offset时按时间开始消费
+	topicRegex          *regexp.Regexp // 消费者按正则订阅topic
+	topicRefresh        time.Duration  // 正则订阅刷新topic列表的间隔
 }
 
 func WithVersion(v sarama.KafkaVersion) OptionFunc {
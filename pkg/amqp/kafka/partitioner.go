@@ -0,0 +1,153 @@
+package kafka
+
+import (
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+
+	"github.com/IBM/sarama"
+)
+
+// 生产者的分区策略
+const (
+	PartitionHash       = "hash"       // 按key哈希(与Java客户端的murmur2一致), 没有key时轮询
+	PartitionSource     = "source"     // 与源消息相同的分区, 超出分区数时取模; 源分区未知时按key哈希
+	PartitionRoundRobin = "roundrobin" // 轮询
+	PartitionRandom     = "random"     // 随机
+)
+
+// ValidPartitioner 分区策略是否有效, 为空表示使用生产者的默认策略
+func ValidPartitioner(name string) error {
+	switch name {
+	case "", PartitionHash, PartitionSource, PartitionRoundRobin, PartitionRandom:
+		return nil
+	}
+	return fmt.Errorf("不支持的分区策略: %s", name)
+}
+
+// ProducerWithPartitioner 设置没有指定分区策略的消息使用的策略, 默认hash
+func ProducerWithPartitioner(name string) OptionFunc {
+	return func(c *Config) error {
+		if err := ValidPartitioner(name); err != nil {
+			return err
+		}
+		if name != "" {
+			c.producerPartitioner = name
+		}
+		return nil
+	}
+}
+
+// partitioning 随消息传给分区器的策略, 保存在ProducerMessage.Metadata中
+type partitioning struct {
+	strategy string
+	source   int32 // 源消息的分区, 小于0表示未知
+}
+
+// partitioner 按消息选择分区策略
+type partitioner struct {
+	strategy string // 默认策略
+	next     atomic.Uint32
+}
+
+func newPartitioner(strategy string) sarama.PartitionerConstructor {
+	return func(string) sarama.Partitioner {
+		return &partitioner{strategy: strategy}
+	}
+}
+
+func (p *partitioner) message(m *sarama.ProducerMessage) partitioning {
+	pt, _ := m.Metadata.(*partitioning)
+	if pt == nil {
+		return partitioning{strategy: p.strategy, source: -1}
+	}
+	if pt.strategy == "" {
+		return partitioning{strategy: p.strategy, source: pt.source}
+	}
+	return *pt
+}
+
+// Partition 实现sarama.Partitioner
+func (p *partitioner) Partition(m *sarama.ProducerMessage, numPartitions int32) (int32, error) {
+	pt := p.message(m)
+	switch pt.strategy {
+	case PartitionHash:
+		return p.hash(m, numPartitions)
+	case PartitionSource:
+		if pt.source >= 0 {
+			return pt.source % numPartitions, nil
+		}
+		return p.hash(m, numPartitions)
+	case PartitionRandom:
+		return rand.Int31n(numPartitions), nil
+	}
+	return p.roundRobin(numPartitions), nil
+}
+
+// hash 按key哈希, 没有key时轮询
+func (p *partitioner) hash(m *sarama.ProducerMessage, numPartitions int32) (int32, error) {
+	if m.Key == nil {
+		return p.roundRobin(numPartitions), nil
+	}
+	key, err := m.Key.Encode()
+	if err != nil {
+		return -1, err
+	}
+	return (murmur2(key) & 0x7fffffff) % numPartitions, nil
+}
+
+func (p *partitioner) roundRobin(numPartitions int32) int32 {
+	return int32(p.next.Add(1)-1) % numPartitions
+}
+
+// RequiresConsistency 实现sarama.Partitioner, 由MessageRequiresConsistency按消息判断
+func (p *partitioner) RequiresConsistency() bool {
+	return true
+}
+
+// MessageRequiresConsistency 按key或源分区选择的分区不能因为分区不可用而改变
+func (p *partitioner) MessageRequiresConsistency(m *sarama.ProducerMessage) bool {
+	pt := p.message(m)
+	switch pt.strategy {
+	case PartitionHash:
+		return m.Key != nil
+	case PartitionSource:
+		return pt.source >= 0 || m.Key != nil
+	}
+	return false
+}
+
+// murmur2 与Java客户端(org.apache.kafka.common.utils.Utils.murmur2)一致的哈希
+func murmur2(data []byte) int32 {
+	const (
+		seed uint32 = 0x9747b28c
+		m    uint32 = 0x5bd1e995
+		r           = 24
+	)
+	length := len(data)
+	h := seed ^ uint32(length)
+	for i := 0; i+4 <= length; i += 4 {
+		k := uint32(data[i]) | uint32(data[i+1])<<8 | uint32(data[i+2])<<16 | uint32(data[i+3])<<24
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+	tail := length &^ 3
+	switch length % 4 {
+	case 3:
+		h ^= uint32(data[tail+2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(data[tail+1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(data[tail])
+		h *= m
+	}
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return int32(h)
+}
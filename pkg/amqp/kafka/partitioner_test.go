@@ -0,0 +1,74 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMurmur2(t *testing.T) {
+	// 与Java客户端Utils.murmur2的结果一致
+	cases := map[string]int32{
+		"21":                         -973932308,
+		"foobar":                     -790332482,
+		"a-little-bit-long-string":   -985981536,
+		"a-little-bit-longer-string": -1486304829,
+		"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8": -58897971,
+		"abc": 479470107,
+	}
+	for in, want := range cases {
+		assert.Equal(t, want, murmur2([]byte(in)), in)
+	}
+}
+
+func TestPartitioner(t *testing.T) {
+	p := newPartitioner(PartitionHash)("topic")
+	msg := func(key string, strategy string, source int32) *sarama.ProducerMessage {
+		m := &sarama.ProducerMessage{Metadata: &partitioning{strategy: strategy, source: source}}
+		if key != "" {
+			m.Key = sarama.StringEncoder(key)
+		}
+		return m
+	}
+
+	// hash: 与Java客户端的默认分区一致
+	got, err := p.Partition(msg("foobar", "", -1), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, (murmur2([]byte("foobar"))&0x7fffffff)%10, got)
+	assert.True(t, p.(sarama.DynamicConsistencyPartitioner).MessageRequiresConsistency(msg("foobar", "", -1)))
+	// 没有key时轮询
+	assert.False(t, p.(sarama.DynamicConsistencyPartitioner).MessageRequiresConsistency(msg("", "", -1)))
+
+	// source: 超出分区数时取模
+	got, _ = p.Partition(msg("foobar", PartitionSource, 7), 10)
+	assert.Equal(t, int32(7), got)
+	got, _ = p.Partition(msg("foobar", PartitionSource, 7), 4)
+	assert.Equal(t, int32(3), got)
+	assert.True(t, p.(sarama.DynamicConsistencyPartitioner).MessageRequiresConsistency(msg("", PartitionSource, 7)))
+	// 源分区未知时按key哈希, 不落到分区0
+	got, _ = p.Partition(msg("foobar", PartitionSource, -1), 10)
+	assert.Equal(t, (murmur2([]byte("foobar"))&0x7fffffff)%10, got)
+	assert.True(t, p.(sarama.DynamicConsistencyPartitioner).MessageRequiresConsistency(msg("foobar", PartitionSource, -1)))
+	assert.False(t, p.(sarama.DynamicConsistencyPartitioner).MessageRequiresConsistency(msg("", PartitionSource, -1)))
+	// 没有Metadata的消息使用默认策略, 源分区未知
+	src := newPartitioner(PartitionSource)("topic")
+	got, _ = src.Partition(&sarama.ProducerMessage{Key: sarama.StringEncoder("foobar")}, 10)
+	assert.Equal(t, (murmur2([]byte("foobar"))&0x7fffffff)%10, got)
+
+	// roundrobin
+	rr := newPartitioner(PartitionRoundRobin)("topic")
+	var seq []int32
+	for i := 0; i < 4; i++ {
+		got, _ = rr.Partition(&sarama.ProducerMessage{Key: sarama.StringEncoder("k")}, 3)
+		seq = append(seq, got)
+	}
+	assert.Equal(t, []int32{0, 1, 2, 0}, seq)
+
+	// random
+	got, _ = p.Partition(msg("k", PartitionRandom, -1), 5)
+	assert.True(t, got >= 0 && got < 5)
+
+	assert.NoError(t, ValidPartitioner(""))
+	assert.Error(t, ValidPartitioner("sticky"))
+}
@@ -39,13 +39,12 @@ func ProducerWithMaxMessageBytes(size int) OptionFunc {
 func NewProducer(addrs []string, ops ...OptionFunc) (*Producer, error) {
 	sarama.MaxRequestSize = maxMsgBytes
 	conf := &Config{
-		Config:           sarama.NewConfig(),
-		logger:           logger.DefaultLogger(),
-		producerMsgBatch: msgBatch,
+		Config:              sarama.NewConfig(),
+		logger:              logger.DefaultLogger(),
+		producerMsgBatch:    msgBatch,
+		producerPartitioner: PartitionHash,
 	}
 	conf.Config.Version = defaultVersion
-	// 采用随机而非哈希方法
-	conf.Config.Producer.Partitioner = sarama.NewRandomPartitioner
 	conf.Config.Producer.Return.Successes = true
 	conf.Config.Producer.Return.Errors = true
 	conf.Config.Producer.Idempotent = true // 开启幂等性
@@ -59,6 +58,8 @@ func NewProducer(addrs []string, ops ...OptionFunc) (*Producer, error) {
 		}
 	}
 
+	// 按消息的分区策略选择分区, 见partitioner
+	conf.Config.Producer.Partitioner = newPartitioner(conf.producerPartitioner)
 	conf.logger.Infof("kafka producer addr: %v", addrs)
 	p, err := sarama.NewSyncProducer(addrs, conf.Config)
 	if err != nil {
@@ -144,20 +145,38 @@ func (p *Producer) Close() {
 	}
 }
 
-// Msg 定义消息对象
-type Msg struct {
-	Topic string
+// Header 消息头
+type Header struct {
 	Key   string
 	Value []byte
 }
 
+// Msg 定义消息对象
+type Msg struct {
+	Topic       string
+	Key         string // 为空时不设置key
+	Value       []byte
+	Headers     []Header
+	Timestamp   time.Time // 为零时由生产者设置当前时间
+	Partitioner string    // 分区策略, 为空时使用生产者的默认策略
+	Partition   int32     // 源消息的分区, 用于source策略; 小于0(未知)时按key哈希
+}
+
 // makeProducMsg 构建ProducerMessage
 func (m *Msg) makeProducMsg() *sarama.ProducerMessage {
-	return &sarama.ProducerMessage{
-		Topic: m.Topic,
-		Key:   sarama.StringEncoder(m.Key),
-		Value: sarama.ByteEncoder(m.Value),
+	pm := &sarama.ProducerMessage{
+		Topic:     m.Topic,
+		Value:     sarama.ByteEncoder(m.Value),
+		Timestamp: m.Timestamp,
+		Metadata:  &partitioning{strategy: m.Partitioner, source: m.Partition},
+	}
+	if m.Key != "" {
+		pm.Key = sarama.StringEncoder(m.Key)
+	}
+	for _, h := range m.Headers {
+		pm.Headers = append(pm.Headers, sarama.RecordHeader{Key: []byte(h.Key), Value: h.Value})
 	}
+	return pm
 }
 
 // msgList 定义待发送数据的对象
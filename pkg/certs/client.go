@@ -0,0 +1,58 @@
+package certs
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+)
+
+// ClientTLS 出站连接(客户端)的TLS配置
+// nolint
+type ClientTLS struct {
+	CA         string `json:"ca"`         // 校验服务端证书的CA文件(PEM), 为空时使用系统CA
+	Cert       string `json:"cert"`       // 客户端证书(mTLS), 与key同时设置
+	Key        string `json:"key"`        // 客户端私钥
+	ServerName string `json:"serverName"` // SNI以及校验服务端证书使用的名称, 为空时使用目标地址的主机名
+	MinVersion string `json:"minVersion"` // 最低TLS版本: 1.2(默认), 1.3
+}
+
+// ParseVersion 解析TLS版本(1.2, 1.3), 为空时返回1.2
+func ParseVersion(v string) (uint16, error) {
+	switch v {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("TLS版本可选: 1.2, 1.3; 当前: %s", v)
+	}
+}
+
+// Config 生成客户端使用的tls.Config
+// 设置了客户端证书时, 证书文件变化后在下一次握手时自动重新加载(ops用于设置Reloader)
+func (c *ClientTLS) Config(ops ...OptionFunc) (*tls.Config, error) {
+	version, err := ParseVersion(c.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	conf := &tls.Config{
+		MinVersion: version,
+		ServerName: c.ServerName,
+	}
+	if c.CA != "" {
+		if conf.RootCAs, err = LoadPool(c.CA); err != nil {
+			return nil, err
+		}
+	}
+	if (c.Cert == "") != (c.Key == "") {
+		return nil, errors.New("客户端证书和私钥必须同时设置")
+	}
+	if c.Cert != "" {
+		r, err := NewReloader(c.Cert, c.Key, ops...)
+		if err != nil {
+			return nil, err
+		}
+		conf.GetClientCertificate = r.ClientCertificate
+	}
+	return conf, nil
+}
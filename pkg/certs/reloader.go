@@ -0,0 +1,219 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/chengfeiZhou/Wormhole/pkg/logger"
+)
+
+const (
+	ClientAuthNone     = "none"     // 不校验客户端证书
+	ClientAuthOptional = "optional" // 客户端提供证书时校验
+	ClientAuthRequire  = "require"  // 必须提供并通过校验
+)
+
+var ErrNoCertificate = errors.New("CA文件中没有可用的证书")
+
+// Reloader 加载证书/私钥以及客户端CA, 文件变化后在下一次握手时自动重新加载
+// 重新加载失败时继续使用之前的证书
+// nolint
+type Reloader struct {
+	log        logger.Logger
+	certFile   string
+	keyFile    string
+	caFile     string
+	clientAuth tls.ClientAuthType
+	interval   time.Duration // 两次检查文件变化的最小间隔
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	pool    *x509.CertPool
+	modTime time.Time // 证书/私钥/CA文件中最新的修改时间
+	checked time.Time
+}
+
+type OptionFunc func(*Reloader)
+
+// WithLogger 设置Reloader的日志记录器
+func WithLogger(log logger.Logger) OptionFunc {
+	return func(r *Reloader) {
+		r.log = log
+	}
+}
+
+// WithClientCA 设置校验客户端证书的CA文件(PEM, 可以包含多个证书)
+// mode: none, optional, require; 为空时默认require
+func WithClientCA(caFile, mode string) OptionFunc {
+	return func(r *Reloader) {
+		r.caFile = caFile
+		switch mode {
+		case ClientAuthNone:
+			r.clientAuth = tls.NoClientCert
+		case ClientAuthOptional:
+			r.clientAuth = tls.VerifyClientCertIfGiven
+		default:
+			r.clientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+}
+
+// WithInterval 设置检查文件变化的最小间隔
+func WithInterval(t time.Duration) OptionFunc {
+	return func(r *Reloader) {
+		r.interval = t
+	}
+}
+
+// NewReloader 加载证书并创建Reloader
+// certFile, keyFile: PEM格式的证书和私钥文件
+func NewReloader(certFile, keyFile string, ops ...OptionFunc) (*Reloader, error) {
+	r := &Reloader{
+		log:        logger.DefaultLogger(),
+		certFile:   certFile,
+		keyFile:    keyFile,
+		clientAuth: tls.NoClientCert,
+		interval:   10 * time.Second,
+	}
+	for _, op := range ops {
+		op(r)
+	}
+	if r.caFile == "" {
+		r.clientAuth = tls.NoClientCert
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ServerConfig 返回服务端使用的tls.Config, 每次握手都使用当前加载的证书和CA
+func (r *Reloader) ServerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.maybeReload()
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+				ClientAuth:   r.clientAuth,
+				ClientCAs:    r.pool,
+			}, nil
+		},
+	}
+}
+
+// ClientCertificate 返回当前加载的证书, 用于客户端的tls.Config.GetClientCertificate
+func (r *Reloader) ClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.maybeReload()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// ClientAuth 是否校验客户端证书
+func (r *Reloader) ClientAuth() tls.ClientAuthType {
+	return r.clientAuth
+}
+
+// NotAfter 返回当前证书的过期时间
+func (r *Reloader) NotAfter() time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.cert.Leaf == nil {
+		return time.Time{}
+	}
+	return r.cert.Leaf.NotAfter
+}
+
+// maybeReload 距离上次检查超过interval且文件有变化时重新加载
+func (r *Reloader) maybeReload() {
+	r.mu.RLock()
+	due := time.Since(r.checked) >= r.interval
+	r.mu.RUnlock()
+	if !due {
+		return
+	}
+	mt, err := r.latestModTime()
+	r.mu.Lock()
+	r.checked = time.Now()
+	changed := err == nil && mt.After(r.modTime)
+	r.mu.Unlock()
+	if err != nil {
+		r.log.Warn(logger.ErrorTLS, "检查证书文件", logger.ErrorField(err))
+		return
+	}
+	if !changed {
+		return
+	}
+	if err := r.load(); err != nil {
+		r.log.Error(logger.ErrorTLS, "重新加载证书失败, 继续使用原证书", logger.ErrorField(err))
+		return
+	}
+	r.log.Info("证书已重新加载", logger.MakeField("cert", r.certFile), logger.MakeField("notAfter", r.NotAfter()))
+}
+
+// load 加载证书, 私钥和CA
+func (r *Reloader) load() error {
+	mt, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	if cert.Leaf == nil && len(cert.Certificate) > 0 {
+		cert.Leaf, _ = x509.ParseCertificate(cert.Certificate[0])
+	}
+	var pool *x509.CertPool
+	if r.caFile != "" {
+		if pool, err = LoadPool(r.caFile); err != nil {
+			return err
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.pool = pool
+	r.modTime = mt
+	r.checked = time.Now()
+	return nil
+}
+
+func (r *Reloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, f := range []string{r.certFile, r.keyFile, r.caFile} {
+		if f == "" {
+			continue
+		}
+		fi, err := os.Stat(f)
+		if err != nil {
+			return latest, err
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// LoadPool 从PEM文件中加载证书池
+func LoadPool(caFile string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%w: %s", ErrNoCertificate, caFile)
+	}
+	return pool, nil
+}
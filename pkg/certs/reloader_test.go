@@ -0,0 +1,73 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeCert 生成自签名证书并写入文件
+func writeCert(t *testing.T, dir, cn string, mt time.Time) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600))
+	assert.NoError(t, os.Chtimes(certFile, mt, mt))
+	assert.NoError(t, os.Chtimes(keyFile, mt, mt))
+	return certFile, keyFile
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	certFile, keyFile := writeCert(t, dir, "first", now.Add(-time.Minute))
+	r, err := NewReloader(certFile, keyFile, WithInterval(0))
+	assert.NoError(t, err)
+
+	current := func() string {
+		conf, err := r.ServerConfig().GetConfigForClient(nil)
+		assert.NoError(t, err)
+		leaf, err := x509.ParseCertificate(conf.Certificates[0].Certificate[0])
+		assert.NoError(t, err)
+		return leaf.Subject.CommonName
+	}
+	assert.Equal(t, "first", current())
+
+	writeCert(t, dir, "second", now)
+	assert.Equal(t, "second", current())
+
+	// 文件损坏时继续使用原证书
+	assert.NoError(t, os.WriteFile(certFile, []byte("broken"), 0o600))
+	assert.NoError(t, os.Chtimes(certFile, now.Add(time.Minute), now.Add(time.Minute)))
+	assert.Equal(t, "second", current())
+}
+
+func TestLoadPool(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "ca", time.Now())
+	_, err := LoadPool(certFile)
+	assert.NoError(t, err)
+	_, err = LoadPool(keyFile)
+	assert.ErrorIs(t, err, ErrNoCertificate)
+}
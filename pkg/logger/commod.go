@@ -18,14 +18,20 @@ var (
 	ErrorHandleError     = AppError{code: 3005, msg: "Error Handle exception"}
 	ErrorRequestExecutor = AppError{code: 3006, msg: "HTTP Request Executor exception"}
 	ErrorServerPlugin    = AppError{code: 3007, msg: "ServerPlugin exception"}
+	ErrorAdminServer     = AppError{code: 3008, msg: "Admin Server exception"}
 
 	ErrorParamsIncomplete     = AppError{code: 4001, msg: "Incomplete parameters"} // 参数
 	ErrorAuthParamsIncomplete = AppError{code: 4101, msg: "Register/UnRegister body is null"}
+	ErrorAuthFailed           = AppError{code: 4102, msg: "Caller authentication failed"}
+	ErrorRateLimited          = AppError{code: 4103, msg: "Rate limit or quota exceeded"}
+	ErrorPolicyDenied         = AppError{code: 4104, msg: "Request denied by policy"}
 
 	ErrorHost          = AppError{code: 5001, msg: "Request address exception"} // 网络请求错误
 	ErrorHTTPHandle    = AppError{code: 5002, msg: "HTTP Handle exception"}
 	ErrorNetForwarding = AppError{code: 5003, msg: "Network forwarding error"}
 	ErrorMiddleware    = AppError{code: 5004, msg: "Middleware Handle error"}
+	ErrorTLS           = AppError{code: 5005, msg: "TLS certificate exception"}
+	ErrorWebSocket     = AppError{code: 5006, msg: "WebSocket connection exception"}
 
 	ErrorKafka             = AppError{code: 6001, msg: "Kafka execution exception"} // kafka
 	ErrorKafkaConsumer     = AppError{code: 6101, msg: "Kafka consumer execution exception"}
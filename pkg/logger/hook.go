@@ -0,0 +1,62 @@
+package logger
+
+// Hook 在记录带有AppError的日志(Warn/Error/Fatal)时被回调
+// 可用于按错误码统计错误数量等
+type Hook func(lv Level, err AppError)
+
+// hookLogger 在原有Logger的基础上, 记录日志时触发Hook
+type hookLogger struct {
+	Logger
+	hooks []Hook
+}
+
+// WithHooks 为log包装一层Hook, 返回的Logger在输出Warn/Error/Fatal日志前依次调用hooks
+// 如果log已经是被包装过的Logger, 新的hooks会追加到原有的hooks之后
+func WithHooks(log Logger, hooks ...Hook) Logger {
+	if hl, ok := log.(*hookLogger); ok {
+		return &hookLogger{Logger: hl.Logger, hooks: append(append([]Hook{}, hl.hooks...), hooks...)}
+	}
+	return &hookLogger{Logger: log, hooks: hooks}
+}
+
+func (hl *hookLogger) fire(lv Level, err AppError) {
+	for _, h := range hl.hooks {
+		h(lv, err)
+	}
+}
+
+// Warn logs a message at WarnLevel as AppError with Logger
+func (hl *hookLogger) Warn(err AppError, msg string, fields ...Field) {
+	hl.fire(WarnLevel, err)
+	hl.Logger.Warn(err, msg, fields...)
+}
+
+// Warnf logs a message at WarnLevel with SugaredLogger
+func (hl *hookLogger) Warnf(err AppError, temp string, args ...interface{}) {
+	hl.fire(WarnLevel, err)
+	hl.Logger.Warnf(err, temp, args...)
+}
+
+// Error logs a message at ErrorLevel with Logger
+func (hl *hookLogger) Error(err AppError, msg string, fields ...Field) {
+	hl.fire(ErrorLevel, err)
+	hl.Logger.Error(err, msg, fields...)
+}
+
+// Errorf logs a message at ErrorLevel with SugaredLogger
+func (hl *hookLogger) Errorf(err AppError, temp string, args ...interface{}) {
+	hl.fire(ErrorLevel, err)
+	hl.Logger.Errorf(err, temp, args...)
+}
+
+// Fatal logs a message and exit at FatalLevel with Logger
+func (hl *hookLogger) Fatal(err AppError, msg string, fields ...Field) {
+	hl.fire(FatalLevel, err)
+	hl.Logger.Fatal(err, msg, fields...)
+}
+
+// Fatalf logs a message at FatalLevel with SugaredLogger
+func (hl *hookLogger) Fatalf(err AppError, temp string, args ...interface{}) {
+	hl.fire(FatalLevel, err)
+	hl.Logger.Fatalf(err, temp, args...)
+}
@@ -43,10 +43,19 @@ const (
 	FatalLevel
 )
 
+// ParseLevel 将文本形式的日志级别(debug/info/warn/error/fatal)解析为Level
+func ParseLevel(text string) (Level, error) {
+	lv, err := zapcore.ParseLevel(text)
+	if err != nil {
+		return InfoLevel, err
+	}
+	return Level(lv), nil
+}
+
 // Logger 定义logger接口
 type Logger interface {
-	// SetLevel(Level)
-	// GetLevel() string
+	SetLevel(Level)
+	GetLevel() string
 	Log() *zap.Logger
 	Debugf(string, ...interface{})
 	Info(string, ...Field)
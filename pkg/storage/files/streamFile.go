@@ -9,19 +9,29 @@ import (
 	"sync"
 )
 
-var filePass chan [2]string // [src, tag]文件关闭时， 调用操作系统mv命令的队列
+var filePass chan filePassItem // 文件关闭时， 调用操作系统mv命令的队列
+
+// filePassItem 待移动的文件, done不为空时在移动完成后调用
+type filePassItem struct {
+	src, tag string
+	done     func(tag string, err error)
+}
 
 // init 函数在程序启动时自动执行，用于初始化全局变量和启动后台goroutine
 func init() {
-	filePass = make(chan [2]string, 5000)
+	filePass = make(chan filePassItem, 5000)
 	go func(ctx context.Context) {
-		for fileFlag := range filePass {
-			src, tag := fileFlag[0], fileFlag[1]
+		for item := range filePass {
+			src, tag := item.src, item.tag
 			// err := os.Rename(sf.file.Name(), tarpath) // 移动文件: cache/data.hsxa => target/path/data.hsxa
-			if _, err := exec.CommandContext(ctx, "mv", src, tag).Output(); err != nil { // nolint
+			_, err := exec.CommandContext(ctx, "mv", src, tag).Output() // nolint
+			if err != nil {
 				log.Printf("移动文件错误: error: %s, srcPath: %s,  targetPath: %s \n",
 					err.Error(), src, tag)
 			}
+			if item.done != nil {
+				item.done(tag, err)
+			}
 		}
 	}(context.TODO())
 }
@@ -83,13 +93,18 @@ func (sf *StreamFile) Name() string {
 //	返回值为一个包含两个nil值的tuple，表示没有返回值（实际开发中可能不返回StreamFile对象，而是直接返回error）
 //	第二个返回值error表示关闭文件过程中出现的错误，如果成功关闭则为nil
 func (sf *StreamFile) Close() (*StreamFile, error) {
+	return sf.CloseNotify(nil)
+}
+
+// CloseNotify 与Close相同, done不为空时在文件移动到目标路径后调用(tag: 目标路径, err: 移动的错误)
+func (sf *StreamFile) CloseNotify(done func(tag string, err error)) (*StreamFile, error) {
 	sf.lock.Lock()
 	defer sf.lock.Unlock()
 	sf.write.Flush()
 	sf.file.Close()
 	tarpath := JoinPath(sf.path, sf.name)
 
-	filePass <- [2]string{sf.file.Name(), tarpath}
+	filePass <- filePassItem{src: sf.file.Name(), tag: tarpath, done: done}
 	return nil, nil
 }
 
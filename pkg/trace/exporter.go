@@ -0,0 +1,201 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// Exporter span导出器
+type Exporter interface {
+	Export(ctx context.Context, service string, spans []*Span) error
+}
+
+const (
+	ExporterNone = "none" // 只传递链路上下文, 不导出
+	ExporterFile = "file" // 导出到文件
+	ExporterOTLP = "otlp" // 通过OTLP/HTTP导出
+)
+
+// NewExporter 根据类型创建导出器, kind为空或none时返回nil
+// target: file类型时为文件路径, otlp类型时为接收地址
+func NewExporter(kind, target string) (Exporter, error) {
+	switch kind {
+	case "", ExporterNone:
+		return nil, nil
+	case ExporterFile:
+		return NewFileExporter(target)
+	case ExporterOTLP:
+		if target == "" {
+			return nil, errors.New("otlp导出地址不能为空")
+		}
+		return NewOTLPExporter(target), nil
+	default:
+		return nil, fmt.Errorf("未知的链路导出类型: %s, 可选: none, file, otlp", kind)
+	}
+}
+
+// FileExporter 将span按OTLP/JSON格式逐行追加写入文件
+// 每次导出写一行, 可以被OpenTelemetry Collector的otlpjsonfile receiver读取
+type FileExporter struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// NewFileExporter 创建文件导出器
+// path: 导出文件路径, 不存在时创建
+func NewFileExporter(path string) (*FileExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileExporter{f: f}, nil
+}
+
+// Export 实现Exporter
+func (e *FileExporter) Export(_ context.Context, service string, spans []*Span) error {
+	data, err := json.Marshal(otlpPayload(service, spans))
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err = e.f.Write(append(data, '\n'))
+	return err
+}
+
+// Close 关闭导出文件
+func (e *FileExporter) Close() error {
+	return e.f.Close()
+}
+
+// OTLPExporter 通过OTLP/HTTP(JSON编码)导出span
+type OTLPExporter struct {
+	client   *http.Client
+	endpoint string
+}
+
+// NewOTLPExporter 创建OTLP/HTTP导出器
+// endpoint: 完整的接收地址, 如: http://collector:4318/v1/traces
+func NewOTLPExporter(endpoint string) *OTLPExporter {
+	return &OTLPExporter{client: &http.Client{}, endpoint: endpoint}
+}
+
+// Export 实现Exporter
+func (e *OTLPExporter) Export(ctx context.Context, service string, spans []*Span) error {
+	data, err := json.Marshal(otlpPayload(service, spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("otlp导出失败: %s", resp.Status)
+	}
+	return nil
+}
+
+// 以下为OTLP/JSON的编码结构, 只包含用到的字段
+// 参考: https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+type otlpAttr struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Message string `json:"message,omitempty"`
+	Code    int    `json:"code"`
+}
+
+type otlpSpan struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []otlpAttr `json:"attributes,omitempty"`
+	Status            otlpStatus `json:"status"`
+	Kind              int        `json:"kind"`
+}
+
+func otlpAttrValue(v any) otlpValue {
+	switch val := v.(type) {
+	case string:
+		return otlpValue{StringValue: &val}
+	case bool:
+		return otlpValue{BoolValue: &val}
+	case int:
+		s := strconv.Itoa(val)
+		return otlpValue{IntValue: &s}
+	case int64:
+		s := strconv.FormatInt(val, 10)
+		return otlpValue{IntValue: &s}
+	case uint64:
+		s := strconv.FormatUint(val, 10)
+		return otlpValue{IntValue: &s}
+	case float64:
+		return otlpValue{DoubleValue: &val}
+	default:
+		s := fmt.Sprint(val)
+		return otlpValue{StringValue: &s}
+	}
+}
+
+func otlpPayload(service string, spans []*Span) map[string]any {
+	list := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		sp := otlpSpan{
+			TraceID:           s.ctx.TraceIDString(),
+			SpanID:            s.ctx.SpanIDString(),
+			Name:              s.name,
+			Kind:              int(s.kind),
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Status:            otlpStatus{Code: 1}, // STATUS_CODE_OK
+		}
+		if s.parent != [8]byte{} {
+			sp.ParentSpanID = SpanContext{SpanID: s.parent}.SpanIDString()
+		}
+		for _, a := range s.attrs {
+			sp.Attributes = append(sp.Attributes, otlpAttr{Key: a.Key, Value: otlpAttrValue(a.Value)})
+		}
+		if s.errMsg != "" {
+			sp.Status = otlpStatus{Code: 2, Message: s.errMsg} // STATUS_CODE_ERROR
+		}
+		list = append(list, sp)
+	}
+	return map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{
+				"attributes": []otlpAttr{{Key: "service.name", Value: otlpAttrValue(service)}},
+			},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]any{"name": "github.com/chengfeiZhou/Wormhole"},
+				"spans": list,
+			}},
+		}},
+	}
+}
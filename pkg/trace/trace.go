@@ -0,0 +1,248 @@
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chengfeiZhou/Wormhole/pkg/logger"
+)
+
+const (
+	HeaderTraceparent = "traceparent" // W3C Trace Context 请求头
+
+	spanBuffer = 1024 // 待导出span的缓存数量
+	batchSize  = 128  // 达到该数量时立即导出
+	flushTick  = 5 * time.Second
+)
+
+// SpanKind 与OTLP中的SpanKind取值一致
+type SpanKind int
+
+const (
+	KindInternal SpanKind = iota + 1
+	KindServer
+	KindClient
+	KindProducer
+	KindConsumer
+)
+
+var ErrTraceparent = errors.New("无效的traceparent")
+
+// SpanContext 跨进程传递的链路上下文
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// IsValid trace id 和 span id 都不能全为0
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// TraceIDString 返回16进制的trace id
+func (sc SpanContext) TraceIDString() string {
+	return hex.EncodeToString(sc.TraceID[:])
+}
+
+// SpanIDString 返回16进制的span id
+func (sc SpanContext) SpanIDString() string {
+	return hex.EncodeToString(sc.SpanID[:])
+}
+
+// Traceparent 按W3C Trace Context格式输出: 00-{trace-id}-{span-id}-{flags}
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceIDString(), sc.SpanIDString(), flags)
+}
+
+// ParseTraceparent 解析W3C Trace Context格式的traceparent
+func ParseTraceparent(s string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, ErrTraceparent
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, ErrTraceparent
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, ErrTraceparent
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, ErrTraceparent
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return sc, ErrTraceparent
+	}
+	sc.Sampled = flags[0]&0x01 == 0x01
+	if !sc.IsValid() {
+		return sc, ErrTraceparent
+	}
+	return sc, nil
+}
+
+// Attr span的属性
+type Attr struct {
+	Value any
+	Key   string
+}
+
+// Span 一次操作的记录
+// nolint
+type Span struct {
+	tracer *Tracer
+	ctx    SpanContext
+	parent [8]byte
+	name   string
+	kind   SpanKind
+	start  time.Time
+	end    time.Time
+	attrs  []Attr
+	errMsg string
+	once   sync.Once
+}
+
+// Context 返回span的链路上下文, 用于向下游传递
+func (s *Span) Context() SpanContext {
+	return s.ctx
+}
+
+// Traceparent 返回用于向下游传递的traceparent
+func (s *Span) Traceparent() string {
+	return s.ctx.Traceparent()
+}
+
+// SetAttr 设置span属性
+func (s *Span) SetAttr(key string, value any) {
+	s.attrs = append(s.attrs, Attr{Key: key, Value: value})
+}
+
+// SetError 标记span失败
+func (s *Span) SetError(err error) {
+	if err != nil {
+		s.errMsg = err.Error()
+	}
+}
+
+// End 结束span并提交导出, 重复调用无效
+func (s *Span) End() {
+	s.once.Do(func() {
+		s.end = time.Now()
+		s.tracer.submit(s)
+	})
+}
+
+// Tracer 创建span并批量导出
+// Tracer 为nil时仍然可以创建span并传递链路上下文, 只是不导出
+type Tracer struct {
+	log      logger.Logger
+	exporter Exporter
+	service  string
+	spans    chan *Span
+}
+
+type OptionFunc func(*Tracer)
+
+// WithLogger 设置Tracer的日志记录器
+func WithLogger(log logger.Logger) OptionFunc {
+	return func(t *Tracer) {
+		t.log = log
+	}
+}
+
+// WithExporter 设置span导出器, 不设置时不导出
+func WithExporter(e Exporter) OptionFunc {
+	return func(t *Tracer) {
+		t.exporter = e
+	}
+}
+
+// NewTracer 创建Tracer
+// service: 服务名称, 导出时作为service.name
+func NewTracer(service string, ops ...OptionFunc) *Tracer {
+	t := &Tracer{
+		log:     logger.DefaultLogger(),
+		service: service,
+		spans:   make(chan *Span, spanBuffer),
+	}
+	for _, op := range ops {
+		op(t)
+	}
+	return t
+}
+
+// Start 开始一个span
+// parent 为上游传递的traceparent, 无效或为空时开始一条新的链路
+func (t *Tracer) Start(name string, kind SpanKind, parent string) *Span {
+	s := &Span{tracer: t, name: name, kind: kind, start: time.Now()}
+	if pc, err := ParseTraceparent(parent); err == nil {
+		s.ctx.TraceID = pc.TraceID
+		s.ctx.Sampled = pc.Sampled
+		s.parent = pc.SpanID
+	} else {
+		_, _ = rand.Read(s.ctx.TraceID[:])
+		s.ctx.Sampled = true
+	}
+	_, _ = rand.Read(s.ctx.SpanID[:])
+	return s
+}
+
+func (t *Tracer) submit(s *Span) {
+	if t == nil || t.exporter == nil || !s.ctx.Sampled {
+		return
+	}
+	select {
+	case t.spans <- s:
+	default: // 缓存已满时丢弃, 不阻塞业务
+	}
+}
+
+// Run 批量导出span, ctx结束时导出剩余的span后退出
+func (t *Tracer) Run(ctx context.Context) {
+	if t == nil || t.exporter == nil {
+		return
+	}
+	tick := time.NewTicker(flushTick)
+	defer tick.Stop()
+	batch := make([]*Span, 0, batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ectx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := t.exporter.Export(ectx, t.service, batch); err != nil {
+			t.log.Error(logger.ErrorMethod, "导出链路数据", logger.ErrorField(err), logger.MakeField("spans", len(batch)))
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case s := <-t.spans:
+			batch = append(batch, s)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-tick.C:
+			flush()
+		case <-ctx.Done():
+			for len(t.spans) > 0 {
+				batch = append(batch, <-t.spans)
+			}
+			flush()
+			return
+		}
+	}
+}
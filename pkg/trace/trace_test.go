@@ -0,0 +1,74 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		sampled bool
+		wantErr bool
+	}{
+		{name: "sampled", in: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", sampled: true},
+		{name: "not sampled", in: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", sampled: false},
+		{name: "empty", in: "", wantErr: true},
+		{name: "zero trace id", in: "00-00000000000000000000000000000000-00f067aa0ba902b7-01", wantErr: true},
+		{name: "bad hex", in: "00-4bf92f3577b34da6a3ce929d0e0e47zz-00f067aa0ba902b7-01", wantErr: true},
+		{name: "invalid version", in: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, err := ParseTraceparent(tt.in)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.sampled, sc.Sampled)
+			assert.Equal(t, tt.in, sc.Traceparent())
+		})
+	}
+}
+
+func TestTracerStart(t *testing.T) {
+	var tr *Tracer // 未配置Tracer时同样可以传递链路
+	root := tr.Start("root", KindServer, "")
+	assert.True(t, root.Context().IsValid())
+	child := tr.Start("child", KindClient, root.Traceparent())
+	assert.Equal(t, root.Context().TraceID, child.Context().TraceID)
+	assert.NotEqual(t, root.Context().SpanID, child.Context().SpanID)
+	child.End()
+	root.End()
+}
+
+func TestFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	exp, err := NewExporter(ExporterFile, path)
+	assert.NoError(t, err)
+	tr := NewTracer("test", WithExporter(exp))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		tr.Run(ctx)
+		close(done)
+	}()
+	span := tr.Start("op", KindInternal, "")
+	span.SetAttr("n", 1)
+	span.End()
+	cancel()
+	<-done
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	payload := map[string]any{}
+	assert.NoError(t, json.Unmarshal(data, &payload))
+	assert.Contains(t, string(data), span.Context().TraceIDString())
+}